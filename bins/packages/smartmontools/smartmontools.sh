@@ -0,0 +1,61 @@
+SMARTMONTOOLS_VERSION="7.4"
+# md5 of the release tarball, fill in when bumping the version
+SMARTMONTOOLS_CHECKSUM=""
+SMARTMONTOOLS_LINK="https://github.com/smartmontools/smartmontools/releases/download/RELEASE_7_4/smartmontools-${SMARTMONTOOLS_VERSION}.tar.gz"
+
+download_smartmontools() {
+    download_file "${SMARTMONTOOLS_LINK}" "${SMARTMONTOOLS_CHECKSUM}" "smartmontools-${SMARTMONTOOLS_VERSION}.tar.gz"
+}
+
+dependencies_smartmontools() {
+    apt-get install -y build-essential gcc g++ make
+}
+
+extract_smartmontools() {
+    if [ ! -d "smartmontools-${SMARTMONTOOLS_VERSION}" ]; then
+        echo "[+] extracting: smartmontools-${SMARTMONTOOLS_VERSION}"
+        tar -xf ${DISTDIR}/smartmontools-${SMARTMONTOOLS_VERSION}.tar.gz -C ${WORKDIR}
+    fi
+}
+
+prepare_smartmontools() {
+    echo "[+] configuring smartmontools"
+    github_name "smartmontools-${SMARTMONTOOLS_VERSION}"
+
+    # Build a static binary, the node image doesn't ship libstdc++
+    ./configure --prefix=/usr \
+        --without-systemdsystemunitdir \
+        --without-nvme-devicescan \
+        LDFLAGS="-static"
+}
+
+compile_smartmontools() {
+    make ${MAKEOPTS} smartctl
+}
+
+install_smartmontools() {
+    echo "[+] installing smartmontools"
+
+    mkdir -p "${ROOTDIR}/usr/sbin"
+    cp smartctl "${ROOTDIR}/usr/sbin/smartctl"
+    chmod +x "${ROOTDIR}/usr/sbin/smartctl"
+}
+
+build_smartmontools() {
+    dependencies_smartmontools
+
+    pushd "${DISTDIR}"
+    download_smartmontools
+    popd
+
+    pushd "${WORKDIR}"
+    extract_smartmontools
+
+    pushd "smartmontools-${SMARTMONTOOLS_VERSION}"
+    prepare_smartmontools
+    compile_smartmontools
+    install_smartmontools
+    popd
+
+    popd
+}
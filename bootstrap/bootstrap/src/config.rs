@@ -80,11 +80,42 @@ fn version() -> Result<Version> {
     Ok(ver)
 }
 
+fn proxy() -> Result<Option<String>> {
+    let params = kparams::params()?;
+    let proxy = match params.get("zos.proxy") {
+        Some(Some(proxy)) => Some(proxy.clone()),
+        Some(None) => bail!("missing zos.proxy value"),
+        None => None,
+    };
+
+    Ok(proxy)
+}
+
+/// hosts reached without the proxy, the local ones and the hosts or domains
+/// in the zos.noproxy kernel param
+fn no_proxy() -> Result<String> {
+    let params = kparams::params()?;
+    let mut hosts = vec!["localhost".to_string(), "127.0.0.1".into(), "::1".into()];
+    if let Some(Some(exclude)) = params.get("zos.noproxy") {
+        hosts.extend(
+            exclude
+                .split(',')
+                .map(|host| host.trim())
+                .filter(|host| !host.is_empty())
+                .map(String::from),
+        );
+    }
+
+    Ok(hosts.join(","))
+}
+
 pub struct Config {
     pub stage: u32,
     pub debug: bool,
     pub runmode: RunMode,
     pub version: Version,
+    pub proxy: Option<String>,
+    pub no_proxy: String,
 }
 
 impl Config {
@@ -128,6 +159,8 @@ impl Config {
             debug: matches.occurrences_of("debug") > 0,
             runmode: runmode()?,
             version: ver,
+            proxy: proxy()?,
+            no_proxy: no_proxy()?,
         })
     }
 }
@@ -29,6 +29,18 @@ fn app() -> Result<()> {
         .init()
         .unwrap();
 
+    if let Some(proxy) = &config.proxy {
+        // reqwest and the next stages use the proxy from the environment
+        info!("using proxy {}", proxy);
+        for key in &["http_proxy", "https_proxy", "HTTP_PROXY", "HTTPS_PROXY"] {
+            std::env::set_var(key, proxy);
+        }
+        info!("reaching {} without proxy", config.no_proxy);
+        for key in &["no_proxy", "NO_PROXY"] {
+            std::env::set_var(key, &config.no_proxy);
+        }
+    }
+
     // configure available stage
     let stages: Vec<fn(cfg: &Config) -> Result<()>> = vec![
         // self update
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/threefoldtech/zos/pkg/proxy"
 	"github.com/threefoldtech/zosbase/pkg/app"
 	"github.com/threefoldtech/zosbase/pkg/stubs"
 	"github.com/threefoldtech/zosbase/pkg/upgrade"
@@ -104,6 +105,11 @@ func main() {
 		log.Fatal().Err(err).Str("root", root).Msg("failed to create root directory")
 	}
 
+	// upgrades are downloaded from the hub through the proxy if any
+	if err := proxy.Setup(); err != nil {
+		log.Fatal().Err(err).Msg("failed to set up proxy")
+	}
+
 	// 2. Register the node to BCDB
 	// at this point we are running latest version
 	idMgr, err := getIdentityMgr(root, debug)
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+
+	"github.com/threefoldtech/zos/pkg/proxy"
+	"github.com/threefoldtech/zosbase/pkg/kernel"
+)
+
+const (
+	// kernel param with the static address of the zos bridge in cidr notation
+	paramAddress = "zos.ip"
+	// kernel param with the default gateway, required with a static address
+	paramGateway = "zos.gw"
+	// kernel param with a comma separated list of dns servers
+	paramDNS = "zos.dns"
+	// kernel param with a comma separated list of the nics to bond
+	paramBond = "zos.bond"
+	// kernel param with the bond mode, 802.3ad (default) or active-backup
+	paramBondMode = "zos.bond.mode"
+	// kernel param to bootstrap the zos bridge over ipv6 only
+	paramIPv6Only = "zos.ipv6only"
+	// kernel param with a comma separated list of host:port probed to check
+	// the internet connection
+	paramTargets = "zos.check"
+
+	// bondName is the name of the bond attached to the zos bridge
+	bondName = "zosbond"
+)
+
+// staticConfig is the static network config of the zos bridge
+type staticConfig struct {
+	Address *net.IPNet
+	Gateway net.IP
+	DNS     []net.IP
+}
+
+// bondConfig is the bond of nics attached to the zos bridge
+type bondConfig struct {
+	Slaves []string
+	Mode   netlink.BondMode
+}
+
+// config is the zos bridge config, it uses dhcp on the first nic with
+// ipv4 access if it's empty
+type config struct {
+	Static *staticConfig
+	Bond   *bondConfig
+	// IPv6Only selects the nic with ipv6 access, the zos bridge gets its
+	// addresses from router advertisements
+	IPv6Only bool
+	// Targets are the host:port probed to check the internet connection
+	Targets []string
+	// Proxy is the http proxy the targets are reached through if set
+	Proxy *proxy.Config
+}
+
+// network is the network used to check the internet connection
+func (c *config) network() string {
+	if c.IPv6Only {
+		return "tcp6"
+	}
+
+	return "tcp"
+}
+
+// mode is how the zos bridge is configured
+func (c *config) mode() string {
+	var mode string
+	switch {
+	case c.Static != nil:
+		mode = "static"
+	case c.IPv6Only:
+		mode = "ipv6"
+	default:
+		mode = "dhcp"
+	}
+
+	if c.Bond != nil {
+		mode += "+bond"
+	}
+
+	return mode
+}
+
+func list(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		v = strings.TrimSpace(v)
+		if len(v) != 0 {
+			values = append(values, v)
+		}
+	}
+
+	return values
+}
+
+// configFromKernel loads the zos bridge config from kernel params
+func configFromKernel(params kernel.Params) (config, error) {
+	cfg := config{IPv6Only: params.Exists(paramIPv6Only), Targets: targets}
+
+	if value, ok := params.GetOne(paramTargets); ok {
+		cfg.Targets = list(value)
+		if len(cfg.Targets) == 0 {
+			return cfg, fmt.Errorf("%s has no targets", paramTargets)
+		}
+
+		for _, target := range cfg.Targets {
+			if _, _, err := net.SplitHostPort(target); err != nil {
+				return cfg, fmt.Errorf("invalid %s target '%s', expecting host:port", paramTargets, target)
+			}
+		}
+	}
+
+	var err error
+	if cfg.Proxy, err = proxy.FromKernel(params); err != nil {
+		return cfg, err
+	}
+
+	if address, ok := params.GetOne(paramAddress); ok {
+		ip, ipNet, err := net.ParseCIDR(address)
+		if err != nil || ip.To4() == nil {
+			return cfg, fmt.Errorf("invalid %s '%s', expecting an ipv4 cidr", paramAddress, address)
+		}
+		ipNet.IP = ip
+
+		value, _ := params.GetOne(paramGateway)
+		gw := net.ParseIP(value)
+		if gw == nil || gw.To4() == nil {
+			return cfg, fmt.Errorf("invalid %s '%s', required with %s", paramGateway, value, paramAddress)
+		}
+
+		if !ipNet.Contains(gw) {
+			return cfg, fmt.Errorf("gateway '%s' is not in the network of '%s'", gw, address)
+		}
+
+		if cfg.IPv6Only {
+			return cfg, fmt.Errorf("%s can't be used with %s", paramAddress, paramIPv6Only)
+		}
+
+		cfg.Static = &staticConfig{Address: ipNet, Gateway: gw}
+
+		value, _ = params.GetOne(paramDNS)
+		for _, server := range list(value) {
+			ip := net.ParseIP(server)
+			if ip == nil {
+				return cfg, fmt.Errorf("invalid dns server '%s'", server)
+			}
+			cfg.Static.DNS = append(cfg.Static.DNS, ip)
+		}
+	} else if params.Exists(paramGateway) || params.Exists(paramDNS) {
+		return cfg, fmt.Errorf("%s and %s require %s", paramGateway, paramDNS, paramAddress)
+	}
+
+	if value, ok := params.GetOne(paramBond); ok {
+		slaves := list(value)
+		if len(slaves) == 0 {
+			return cfg, fmt.Errorf("%s has no nics", paramBond)
+		}
+
+		mode := netlink.BOND_MODE_802_3AD
+		if value, ok := params.GetOne(paramBondMode); ok {
+			switch value {
+			case "802.3ad":
+			case "active-backup":
+				mode = netlink.BOND_MODE_ACTIVE_BACKUP
+			default:
+				return cfg, fmt.Errorf("unsupported %s '%s'", paramBondMode, value)
+			}
+		}
+
+		cfg.Bond = &bondConfig{Slaves: slaves, Mode: mode}
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/vishvananda/netlink"
+
+	"github.com/threefoldtech/zosbase/pkg/kernel"
+)
+
+func TestConfigFromKernel(t *testing.T) {
+	cfg, err := configFromKernel(kernel.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Static != nil || cfg.Bond != nil {
+		t.Fatalf("expected dhcp config, got %+v", cfg)
+	}
+
+	cfg, err = configFromKernel(kernel.Params{
+		paramAddress:  {"10.1.0.20/24"},
+		paramGateway:  {"10.1.0.1"},
+		paramDNS:      {"1.1.1.1, 8.8.8.8"},
+		paramBond:     {"eth0,eth1"},
+		paramBondMode: {"active-backup"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Static.Address.String() != "10.1.0.20/24" || len(cfg.Static.DNS) != 2 {
+		t.Fatalf("unexpected static config %+v", cfg.Static)
+	}
+
+	if len(cfg.Bond.Slaves) != 2 || cfg.Bond.Mode != netlink.BOND_MODE_ACTIVE_BACKUP {
+		t.Fatalf("unexpected bond config %+v", cfg.Bond)
+	}
+}
+
+func TestConfigFromKernelTargets(t *testing.T) {
+	cfg, err := configFromKernel(kernel.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cfg.Targets) != len(targets) || cfg.Proxy != nil {
+		t.Fatalf("expected default targets without proxy, got %+v", cfg)
+	}
+
+	cfg, err = configFromKernel(kernel.Params{
+		paramTargets: {"example.com:443,10.0.0.1:80"},
+		"zos.proxy":  {"http://proxy.lan:3128"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cfg.Targets) != 2 || cfg.Targets[0] != "example.com:443" {
+		t.Fatalf("unexpected targets %v", cfg.Targets)
+	}
+
+	if cfg.Proxy == nil || cfg.Proxy.URL.Host != "proxy.lan:3128" {
+		t.Fatalf("unexpected proxy %+v", cfg.Proxy)
+	}
+}
+
+func TestConfigFromKernelIPv6Only(t *testing.T) {
+	cfg, err := configFromKernel(kernel.Params{paramIPv6Only: {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !cfg.IPv6Only || cfg.network() != "tcp6" {
+		t.Fatalf("expected ipv6 only config, got %+v", cfg)
+	}
+}
+
+func TestConfigFromKernelInvalid(t *testing.T) {
+	for _, params := range []kernel.Params{
+		{paramAddress: {"10.1.0.20"}, paramGateway: {"10.1.0.1"}},
+		{paramAddress: {"10.1.0.20/24"}},
+		{paramAddress: {"10.1.0.20/24"}, paramGateway: {"10.2.0.1"}},
+		{paramGateway: {"10.1.0.1"}},
+		{paramBond: {","}},
+		{paramBond: {"eth0"}, paramBondMode: {"balance-rr"}},
+		{paramIPv6Only: {}, paramAddress: {"10.1.0.20/24"}, paramGateway: {"10.1.0.1"}},
+		{paramTargets: {"example.com"}},
+	} {
+		if _, err := configFromKernel(params); err == nil {
+			t.Errorf("expected an error for %v", params)
+		}
+	}
+}
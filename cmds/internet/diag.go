@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/vishvananda/netlink"
+
+	"github.com/threefoldtech/zos/pkg/netdiag"
+)
+
+const (
+	// probeTimeout is the timeout of a single dns resolution or probe
+	probeTimeout = 10 * time.Second
+	// consolePath is where the report summary is printed
+	consolePath = "/dev/console"
+)
+
+// targets are the addresses probed by default to check the internet connection
+var targets = []string{"bootstrap.grid.tf:http", "hub.grid.tf:http"}
+
+// diagnose fills the report with the state of the interfaces and routes, the
+// resolution of the targets and the results of tcp and http probes of the
+// config targets. The tcp probes are done through the proxy if one is set. It
+// fails if any of the tcp probes fails.
+func diagnose(report *netdiag.Report, cfg config) error {
+	interfaces, err := diagInterfaces()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list interfaces")
+	}
+
+	if len(report.Attempts) != 0 {
+		selected := report.Attempts[len(report.Attempts)-1].Selected
+		for i := range interfaces {
+			interfaces[i].Selected = interfaces[i].Name == selected
+		}
+	}
+
+	routes, err := diagRoutes()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list routes")
+	}
+
+	report.Interfaces = interfaces
+	report.Routes = routes
+	report.DNS = report.DNS[:0]
+	report.Probes = report.Probes[:0]
+
+	var proxyURL *url.URL
+	if cfg.Proxy != nil {
+		proxyURL = cfg.Proxy.URL
+		report.Proxy = proxyURL.Redacted()
+		report.DNS = append(report.DNS, resolve(proxyURL.Hostname()))
+	}
+
+	network := cfg.network()
+	var failed error
+	for _, target := range cfg.Targets {
+		host, port, err := net.SplitHostPort(target)
+		if err != nil {
+			return errors.Wrapf(err, "invalid target '%s'", target)
+		}
+
+		var probe netdiag.Probe
+		if proxyURL != nil {
+			// targets are resolved by the proxy
+			probe = probeConnect(network, proxyURL, target)
+		} else {
+			report.DNS = append(report.DNS, resolve(host))
+			probe = probeTCP(network, target)
+		}
+
+		report.Probes = append(report.Probes, probe)
+		if len(probe.Error) != 0 && failed == nil {
+			failed = fmt.Errorf("failed to reach %s: %s", target, probe.Error)
+		}
+
+		if port == "http" || port == "80" {
+			report.Probes = append(report.Probes, probeHTTP(network, proxyURL, fmt.Sprintf("http://%s/", host)))
+		}
+	}
+
+	return failed
+}
+
+func diagInterfaces() ([]netdiag.Interface, error) {
+	links, err := netlink.LinkList()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[int]string)
+	for _, link := range links {
+		names[link.Attrs().Index] = link.Attrs().Name
+	}
+
+	var interfaces []netdiag.Interface
+	for _, link := range links {
+		attrs := link.Attrs()
+		if attrs.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+
+		inf := netdiag.Interface{
+			Name:   attrs.Name,
+			Type:   link.Type(),
+			MAC:    attrs.HardwareAddr.String(),
+			State:  attrs.OperState.String(),
+			Master: names[attrs.MasterIndex],
+		}
+
+		addrs, err := netlink.AddrList(link, netlink.FAMILY_ALL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list addresses of %s", attrs.Name)
+		}
+
+		for _, addr := range addrs {
+			inf.Addresses = append(inf.Addresses, addr.IPNet.String())
+		}
+
+		interfaces = append(interfaces, inf)
+	}
+
+	return interfaces, nil
+}
+
+func diagRoutes() ([]netdiag.Route, error) {
+	routes, err := netlink.RouteList(nil, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []netdiag.Route
+	for _, route := range routes {
+		entry := netdiag.Route{Dst: "default"}
+		if route.Dst != nil {
+			entry.Dst = route.Dst.String()
+		}
+
+		if route.Gw != nil {
+			entry.Gateway = route.Gw.String()
+		}
+
+		if link, err := netlink.LinkByIndex(route.LinkIndex); err == nil {
+			entry.Interface = link.Attrs().Name
+		}
+
+		result = append(result, entry)
+	}
+
+	return result, nil
+}
+
+func resolve(host string) netdiag.Resolution {
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+
+	result := netdiag.Resolution{Host: host}
+	start := time.Now()
+	addresses, err := net.DefaultResolver.LookupHost(ctx, host)
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Error = err.Error()
+	}
+	result.Addresses = addresses
+
+	return result
+}
+
+func probeTCP(network, target string) netdiag.Probe {
+	result := netdiag.Probe{Kind: "tcp", Target: target}
+
+	start := time.Now()
+	con, err := net.DialTimeout(network, target, probeTimeout)
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	_ = con.Close()
+	return result
+}
+
+// dialProxy connects to the proxy, over tls for https proxies
+func dialProxy(network string, proxy *url.URL) (net.Conn, error) {
+	port := proxy.Port()
+	if len(port) == 0 {
+		port = "80"
+		if proxy.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	address := net.JoinHostPort(proxy.Hostname(), port)
+	dialer := net.Dialer{Timeout: probeTimeout}
+	if proxy.Scheme == "https" {
+		return tls.DialWithDialer(&dialer, network, address, &tls.Config{ServerName: proxy.Hostname()})
+	}
+
+	return dialer.Dial(network, address)
+}
+
+// probeConnect opens a tunnel to the target through the http proxy
+func probeConnect(network string, proxy *url.URL, target string) netdiag.Probe {
+	result := netdiag.Probe{Kind: "connect", Target: target}
+
+	start := time.Now()
+	defer func() {
+		result.Duration = time.Since(start)
+	}()
+
+	con, err := dialProxy(network, proxy)
+	if err != nil {
+		result.Error = errors.Wrap(err, "failed to connect to proxy").Error()
+		return result
+	}
+	defer con.Close()
+
+	_ = con.SetDeadline(time.Now().Add(probeTimeout))
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: target},
+		Host:   target,
+		Header: make(http.Header),
+	}
+
+	if user := proxy.User; user != nil {
+		password, _ := user.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+
+	if err := req.Write(con); err != nil {
+		result.Error = errors.Wrap(err, "failed to send connect request").Error()
+		return result
+	}
+
+	res, err := http.ReadResponse(bufio.NewReader(con), req)
+	if err != nil {
+		result.Error = errors.Wrap(err, "failed to read connect response").Error()
+		return result
+	}
+	res.Body.Close()
+
+	result.Status = res.Status
+	if res.StatusCode != http.StatusOK {
+		result.Error = fmt.Sprintf("proxy refused tunnel: %s", res.Status)
+	}
+
+	return result
+}
+
+func probeHTTP(network string, proxy *url.URL, target string) netdiag.Probe {
+	result := netdiag.Probe{Kind: "http", Target: target}
+
+	dialer := net.Dialer{Timeout: probeTimeout}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+
+	if proxy != nil {
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	client := http.Client{
+		Timeout:   probeTimeout,
+		Transport: transport,
+	}
+
+	start := time.Now()
+	res, err := client.Get(target)
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer res.Body.Close()
+
+	result.Status = res.Status
+	return result
+}
+
+// save writes the report, the bootstrap doesn't fail if it can't be written
+func save(report *netdiag.Report) {
+	if err := report.Save(netdiag.ReportPath); err != nil {
+		log.Error().Err(err).Msg("failed to write network bootstrap report")
+	}
+
+	printReport(report)
+}
+
+// printed is the summary last printed to the console
+var printed []string
+
+// printReport prints the report summary to the console if it changed, zui
+// only starts once the node is connected so it can't show it
+func printReport(report *netdiag.Report) {
+	summary := report.Summary()
+	if len(summary) == 0 || reflect.DeepEqual(summary, printed) {
+		return
+	}
+
+	console, err := os.OpenFile(consolePath, os.O_WRONLY, 0)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to open console")
+		return
+	}
+	defer console.Close()
+
+	fmt.Fprintln(console, "network bootstrap is not connected:")
+	for _, line := range summary {
+		fmt.Fprintf(console, "  %s\n", line)
+	}
+
+	printed = summary
+}
+
+// logReport prints the report summary
+func logReport(report *netdiag.Report) {
+	for _, line := range report.Summary() {
+		log.Info().Msg(line)
+	}
+}
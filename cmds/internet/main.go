@@ -2,8 +2,9 @@ package main
 
 import (
 	"flag"
-	"net"
+	"fmt"
 	"os"
+	"syscall"
 	"time"
 
 	"github.com/cenkalti/backoff"
@@ -11,8 +12,10 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/vishvananda/netlink"
 
+	"github.com/threefoldtech/zos/pkg/netdiag"
 	"github.com/threefoldtech/zosbase/pkg/app"
 	"github.com/threefoldtech/zosbase/pkg/environment"
+	"github.com/threefoldtech/zosbase/pkg/kernel"
 	"github.com/threefoldtech/zosbase/pkg/network/bootstrap"
 	"github.com/threefoldtech/zosbase/pkg/network/bridge"
 	"github.com/threefoldtech/zosbase/pkg/network/dhcp"
@@ -39,13 +42,20 @@ func main() {
 		return
 	}
 
-	if err := configureZOS(); err != nil {
+	cfg, err := configFromKernel(kernel.GetParams())
+	if err != nil {
+		log.Error().Err(err).Msg("invalid network kernel params")
+		os.Exit(1)
+	}
+
+	report := &netdiag.Report{Started: time.Now(), Mode: cfg.mode()}
+	if err := configureZOS(cfg, report); err != nil {
 		log.Error().Err(err).Msg("failed to bootstrap network")
 		os.Exit(1)
 	}
 
 	// wait for internet connection
-	if err := check(); err != nil {
+	if err := check(cfg, report); err != nil {
 		log.Error().Err(err).Msg("failed to check internet connection")
 		os.Exit(1)
 	}
@@ -53,66 +63,29 @@ func main() {
 	log.Info().Msg("network bootstrapped successfully")
 }
 
-// debugZos prints some helpful debugging information
-// to help with debugging issues if internet connection wasn't established
-func debugZos() error {
-	br, err := bridge.Get(types.DefaultBridge)
-	if err != nil {
-		return errors.Wrap(err, "failed to get default bridge")
-	}
-
-	addrs, err := netlink.AddrList(br, netlink.FAMILY_ALL)
-	if err != nil {
-		return errors.Wrap(err, "failed to list bridge addresses")
-	}
-
-	for _, addr := range addrs {
-		log.Info().Str("address", addr.String()).Msg("default bridge has address")
-	}
-
-	routes, err := netlink.RouteList(br, netlink.FAMILY_ALL)
-	if err != nil {
-		return errors.Wrap(err, "failed to list bridge routes")
-	}
-
-	for _, route := range routes {
-		log.Info().Str("route", route.String()).Msg("default bridge has routes")
-	}
-
-	return nil
-}
-
-// check tests the internet connection after configuration is completed.
-// it keeps retrying to connect until the test is completed successfully.
-func check() error {
+// check tests the internet connection to the config targets after
+// configuration is completed. it keeps retrying to connect until the test
+// is completed successfully. The diagnostics of every try are written to
+// the report.
+func check(cfg config, report *netdiag.Report) error {
 	retries := 0
 	f := func() error {
 		retries += 1
 
-		if err := debugZos(); err != nil {
-			log.Error().Err(err).Msg("failed to list default bridge debug information")
-		}
-
 		// we only care about possibility of establishing a connection
 		// so just establishing a connection then close it is good enough
-		for _, address := range []string{"bootstrap.grid.tf:http", "hub.grid.tf:http"} {
-			log.Info().Str("trying out address", address).Msg("testing internet connection.")
-			con, err := net.Dial("tcp", address)
-			if err != nil {
-				return errors.Wrapf(err, "failed to reach %s", address)
-			}
+		err := diagnose(report, cfg)
+		report.Checks = retries
+		report.Connected = err == nil
+		save(report)
 
-			if err := con.Close(); err != nil {
-				return err
-			}
-		}
-
-		return nil
+		return err
 	}
 
 	errHandler := func(err error, t time.Duration) {
 		if err != nil {
 			log.Info().Msg("internet connection is not ready yet")
+			logReport(report)
 			if retries%10 == 0 {
 				log.Error().Err(err).Msgf("error while trying to test internet connectivity. %d retries attempted", retries)
 			}
@@ -130,30 +103,52 @@ configureZOS bootstraps the private zos network (private subnet) it goes as foll
     found in previous step is attached to the zos bridge.
   - Bridge and interface are brought UP then a DHCP daemon is started on the zos to get an IP.
 
+The interface can also be set with kernel params:
+  - zos.bond=<nic>,<nic> creates a bond of the nics (zos.bond.mode is 802.3ad or active-backup)
+    and attaches it to the zos bridge instead of the interface.
+  - zos.ip=<cidr> zos.gw=<ip> [zos.dns=<ip>,<ip>] sets a static address on the zos bridge instead
+    of starting a DHCP daemon. Without a bond, the first plugged physical interface is used.
+  - zos.ipv6only selects the interface with IPv6 access instead, keeps IPv6 enabled on it and
+    checks the internet connection over IPv6. The bridge must get an address over SLAAC, no
+    DHCP daemon is started.
+
 In case there is a priv vlan is configured (kernel param vlan:priv=<id>) it is basically the same as
 before but with the next twist:
 - During probing of the interface, probing done on that vlan
 - ZOS is added to vlan as `bridge vlan add vid <id> dev zos pvid self untagged`
 - link is added to vlan as `bridge vlan add vid <id> dev <link>`
 */
-func configureZOS() error {
+func configureZOS(cfg config, report *netdiag.Report) error {
 	env := environment.MustGet()
 
-	f := func() error {
+	f := func() (err error) {
 		log.Info().Msg("Start network bootstrap")
 
-		ifaceConfigs, err := bootstrap.AnalyzeLinks(
-			bootstrap.RequiresIPv4.WithVlan(env.PrivVlan),
-			bootstrap.PhysicalFilter,
-			bootstrap.PluggedFilter)
-		if err != nil {
-			log.Error().Err(err).Msg("failed to gather network interfaces configuration")
-			return err
+		attempt := netdiag.Attempt{Time: time.Now()}
+		defer func() {
+			if err != nil {
+				attempt.Error = err.Error()
+			}
+
+			report.Attempt(attempt)
+			if err != nil {
+				// interfaces state helps to tell why no interface was selected
+				_ = diagnose(report, cfg)
+			}
+			save(report)
+		}()
+
+		var zosChild string
+		switch {
+		case cfg.Bond != nil:
+			zosChild, err = ensureBond(cfg.Bond)
+		case cfg.Static != nil:
+			zosChild, err = selectPlugged()
+		default:
+			zosChild, attempt.Candidates, err = selectProbed(env.PrivVlan, cfg.IPv6Only)
 		}
+		attempt.Selected = zosChild
 
-		log.Info().Int("count", len(ifaceConfigs)).Msg("found interfaces with internet access")
-		log.Info().Msgf("found interfaces: %+v", ifaceConfigs)
-		zosChild, err := bootstrap.SelectZOS(ifaceConfigs)
 		if err != nil {
 			log.Error().Err(err).Msg("failed to select a valid interface for zos bridge")
 			return err
@@ -185,8 +180,8 @@ func configureZOS() error {
 			return err
 		}
 
-		if err := options.Set(zosChild, options.IPv6Disable(true)); err != nil {
-			return errors.Wrapf(err, "failed to disable ip6 on zos slave %s", zosChild)
+		if err := options.Set(zosChild, options.IPv6Disable(!cfg.IPv6Only)); err != nil {
+			return errors.Wrapf(err, "failed to set ip6 on zos slave %s", zosChild)
 		}
 
 		if err := netlink.LinkSetUp(link); err != nil {
@@ -216,6 +211,21 @@ func configureZOS() error {
 			}
 		}
 
+		if cfg.IPv6Only {
+			// addresses and default route are set by router advertisements
+			log.Info().Msg("bootstrapping zos bridge over ipv6 only")
+			if err := options.Set(types.DefaultBridge, options.IPv6Disable(false)); err != nil {
+				return errors.Wrap(err, "failed to enable ipv6 on zos bridge")
+			}
+
+			return waitSLAAC(br)
+		}
+
+		if cfg.Static != nil {
+			log.Info().Str("address", cfg.Static.Address.String()).Msg("setting static address of zos bridge")
+			return configureStatic(br, cfg.Static)
+		}
+
 		dhcpService := dhcp.NewService(types.DefaultBridge, "", zinit.Default())
 		if err := dhcpService.DestroyOlderService(); err != nil {
 			log.Error().Err(err).Msgf("failed to destory older %s service", dhcpService.Name)
@@ -243,3 +253,54 @@ func configureZOS() error {
 
 	return backoff.RetryNotify(f, backoff.NewExponentialBackOff(), errHandler)
 }
+
+// waitSLAAC waits for the zos bridge to get a global ipv6 address from the
+// router advertisements. There is no dhcpv6 client, so ipv6 only nodes need
+// a router that advertises a prefix for slaac.
+func waitSLAAC(br netlink.Link) error {
+	for i := 0; i < 30; i++ {
+		addrs, err := netlink.AddrList(br, netlink.FAMILY_V6)
+		if err != nil {
+			return errors.Wrapf(err, "failed to list addresses of %s", br.Attrs().Name)
+		}
+
+		for _, addr := range addrs {
+			if addr.IP.IsGlobalUnicast() && addr.Flags&syscall.IFA_F_TENTATIVE == 0 {
+				log.Info().Str("address", addr.IPNet.String()).Msg("zos bridge got slaac address")
+				return nil
+			}
+		}
+
+		time.Sleep(time.Second)
+	}
+
+	return fmt.Errorf("no slaac address on %s, dhcpv6 only networks are not supported", br.Attrs().Name)
+}
+
+// selectProbed returns the physical plugged interface that can get an IPv4
+// over DHCP, or an IPv6 over SLAAC if ipv6 is set
+func selectProbed(vlan *uint16, ipv6 bool) (string, []string, error) {
+	requires := bootstrap.RequiresIPv4
+	if ipv6 {
+		requires = bootstrap.RequiresIPv6
+	}
+
+	ifaceConfigs, err := bootstrap.AnalyzeLinks(
+		requires.WithVlan(vlan),
+		bootstrap.PhysicalFilter,
+		bootstrap.PluggedFilter)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "failed to gather network interfaces configuration")
+	}
+
+	log.Info().Int("count", len(ifaceConfigs)).Bool("ipv6", ipv6).Msg("found interfaces with internet access")
+	log.Info().Msgf("found interfaces: %+v", ifaceConfigs)
+
+	candidates := make([]string, 0, len(ifaceConfigs))
+	for _, cfg := range ifaceConfigs {
+		candidates = append(candidates, cfg.Name)
+	}
+
+	selected, err := bootstrap.SelectZOS(ifaceConfigs)
+	return selected, candidates, err
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/vishvananda/netlink"
+
+	"github.com/threefoldtech/zosbase/pkg/network/bootstrap"
+	"github.com/threefoldtech/zosbase/pkg/network/options"
+)
+
+// resolvConf is the resolver config written for static dns servers
+const resolvConf = "/etc/resolv.conf"
+
+// selectPlugged returns the first plugged physical nic, it's used if the
+// zos bridge has a static address since nics can't be probed with dhcp
+func selectPlugged() (string, error) {
+	links, err := netlink.LinkList()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to list links")
+	}
+
+	var names []string
+next:
+	for _, link := range links {
+		for _, filter := range []bootstrap.Filter{bootstrap.PhysicalFilter, bootstrap.PluggedFilter} {
+			ok, err := filter(link)
+			if err != nil {
+				log.Error().Err(err).Str("link", link.Attrs().Name).Msg("failed to check link")
+				continue next
+			}
+
+			if !ok {
+				continue next
+			}
+		}
+
+		names = append(names, link.Attrs().Name)
+	}
+
+	if len(names) == 0 {
+		return "", fmt.Errorf("no plugged physical interface found")
+	}
+
+	sort.Strings(names)
+	return names[0], nil
+}
+
+// ensureBond creates the bond if it doesn't exist and enslaves the nics
+func ensureBond(cfg *bondConfig) (string, error) {
+	link, err := netlink.LinkByName(bondName)
+	if _, ok := err.(netlink.LinkNotFoundError); ok {
+		bond := netlink.NewLinkBond(netlink.LinkAttrs{Name: bondName})
+		bond.Mode = cfg.Mode
+		bond.Miimon = 100
+		if cfg.Mode == netlink.BOND_MODE_802_3AD {
+			bond.LacpRate = netlink.BOND_LACP_RATE_FAST
+		}
+
+		if err := netlink.LinkAdd(bond); err != nil {
+			return "", errors.Wrapf(err, "failed to create bond '%s'", bondName)
+		}
+
+		link = bond
+	} else if err != nil {
+		return "", errors.Wrapf(err, "failed to get bond '%s'", bondName)
+	} else if link.Type() != "bond" {
+		return "", fmt.Errorf("link '%s' exists and is not a bond", bondName)
+	}
+
+	for _, name := range cfg.Slaves {
+		slave, err := netlink.LinkByName(name)
+		if err != nil {
+			return "", errors.Wrapf(err, "could not get bond slave %s", name)
+		}
+
+		if slave.Attrs().MasterIndex == link.Attrs().Index {
+			continue
+		}
+
+		// a nic must be down to be enslaved
+		if err := netlink.LinkSetDown(slave); err != nil {
+			return "", errors.Wrapf(err, "could not bring %s down", name)
+		}
+
+		if err := netlink.LinkSetMaster(slave, link); err != nil {
+			return "", errors.Wrapf(err, "failed to add %s to bond '%s'", name, bondName)
+		}
+
+		if err := options.Set(name, options.IPv6Disable(true)); err != nil {
+			return "", errors.Wrapf(err, "failed to disable ip6 on bond slave %s", name)
+		}
+
+		if err := netlink.LinkSetUp(slave); err != nil {
+			return "", errors.Wrapf(err, "could not bring %s up", name)
+		}
+
+		log.Info().Str("device", name).Str("bond", bondName).Msg("nic added to bond")
+	}
+
+	return bondName, nil
+}
+
+// configureStatic sets the static address, default route and dns servers
+// of the zos bridge
+func configureStatic(br netlink.Link, cfg *staticConfig) error {
+	if err := netlink.LinkSetUp(br); err != nil {
+		return errors.Wrapf(err, "could not bring %s up", br.Attrs().Name)
+	}
+
+	if err := netlink.AddrReplace(br, &netlink.Addr{IPNet: cfg.Address}); err != nil {
+		return errors.Wrapf(err, "failed to set address '%s' on %s", cfg.Address, br.Attrs().Name)
+	}
+
+	route := netlink.Route{LinkIndex: br.Attrs().Index, Gw: cfg.Gateway}
+	if err := netlink.RouteReplace(&route); err != nil {
+		return errors.Wrapf(err, "failed to set default gateway '%s'", cfg.Gateway)
+	}
+
+	if len(cfg.DNS) == 0 {
+		return nil
+	}
+
+	var buf strings.Builder
+	for _, server := range cfg.DNS {
+		fmt.Fprintf(&buf, "nameserver %s\n", server)
+	}
+
+	if err := os.WriteFile(resolvConf, []byte(buf.String()), 0644); err != nil {
+		return errors.Wrap(err, "failed to write dns servers")
+	}
+
+	return nil
+}
@@ -5,17 +5,22 @@ import (
 	"crypto/ed25519"
 	"encoding/hex"
 	"fmt"
-	"slices"
+	"path/filepath"
 	"time"
 
-	"github.com/cenkalti/backoff/v3"
 	"github.com/rs/zerolog/log"
 	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
 	"github.com/threefoldtech/tfgrid-sdk-go/rmb-sdk-go/peer"
+	"github.com/threefoldtech/tfgrid-sdk-go/rmb-sdk-go/peer/encoder"
 	"github.com/threefoldtech/zbus"
+	"github.com/threefoldtech/zos/pkg/proxy"
+	"github.com/threefoldtech/zos/pkg/rmbpolicy"
+	"github.com/threefoldtech/zos/pkg/rmbtrace"
+	"github.com/threefoldtech/zos/pkg/substratepool"
+	"github.com/threefoldtech/zosbase/pkg"
 	"github.com/threefoldtech/zosbase/pkg/environment"
+	"github.com/threefoldtech/zosbase/pkg/events"
 	"github.com/threefoldtech/zosbase/pkg/stubs"
-	substrategw "github.com/threefoldtech/zosbase/pkg/substrate_gateway"
 	"github.com/threefoldtech/zosbase/pkg/utils"
 	zosapi "github.com/threefoldtech/zosbase/pkg/zos_api"
 	"github.com/urfave/cli/v2"
@@ -28,15 +33,22 @@ var Module cli.Command = cli.Command{
 	Name:  module,
 	Usage: "handles outgoing chain calls and incoming rmb calls",
 	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "root",
+			Usage: "`ROOT` working directory of the module",
+			Value: "/var/cache/modules/api-gateway",
+		},
 		&cli.StringFlag{
 			Name:  "broker",
 			Usage: "connection string to the message `BROKER`",
 			Value: "unix:///var/run/redis.sock",
 		},
+		// chain write calls of the gateway wait for their extrinsic, so
+		// more workers are needed to keep serving the other calls
 		&cli.UintFlag{
 			Name:  "workers",
 			Usage: "number of workers `N`",
-			Value: 1,
+			Value: 5,
 		},
 	},
 	Action: action,
@@ -44,10 +56,15 @@ var Module cli.Command = cli.Command{
 
 func action(cli *cli.Context) error {
 	var (
+		moduleRoot   string = cli.String("root")
 		msgBrokerCon string = cli.String("broker")
 		workerNr     uint   = cli.Uint("workers")
 	)
 
+	if err := proxy.Setup(); err != nil {
+		return fmt.Errorf("failed to set up proxy: %w", err)
+	}
+
 	server, err := zbus.NewRedisServer(module, msgBrokerCon, workerNr)
 	if err != nil {
 		return fmt.Errorf("fail to connect to message broker server: %w", err)
@@ -73,140 +90,142 @@ func action(cli *cli.Context) error {
 	}
 
 	router := peer.NewRouter()
-	gw, err := substrategw.NewSubstrateGateway(manager, id)
+	// the pool routes each call to the healthiest substrate endpoint
+	pool := substratepool.New(id, subURLs...)
+	cache := substratepool.NewCache(pool)
+	// all extrinsics signed by the node go through the queue
+	gw, err := substratepool.NewQueue(filepath.Join(moduleRoot, "extrinsics"), cache, pool)
 	if err != nil {
-		return fmt.Errorf("failed to create api gateway: %w", err)
+		return fmt.Errorf("failed to create extrinsic queue: %w", err)
 	}
 
 	server.Register(zbus.ObjectID{Name: "api-gateway", Version: "0.0.1"}, gw)
+	server.Register(zbus.ObjectID{Name: "substrate-health", Version: "0.0.1"}, pool)
+	server.Register(zbus.ObjectID{Name: "chain-reader", Version: "0.0.1"}, pool)
+	server.Register(zbus.ObjectID{Name: "extrinsics", Version: "0.0.1"}, gw)
+
+	pair, err := id.KeyPair()
+	if err != nil {
+		return err
+	}
 
 	ctx, _ := utils.WithSignal(context.Background())
 	utils.OnDone(ctx, func(_ error) {
 		log.Info().Msg("shutting down")
 	})
 
+	// the tracer must be the only root middleware, other middlewares
+	// are added to the tracer
+	tracer := rmbtrace.New(256)
+	router.Use(tracer.Middleware)
+	server.Register(zbus.ObjectID{Name: "rmb-tracer", Version: "0.0.1"}, tracer)
+
+	peers := newPeerManager(ctx, hex.EncodeToString(pair.Seed()), tracer.Trace(router.Serve), encoder.NewJSONEncoder(), pool, relayURLs, subURLs)
+	server.Register(zbus.ObjectID{Name: "rmb-peer", Version: "0.0.1"}, peers)
+
+	consumer, err := events.NewConsumer(msgBrokerCon, module)
+	if err != nil {
+		return fmt.Errorf("failed to create event consumer: %w", err)
+	}
+
+	go pool.Run(ctx)
+	go gw.Run(ctx)
 	go func() {
 		for {
-			if err := server.Run(ctx); err != nil && err != context.Canceled {
-				log.Error().Err(err).Msg("unexpected error")
-				continue
+			err := cache.Listen(ctx, consumer)
+			if err == nil {
+				return
 			}
 
-			break
+			log.Error().Err(err).Msg("failed to listen to chain events for cache invalidation")
+			<-time.After(10 * time.Second)
 		}
 	}()
 
+	go serve(ctx, server)
+
 	api, err := zosapi.NewZosAPI(manager, redis, msgBrokerCon)
 	if err != nil {
 		return fmt.Errorf("failed to create zos api: %w", err)
 	}
 	api.SetupRoutes(router)
+	tracer.Route(zosAPICommands...)
+	newNodeAPI(redis, tracer).SetupRoutes(router)
 
-	pair, err := id.KeyPair()
-	if err != nil {
-		return err
-	}
-
-	bo := backoff.NewExponentialBackOff()
-	bo.MaxElapsedTime = 0
-
-	// this ctx is used to allow the node to restart the peer without leaving any unwanted open connections
-	currentPeerCtx, cancel := context.WithCancel(ctx)
-	backoff.Retry(func() error {
-		_, err = peer.NewPeer(
-			currentPeerCtx,
-			hex.EncodeToString(pair.Seed()),
-			manager,
-			router.Serve,
-			peer.WithKeyType(peer.KeyTypeEd25519),
-			peer.WithRelay(relayURLs...),
-			peer.WithInMemoryExpiration(6*60*60), // 6 hours
-		)
-		if err != nil {
-			if cancel != nil {
-				cancel()
-			}
-			return fmt.Errorf("failed to start a new rmb peer: %w", err)
-		}
-
-		return nil
-	}, bo)
+	policy := rmbpolicy.NewEngine(rmbpolicy.DefaultPolicy(), func() (rmbpolicy.Callers, error) {
+		return resolveCallers(gw, id.PublicKey(), uint32(env.FarmID))
+	})
+	tracer.Use(policy.Middleware)
+	go policy.Watch(ctx)
 
 	log.Info().
 		Str("broker", msgBrokerCon).
 		Uint("worker nr", workerNr).
 		Msg("starting api-gateway module")
 
+	if err := peers.Start(manager); err != nil {
+		// only fails if context is cancelled
+		return nil
+	}
+
 	// block forever
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
-			// check if we need to run an update on the peer and only do the update if all the changes are done successfully
 		case <-time.After(10 * time.Minute):
-			env, err := environment.Get()
-			if err != nil {
-				// skip update if we can't get env
-				log.Debug().Err(err).Msg("failed to load node environment")
-				continue
+			// the peer is only replaced if zos-config has new urls, a reload
+			// can also be requested over zbus
+			if err := peers.reloadWait(false); err != nil {
+				log.Error().Err(err).Msg("failed to reload rmb peer")
 			}
+		}
+	}
+}
 
-			updatedSubURLs := env.SubstrateURL
-			updatedRelayURLs := env.RelaysURLs
+// serve runs server until context is cancelled
+func serve(ctx context.Context, server zbus.Server) {
+	for {
+		if err := server.Run(ctx); err != nil && err != context.Canceled {
+			log.Error().Err(err).Msg("unexpected error")
+			continue
+		}
 
-			// make sure urls are sorted for comparison
-			slices.Sort(subURLs)
-			slices.Sort(relayURLs)
-			slices.Sort(updatedSubURLs)
-			slices.Sort(updatedRelayURLs)
+		break
+	}
+}
 
-			// skip update if substrate and relay urls did not change
-			if slices.Equal(subURLs, updatedSubURLs) && slices.Equal(relayURLs, updatedRelayURLs) {
-				log.Debug().Msg("zos-config doesn't have updated config to update the node with")
-				continue
-			}
+// resolveCallers gets the twins of the node roles from the chain
+func resolveCallers(gw pkg.SubstrateGateway, pk []byte, farmID uint32) (rmbpolicy.Callers, error) {
+	twin, subErr := gw.GetTwinByPubKey(pk)
+	if subErr.IsError() {
+		return rmbpolicy.Callers{}, fmt.Errorf("failed to get node twin: %w", subErr.Err)
+	}
 
-			log.Debug().Strs("relays_urls", updatedRelayURLs).Strs("substrate_urls", updatedSubURLs).Msg("detected new update in configuration")
+	farm, err := gw.GetFarm(farmID)
+	if err != nil {
+		return rmbpolicy.Callers{}, fmt.Errorf("failed to get farm: %w", err)
+	}
 
-			manager, err = environment.GetSubstrate()
-			if err != nil {
-				// skip update if can't get sub manager
-				log.Debug().Err(err).Msg("failed to get substrate manager")
-				continue
-			}
-			// cancel the current peer to create new one with updated urls
-			if cancel != nil {
-				log.Debug().Msg("cancelling current peer context to create a new one with updated urls")
-				cancel()
-			}
+	callers := rmbpolicy.Callers{Node: twin, Farmer: uint32(farm.TwinID)}
 
-			currentPeerCtx, cancel = context.WithCancel(ctx)
-			backoff.Retry(func() error {
-				_, err = peer.NewPeer(
-					currentPeerCtx,
-					hex.EncodeToString(pair.Seed()),
-					manager,
-					router.Serve,
-					peer.WithKeyType(peer.KeyTypeEd25519),
-					peer.WithRelay(updatedRelayURLs...),
-					peer.WithInMemoryExpiration(6*60), // 1 hours
-				)
-				if err != nil {
-					if cancel != nil {
-
-						// cancel the context to avoid any unwanted open connections
-						cancel()
-					}
-					return fmt.Errorf("failed to start a new rmb peer: %w", err)
-
-				}
-				return nil
-			}, bo)
-
-			relayURLs = updatedRelayURLs
-			subURLs = updatedSubURLs
-
-			log.Debug().Strs("relays_urls", relayURLs).Strs("substrate_urls", subURLs).Msg("updated substrate and relay urls")
-		}
+	node, subErr := gw.GetNodeByTwinID(twin)
+	if subErr.IsError() {
+		return rmbpolicy.Callers{}, fmt.Errorf("failed to get node: %w", subErr.Err)
 	}
+
+	rent, subErr := gw.GetNodeRentContract(node)
+	if subErr.IsCode(pkg.CodeNotFound) {
+		return callers, nil
+	} else if subErr.IsError() {
+		return rmbpolicy.Callers{}, fmt.Errorf("failed to get node rent contract: %w", subErr.Err)
+	}
+
+	contract, subErr := gw.GetContract(rent)
+	if subErr.IsError() {
+		return rmbpolicy.Callers{}, fmt.Errorf("failed to get rent contract: %w", subErr.Err)
+	}
+
+	callers.Renter = uint32(contract.TwinID)
+	return callers, nil
 }
@@ -0,0 +1,342 @@
+package apigateway
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	"github.com/threefoldtech/tfgrid-sdk-go/rmb-sdk-go/peer"
+	"github.com/threefoldtech/tfgrid-sdk-go/rmb-sdk-go/peer/encoder"
+	"github.com/threefoldtech/tfgrid-sdk-go/rmb-sdk-go/peer/types"
+	zos "github.com/threefoldtech/zos/pkg"
+	"github.com/threefoldtech/zos/pkg/substratepool"
+	"github.com/threefoldtech/zosbase/pkg/environment"
+)
+
+const (
+	// peerCacheExpiration is the ttl in seconds of the peer twin cache
+	peerCacheExpiration = 6 * 60 * 60 // 6 hours
+	// drainTimeout is the max time a replaced peer is kept to answer
+	// its pending requests
+	drainTimeout = 5 * time.Minute
+	// drainGrace is the time a replaced peer is kept after its last response
+	// so the response has time to be sent
+	drainGrace = 5 * time.Second
+)
+
+var _ zos.RMBPeer = (*peerManager)(nil)
+
+// peerInstance is a running rmb peer. The router doesn't tell when a request
+// is handled, so requests are counted when received, and responses are counted
+// when encoded by the peer.
+type peerInstance struct {
+	peer    *peer.Peer
+	cancel  context.CancelFunc
+	started time.Time
+
+	requests  atomic.Int64
+	responses atomic.Int64
+
+	m        sync.Mutex
+	deadline time.Time
+	last     time.Time
+}
+
+func (i *peerInstance) handler(next peer.Handler) peer.Handler {
+	return func(ctx context.Context, p *peer.Peer, env *types.Envelope, err error) {
+		if err == nil && env.GetRequest() != nil {
+			i.requests.Add(1)
+			expires := time.Unix(int64(env.Timestamp+env.Expiration), 0)
+
+			i.m.Lock()
+			if expires.After(i.deadline) {
+				i.deadline = expires
+			}
+			i.m.Unlock()
+		}
+
+		next(ctx, p, env, err)
+	}
+}
+
+// idle checks if all requests received by the peer are answered, or expired
+func (i *peerInstance) idle() bool {
+	i.m.Lock()
+	defer i.m.Unlock()
+
+	if time.Now().After(i.deadline) {
+		return true
+	}
+
+	return i.responses.Load() >= i.requests.Load() && time.Since(i.last) > drainGrace
+}
+
+// countingEncoder counts the responses encoded by a peer
+type countingEncoder struct {
+	encoder.Encoder
+	instance *peerInstance
+}
+
+func (e countingEncoder) Encode(v interface{}) ([]byte, error) {
+	e.instance.m.Lock()
+	e.instance.last = time.Now()
+	e.instance.m.Unlock()
+
+	e.instance.responses.Add(1)
+	return e.Encoder.Encode(v)
+}
+
+// peerManager runs the node rmb peer and replaces it when the relay or
+// substrate urls change. The new peer is connected before the old one
+// is drained and closed so no in flight request is lost.
+type peerManager struct {
+	ctx     context.Context
+	seed    string
+	handler peer.Handler
+	encoder encoder.Encoder
+	pool    *substratepool.Pool
+
+	// reload serializes reloads
+	reload sync.Mutex
+
+	m         sync.Mutex
+	current   *peerInstance
+	relays    []string
+	substrate []string
+	reloads   uint64
+	reloading bool
+	draining  int
+	lastError string
+}
+
+func newPeerManager(ctx context.Context, seed string, handler peer.Handler, enc encoder.Encoder, pool *substratepool.Pool, relays, substrate []string) *peerManager {
+	return &peerManager{
+		ctx:       ctx,
+		seed:      seed,
+		handler:   handler,
+		encoder:   enc,
+		pool:      pool,
+		relays:    sorted(relays),
+		substrate: sorted(substrate),
+	}
+}
+
+func sorted(urls []string) []string {
+	urls = slices.Clone(urls)
+	slices.Sort(urls)
+	return urls
+}
+
+// Start starts the first peer, it blocks until the peer is started or
+// context is cancelled
+func (m *peerManager) Start(manager substrate.Manager) error {
+	m.reload.Lock()
+	defer m.reload.Unlock()
+
+	for {
+		instance, err := m.start(manager, m.relays)
+		if err == nil {
+			m.m.Lock()
+			m.current = instance
+			m.m.Unlock()
+			return nil
+		}
+
+		m.setError(err)
+		log.Error().Err(err).Msg("failed to start rmb peer")
+
+		select {
+		case <-m.ctx.Done():
+			return m.ctx.Err()
+		case <-time.After(10 * time.Second):
+		}
+	}
+}
+
+func (m *peerManager) start(manager substrate.Manager, relays []string) (*peerInstance, error) {
+	ctx, cancel := context.WithCancel(m.ctx)
+	instance := &peerInstance{cancel: cancel, started: time.Now()}
+
+	p, err := peer.NewPeer(
+		ctx,
+		m.seed,
+		manager,
+		instance.handler(m.handler),
+		peer.WithKeyType(peer.KeyTypeEd25519),
+		peer.WithRelay(relays...),
+		peer.WithInMemoryExpiration(peerCacheExpiration),
+		peer.WithEncoder(countingEncoder{Encoder: m.encoder, instance: instance}),
+		peer.WithRequireFunctionalRelayOnStartup(true),
+	)
+	if err != nil {
+		// cancel the context to avoid any unwanted open connections
+		cancel()
+		return nil, fmt.Errorf("failed to start a new rmb peer: %w", err)
+	}
+
+	instance.peer = p
+	return instance, nil
+}
+
+// Reload implements zos.RMBPeer. The new peer is connected in the background
+// so the caller is not held while it connects, the result is in the status.
+func (m *peerManager) Reload(force bool) error {
+	if !m.reload.TryLock() {
+		return fmt.Errorf("rmb peer reload already in progress")
+	}
+
+	m.setReloading(true)
+	go func() {
+		defer m.reload.Unlock()
+		defer m.setReloading(false)
+
+		if err := m.refresh(force); err != nil {
+			log.Error().Err(err).Msg("failed to reload rmb peer")
+		}
+	}()
+
+	return nil
+}
+
+// reloadWait reloads the peer and waits for the new peer to be connected
+func (m *peerManager) reloadWait(force bool) error {
+	m.reload.Lock()
+	defer m.reload.Unlock()
+
+	return m.refresh(force)
+}
+
+// refresh reloads the peer, must be called with m.reload held
+func (m *peerManager) refresh(force bool) error {
+	err := m.swap(force)
+	m.setError(err)
+	return err
+}
+
+func (m *peerManager) swap(force bool) error {
+	env, err := environment.Get()
+	if err != nil {
+		return fmt.Errorf("failed to load node environment: %w", err)
+	}
+
+	relays := sorted(env.RelaysURLs)
+	subURLs := sorted(env.SubstrateURL)
+
+	m.m.Lock()
+	unchanged := slices.Equal(m.relays, relays) && slices.Equal(m.substrate, subURLs)
+	m.m.Unlock()
+
+	// skip update if substrate and relay urls did not change
+	if !force && unchanged {
+		log.Debug().Msg("zos-config doesn't have updated config to update the node with")
+		return nil
+	}
+
+	log.Info().Strs("relays_urls", relays).Strs("substrate_urls", subURLs).Msg("reloading rmb peer")
+
+	m.pool.Update(subURLs)
+
+	manager, err := environment.GetSubstrate()
+	if err != nil {
+		return fmt.Errorf("failed to get substrate manager: %w", err)
+	}
+
+	// the new peer must be up before the current one is replaced
+	instance, err := m.start(manager, relays)
+	if err != nil {
+		return err
+	}
+
+	m.m.Lock()
+	old := m.current
+	m.current = instance
+	m.relays = relays
+	m.substrate = subURLs
+	m.reloads++
+	m.m.Unlock()
+
+	if old != nil {
+		go m.drain(old)
+	}
+
+	return nil
+}
+
+// drain closes the peer once it has answered all its requests
+func (m *peerManager) drain(instance *peerInstance) {
+	m.m.Lock()
+	m.draining++
+	m.m.Unlock()
+
+	defer func() {
+		m.m.Lock()
+		m.draining--
+		m.m.Unlock()
+	}()
+
+	timeout := time.After(drainTimeout)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+loop:
+	for !instance.idle() {
+		select {
+		case <-m.ctx.Done():
+			break loop
+		case <-timeout:
+			log.Warn().
+				Int64("requests", instance.requests.Load()).
+				Int64("responses", instance.responses.Load()).
+				Msg("closing old rmb peer with pending requests")
+			break loop
+		case <-ticker.C:
+		}
+	}
+
+	instance.cancel()
+	instance.peer.Wait()
+	log.Info().Msg("old rmb peer closed")
+}
+
+func (m *peerManager) setReloading(reloading bool) {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	m.reloading = reloading
+}
+
+func (m *peerManager) setError(err error) {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	m.lastError = ""
+	if err != nil {
+		m.lastError = err.Error()
+	}
+}
+
+// Status implements zos.RMBPeer
+func (m *peerManager) Status() zos.RMBPeerStatus {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	status := zos.RMBPeerStatus{
+		Relays:    m.relays,
+		Substrate: m.substrate,
+		Reloads:   m.reloads,
+		Reloading: m.reloading,
+		Draining:  m.draining,
+		LastError: m.lastError,
+	}
+
+	if m.current != nil {
+		status.Started = m.current.started
+	}
+
+	return status
+}
@@ -0,0 +1,43 @@
+package apigateway
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/threefoldtech/tfgrid-sdk-go/rmb-sdk-go/peer"
+	"github.com/threefoldtech/tfgrid-sdk-go/rmb-sdk-go/peer/encoder"
+	"github.com/threefoldtech/tfgrid-sdk-go/rmb-sdk-go/peer/types"
+)
+
+func TestPeerInstanceIdle(t *testing.T) {
+	var instance peerInstance
+	if !instance.idle() {
+		t.Fatal("peer without requests must be idle")
+	}
+
+	handler := instance.handler(func(context.Context, *peer.Peer, *types.Envelope, error) {})
+	handler(context.Background(), nil, &types.Envelope{
+		Timestamp:  uint64(time.Now().Unix()),
+		Expiration: 60,
+		Message:    &types.Envelope_Request{Request: &types.Request{Command: "zos.system.version"}},
+	}, nil)
+
+	if instance.idle() {
+		t.Fatal("peer with a pending request must not be idle")
+	}
+
+	enc := countingEncoder{Encoder: encoder.NewJSONEncoder(), instance: &instance}
+	if _, err := enc.Encode("ok"); err != nil {
+		t.Fatal(err)
+	}
+
+	if instance.idle() {
+		t.Fatal("peer must wait for the response to be sent")
+	}
+
+	instance.last = time.Now().Add(-drainGrace - time.Second)
+	if !instance.idle() {
+		t.Fatal("peer with all requests answered must be idle")
+	}
+}
@@ -0,0 +1,91 @@
+package apigateway
+
+import (
+	"context"
+
+	"github.com/threefoldtech/tfgrid-sdk-go/rmb-sdk-go/peer"
+	"github.com/threefoldtech/zbus"
+	"github.com/threefoldtech/zos/pkg/rmbtrace"
+	"github.com/threefoldtech/zos/pkg/stubs"
+)
+
+// zosAPICommands are the commands of the zos api. The zos api registers its
+// own handlers so they can't be traced, the calls to these commands are
+// counted as dispatched. Commands missing here are counted as unknown.
+var zosAPICommands = []string{
+	"zos.system.version",
+	"zos.system.dmi",
+	"zos.system.hypervisor",
+	"zos.system.diagnostics",
+	"zos.system.node_features_get",
+	"zos.perf.get",
+	"zos.perf.get_all",
+	"zos.gpu.list",
+	"zos.storage.pools",
+	"zos.network.list_wg_ports",
+	"zos.network.public_config_get",
+	"zos.network.interfaces",
+	"zos.network.has_ipv6",
+	"zos.network.list_public_ips",
+	"zos.network.list_private_ips",
+	"zos.admin.interfaces",
+	"zos.admin.reboot",
+	"zos.admin.restart",
+	"zos.admin.restart_all",
+	"zos.admin.show_logs",
+	"zos.admin.show_resolve",
+	"zos.admin.show_open_connections",
+	"zos.admin.stop_workload",
+	"zos.admin.resume_workload",
+	"zos.admin.set_public_nic",
+	"zos.admin.get_public_nic",
+	"zos.location.get",
+	"zos.statistics.get",
+	"zos.deployment.deploy",
+	"zos.deployment.update",
+	"zos.deployment.get",
+	"zos.deployment.list",
+	"zos.deployment.changes",
+	"zos.vm.logs",
+}
+
+// nodeAPI exposes over rmb the node functionality that is
+// not covered by the zos api
+type nodeAPI struct {
+	inventory  *stubs.HardwareInventoryStub
+	diskHealth *stubs.DiskHealthMonitorStub
+	wol        *stubs.WakeOnLanStub
+	tracer     *rmbtrace.Tracer
+}
+
+func newNodeAPI(cl zbus.Client, tracer *rmbtrace.Tracer) *nodeAPI {
+	return &nodeAPI{
+		inventory:  stubs.NewHardwareInventoryStub(cl),
+		diskHealth: stubs.NewDiskHealthMonitorStub(cl),
+		wol:        stubs.NewWakeOnLanStub(cl),
+		tracer:     tracer,
+	}
+}
+
+func (n *nodeAPI) SetupRoutes(router *peer.Router) {
+	root := router.SubRoute("zos")
+
+	system := root.SubRoute("system")
+	system.WithHandler("inventory", n.tracer.Handler("zos.system.inventory", n.systemInventoryHandler))
+	system.WithHandler("disk_health", n.tracer.Handler("zos.system.disk_health", n.systemDiskHealthHandler))
+
+	power := root.SubRoute("power")
+	power.WithHandler("wol", n.tracer.Handler("zos.power.wol", n.powerWolHandler))
+}
+
+func (n *nodeAPI) systemInventoryHandler(ctx context.Context, payload []byte) (interface{}, error) {
+	return n.inventory.Get(ctx)
+}
+
+func (n *nodeAPI) systemDiskHealthHandler(ctx context.Context, payload []byte) (interface{}, error) {
+	return n.diskHealth.Health(ctx), nil
+}
+
+func (n *nodeAPI) powerWolHandler(ctx context.Context, payload []byte) (interface{}, error) {
+	return n.wol.Status(ctx), nil
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/threefoldtech/zos/pkg/proxy"
 	"github.com/threefoldtech/zosbase/pkg/stubs"
 	"github.com/threefoldtech/zosbase/pkg/utils"
 	"github.com/urfave/cli/v2"
@@ -53,6 +54,11 @@ func action(cli *cli.Context) error {
 		workerNr     uint   = cli.Uint("workers")
 	)
 
+	// flists are downloaded from the hub through the proxy if any
+	if err := proxy.Setup(); err != nil {
+		return errors.Wrap(err, "failed to set up proxy")
+	}
+
 	redis, err := zbus.NewRedisClient(msgBrokerCon)
 	if err != nil {
 		return errors.Wrap(err, "fail to connect to message broker server")
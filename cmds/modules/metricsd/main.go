@@ -0,0 +1,87 @@
+package metricsd
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/zbus"
+	"github.com/threefoldtech/zos/pkg/metrics"
+	"github.com/threefoldtech/zosbase/pkg/kernel"
+	"github.com/threefoldtech/zosbase/pkg/utils"
+	"github.com/urfave/cli/v2"
+)
+
+// Module is entry point for module
+var Module cli.Command = cli.Command{
+	Name:  "metricsd",
+	Usage: "exposes node and workloads metrics in openmetrics format",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "broker",
+			Usage: "connection string to the message `BROKER`",
+			Value: "unix:///var/run/redis.sock",
+		},
+		&cli.UintFlag{
+			Name:  "port",
+			Usage: "listen on `PORT`",
+			Value: 9100,
+		},
+		&cli.StringFlag{
+			Name:  "queues",
+			Usage: "`DIR` of the provision engine queues",
+			Value: "/var/cache/modules/provisiond/queues",
+		},
+	},
+	Action: action,
+}
+
+func action(cli *cli.Context) error {
+	var (
+		msgBrokerCon string = cli.String("broker")
+		port         uint   = cli.Uint("port")
+		queues       string = cli.String("queues")
+	)
+
+	ctx, _ := utils.WithSignal(context.Background())
+	utils.OnDone(ctx, func(_ error) {
+		log.Info().Msg("shutting down")
+	})
+
+	cfg, enabled, err := metrics.ConfigFromKernel(kernel.GetParams())
+	if err != nil {
+		return errors.Wrap(err, "invalid metrics configuration")
+	}
+
+	if !enabled {
+		log.Info().Msg("metrics exporter is not enabled")
+		// block forever so zinit does not restart us
+		<-ctx.Done()
+		return nil
+	}
+
+	cl, err := zbus.NewRedisClient(msgBrokerCon)
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to message broker server")
+	}
+
+	host := metrics.NewHostSource(cl)
+	host.Run(ctx)
+
+	exporter := metrics.NewExporter(cfg.Allowed)
+	exporter.Register("host", host)
+	exporter.Register("vms", metrics.VMSource(cl))
+	exporter.Register("networks", metrics.NetworkSource(cl))
+	exporter.Register("gateways", metrics.GatewaySource(cl))
+	exporter.Register("provision", metrics.NewQueueSource(queues))
+	exporter.Register("public-drift", metrics.PublicDriftSource(cl))
+	exporter.Register("rmb", metrics.RMBSource(cl))
+
+	log.Info().
+		Uint("port", port).
+		Interface("targets", cfg.Targets).
+		Msg("starting metrics exporter")
+
+	metrics.Serve(ctx, exporter, uint16(port), cfg.Targets...)
+	return nil
+}
@@ -0,0 +1,127 @@
+package networkd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/zos/pkg/hostfw"
+	"github.com/threefoldtech/zosbase/pkg/environment"
+	"github.com/threefoldtech/zosbase/pkg/kernel"
+)
+
+// isolateLAN keeps the ndmz lan isolation rules up to date until the
+// context is cancelled. The config and the lan gateway and dns servers
+// are checked every 10 minutes. The last farm config is kept if it can't
+// be loaded.
+func isolateLAN(ctx context.Context, namespace string, env environment.Environment) {
+	var (
+		farm    hostfw.LANIsolation
+		version string
+	)
+
+	for {
+		if cfg, err := hostfw.LoadLANIsolation(uint32(env.FarmID)); err != nil {
+			log.Error().Err(err).Msg("failed to load farm lan isolation config")
+		} else {
+			farm = cfg
+		}
+
+		ruleset, err := lanRuleset(ctx, namespace, farm)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to build lan isolation rules")
+		} else if ruleset.Version() != version {
+			if err := hostfw.Apply(ctx, namespace, ruleset); err != nil {
+				log.Error().Err(err).Msg("failed to apply lan isolation rules")
+			} else {
+				version = ruleset.Version()
+				log.Info().Str("version", version).Msg("lan isolation rules applied")
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(10 * time.Minute):
+		}
+	}
+}
+
+func lanRuleset(ctx context.Context, namespace string, farm hostfw.LANIsolation) (hostfw.Ruleset, error) {
+	node, err := hostfw.LANIsolationFromKernel(kernel.GetParams())
+	if err != nil {
+		return hostfw.Ruleset{}, err
+	}
+
+	cfg := farm.Merge(node)
+	if !cfg.Enabled {
+		return hostfw.LANRuleset(cfg, "", nil), nil
+	}
+
+	gateway, err := lanGateway(ctx, namespace)
+	if err != nil {
+		return hostfw.Ruleset{}, err
+	}
+
+	dns, err := lanDNS("/etc/resolv.conf")
+	if err != nil {
+		return hostfw.Ruleset{}, err
+	}
+
+	return hostfw.LANRuleset(cfg, gateway, dns), nil
+}
+
+// lanGateway returns the ipv4 default gateway of the namespace
+func lanGateway(ctx context.Context, namespace string) (string, error) {
+	output, err := exec.CommandContext(ctx, "ip", "-n", namespace, "-j", "-4", "route", "show", "default").Output()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get default route")
+	}
+
+	var routes []struct {
+		Gateway string `json:"gateway"`
+	}
+
+	if err := json.Unmarshal(output, &routes); err != nil {
+		return "", errors.Wrap(err, "failed to parse default route")
+	}
+
+	for _, route := range routes {
+		if len(route.Gateway) != 0 {
+			return route.Gateway, nil
+		}
+	}
+
+	return "", nil
+}
+
+// lanDNS returns the ipv4 name servers of the node
+func lanDNS(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open resolv.conf")
+	}
+	defer file.Close()
+
+	var servers []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "nameserver" {
+			continue
+		}
+
+		if ip := net.ParseIP(fields[1]); ip != nil && ip.To4() != nil {
+			servers = append(servers, fields[1])
+		}
+	}
+
+	return servers, scanner.Err()
+}
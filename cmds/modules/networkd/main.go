@@ -5,10 +5,18 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
+	zos "github.com/threefoldtech/zos/pkg"
+	"github.com/threefoldtech/zos/pkg/netgc"
+	"github.com/threefoldtech/zos/pkg/overlaypeers"
+	"github.com/threefoldtech/zos/pkg/proxy"
+	"github.com/threefoldtech/zos/pkg/publicdrift"
 	"github.com/threefoldtech/zosbase/pkg/environment"
+	"github.com/threefoldtech/zosbase/pkg/kernel"
 	"github.com/threefoldtech/zosbase/pkg/network/dhcp"
 	"github.com/threefoldtech/zosbase/pkg/network/mycelium"
 	"github.com/threefoldtech/zosbase/pkg/network/public"
@@ -31,6 +39,10 @@ import (
 const (
 	redisSocket = "unix:///var/run/redis.sock"
 	module      = "network"
+	// networksDir is where the networker stores the network resources
+	networksDir = "/var/run/cache/networkd/networks"
+	// vmsDir is where vmd stores the vms configs
+	vmsDir = "/var/run/cache/vmd"
 )
 
 // Module is entry point for module
@@ -62,18 +74,41 @@ func action(cli *cli.Context) error {
 		return errors.Wrap(err, "fail to create module root")
 	}
 
-	waitYggdrasilBin()
+	// zos-config (firewall and lan isolation policies) is fetched through the
+	// proxy if any
+	if err := proxy.Setup(); err != nil {
+		return errors.Wrap(err, "failed to set up proxy")
+	}
 
-	if err := migrateOlderDHCPService(); err != nil {
-		return errors.Wrap(err, "failed to migrate older dhcp service")
+	static, err := ndmzStaticFromKernel(kernel.GetParams())
+	if err != nil {
+		return errors.Wrap(err, "invalid ndmz kernel params")
 	}
 
-	// NOTE: all cleanup are done, future deprovisioning will not need to do this
-	// if err := network.CleanupUnusedLinks(); err != nil {
-	// 	return errors.Wrap(err, "failed to cleanupUnusedLinks")
-	// }
+	// a failing overlay is disabled and reported to zui instead of
+	// failing networkd
+	var overlayErrors []string
+	overlays, err := overlaysFromKernel(kernel.GetParams())
+	if err != nil {
+		log.Error().Err(err).Msg("invalid overlays kernel param, using the default overlays")
+		overlayErrors = append(overlayErrors, fmt.Sprintf("invalid %s kernel param, using the default overlays: %s", paramOverlays, err))
+	}
 
-	// network.CleanupOrphanedNamespaces()
+	// yggdrasil can't be added to a running networker, networkd is restarted
+	// once its binary is available
+	missingYgg := false
+	if overlays[zos.OverlayYggdrasil] {
+		if err := waitYggdrasilBin(context.Background(), 2*time.Minute); err != nil {
+			log.Error().Err(err).Msg("yggdrasil binary is not available")
+			overlayErrors = append(overlayErrors, "yggdrasil: binary is not available yet, it's started once it is")
+			overlays[zos.OverlayYggdrasil] = false
+			missingYgg = true
+		}
+	}
+
+	if err := migrateOlderDHCPService(); err != nil {
+		return errors.Wrap(err, "failed to migrate older dhcp service")
+	}
 
 	if err := bootstrap.DefaultBridgeValid(); err != nil {
 		return errors.Wrap(err, "invalid setup")
@@ -95,10 +130,26 @@ func action(cli *cli.Context) error {
 		log.Info().Msg("shutting down")
 	})
 
-	if err := ensureHostFw(ctx); err != nil {
+	var restart atomic.Bool
+	if missingYgg {
+		go func() {
+			if err := waitYggdrasilBin(ctx, 0); err != nil {
+				return
+			}
+
+			log.Info().Msg("yggdrasil binary is available, restarting networkd to start it")
+			restart.Store(true)
+			cancel()
+		}()
+	}
+
+	fw, err := ensureHostFw(ctx, root)
+	if err != nil {
 		return errors.Wrap(err, "failed to host firewall rules")
 	}
 
+	go fw.Watch(ctx)
+
 	public.SetPersistence(root)
 
 	pub, err := public.LoadPublicConfig()
@@ -115,51 +166,113 @@ func action(cli *cli.Context) error {
 
 	dmz := ndmz.New(nodeID.Identity(), master)
 
-	if err := dmz.Create(ctx); err != nil {
+	// the ndmz dhcp monitor runs until the create context is cancelled, it
+	// must not restart the dhcp client of a static ndmz
+	dmzCtx, dmzCancel := context.WithCancel(ctx)
+	defer dmzCancel()
+
+	if err := dmz.Create(dmzCtx); err != nil {
 		return errors.Wrap(err, "failed to create ndmz")
 	}
 
+	if static != nil {
+		dmzCancel()
+		log.Info().Str("address", static.Address.String()).Msg("setting static address of ndmz")
+		if err := configureNDMZ(ctx, static); err != nil {
+			return errors.Wrap(err, "failed to configure ndmz static address")
+		}
+	} else if kernel.GetParams().Exists(paramIPv6Only) {
+		// there is no dhcpv4 server to reach, ndmz only gets its ipv6
+		// address over slaac
+		dmzCancel()
+		log.Info().Msg("ipv6 only node, stopping ndmz dhcp client")
+		stopNDMZDHCP()
+	}
+
 	namespace := dmz.Namespace()
 	if public.HasPublicSetup() {
 		namespace = public.PublicNamespace
 	}
 
-	log.Debug().Msg("starting yggdrasil")
-	ygg, err := setupYgg(ctx, namespace, dmz.Namespace(), identity.PrivateKey(cli.Context))
-	if err != nil {
-		return err
+	var ygg *yggdrasil.YggServer
+	if overlays[zos.OverlayYggdrasil] {
+		log.Debug().Msg("starting yggdrasil")
+		ygg, err = setupYgg(ctx, namespace, dmz.Namespace(), identity.PrivateKey(cli.Context))
+		if err != nil {
+			log.Error().Err(err).Msg("failed to setup yggdrasil")
+			overlayErrors = append(overlayErrors, fmt.Sprintf("yggdrasil: %s", err))
+			overlays[zos.OverlayYggdrasil] = false
+			ygg = nil
+		}
+	}
+
+	var myc *mycelium.MyceliumServer
+	if overlays[zos.OverlayMycelium] {
+		log.Debug().Msg("starting mycelium")
+		myc, err = setupMycelium(ctx, namespace, dmz.Namespace(), identity.PrivateKey(cli.Context))
+		if err != nil {
+			log.Error().Err(err).Msg("failed to setup mycelium")
+			overlayErrors = append(overlayErrors, fmt.Sprintf("mycelium: %s", err))
+			overlays[zos.OverlayMycelium] = false
+			myc = nil
+		}
 	}
 
-	log.Debug().Msg("starting mycelium")
-	mycelium, err := setupMycelium(ctx, namespace, dmz.Namespace(), identity.PrivateKey(cli.Context))
+	reportOverlays(ctx, client, overlayErrors)
+
+	var running []string
+	for overlay, enabled := range overlays {
+		if enabled {
+			running = append(running, overlay)
+		}
+	}
+
+	peers, err := overlaypeers.NewManager(filepath.Join(root, "overlay-peers.json"), namespace, running...)
 	if err != nil {
-		return err
+		return errors.Wrap(err, "failed to create overlay peers manager")
 	}
+	go peers.Run(ctx, time.Minute)
 
-	networker, err := network.NewNetworker(identity, dmz, ygg, mycelium)
+	// the networker reports planetary and mycelium as not supported
+	// if their server is nil
+	networker, err := network.NewNetworker(identity, dmz, ygg, myc)
 	if err != nil {
 		return errors.Wrap(err, "error creating network manager")
 	}
 
-	// if err := nft.DropTrafficToLAN(dmz.Namespace()); err != nil {
-	// 	return errors.Wrap(err, "failed to drop traffic to lan")
-	// }
+	go isolateLAN(ctx, dmz.Namespace(), environment.MustGet())
+
+	drift := publicdrift.NewMonitor(client, 5*time.Minute)
+	go drift.Run(ctx)
+
+	// leaked network resources objects are removed after they stay
+	// unreferenced for an hour
+	gc := netgc.NewCollector(networksDir, vmsDir, time.Hour)
+	go gc.Run(ctx, 10*time.Minute)
 
 	log.Info().Msg("start zbus server")
-	if err := startZBusServer(ctx, broker, networker); err != nil {
+	if err := startZBusServer(ctx, broker, networker, drift, gc, peers); err != nil {
 		return errors.Wrap(err, "unexpected error")
 	}
 
+	if restart.Load() {
+		// zinit starts networkd again
+		return fmt.Errorf("restarting to start yggdrasil")
+	}
+
 	return nil
 }
 
-func startZBusServer(ctx context.Context, broker string, networker pkg.Networker) error {
+func startZBusServer(ctx context.Context, broker string, networker pkg.Networker, drift *publicdrift.Monitor, gc *netgc.Collector, peers *overlaypeers.Manager) error {
 	server, err := zbus.NewRedisServer(module, broker, 1)
 	if err != nil {
 		log.Error().Err(err).Msgf("fail to connect to message broker server")
 	}
 
 	server.Register(zbus.ObjectID{Name: module, Version: "0.0.1"}, networker)
+	server.Register(zbus.ObjectID{Name: "public-drift", Version: "0.0.1"}, drift)
+	server.Register(zbus.ObjectID{Name: "network-gc", Version: "0.0.1"}, gc)
+	server.Register(zbus.ObjectID{Name: "overlay-peers", Version: "0.0.1"}, peers)
 
 	log.Info().
 		Str("broker", broker).
@@ -173,14 +286,16 @@ func startZBusServer(ctx context.Context, broker string, networker pkg.Networker
 	return nil
 }
 
-func waitYggdrasilBin() {
+// waitYggdrasilBin waits for the yggdrasil binary for at most timeout, or
+// until the context is cancelled if timeout is 0
+func waitYggdrasilBin(ctx context.Context, timeout time.Duration) error {
 	log.Info().Msg("wait for yggdrasil binary to be available")
 	bo := backoff.NewExponentialBackOff()
-	bo.MaxElapsedTime = 0 // forever
-	_ = backoff.RetryNotify(func() error {
+	bo.MaxElapsedTime = timeout
+	return backoff.RetryNotify(func() error {
 		_, err := exec.LookPath("yggdrasil")
 		return err
-	}, bo, func(err error, d time.Duration) {
+	}, backoff.WithContext(bo, ctx), func(err error, d time.Duration) {
 		log.Warn().Err(err).Msgf("yggdrasil binary not found, retying in %s", d.String())
 	})
 }
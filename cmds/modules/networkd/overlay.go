@@ -0,0 +1,64 @@
+package networkd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/zbus"
+	zos "github.com/threefoldtech/zos/pkg"
+	"github.com/threefoldtech/zosbase/pkg/kernel"
+	"github.com/threefoldtech/zosbase/pkg/stubs"
+)
+
+const (
+	// kernel param with a comma separated list of the overlays to run,
+	// all overlays run if it's not set
+	paramOverlays = "overlays"
+
+	overlaysZuiLabel = "overlays"
+)
+
+// defaultOverlays are the overlays that run if the kernel param is not set
+func defaultOverlays() map[string]bool {
+	return map[string]bool{
+		zos.OverlayYggdrasil: true,
+		zos.OverlayMycelium:  true,
+	}
+}
+
+// overlaysFromKernel returns which overlays are enabled. If the kernel param
+// has an unknown overlay the default overlays are returned with the error.
+func overlaysFromKernel(params kernel.Params) (map[string]bool, error) {
+	enabled := defaultOverlays()
+	value, ok := params.GetOne(paramOverlays)
+	if !ok {
+		return enabled, nil
+	}
+
+	for overlay := range enabled {
+		enabled[overlay] = false
+	}
+
+	for _, overlay := range strings.Split(value, ",") {
+		overlay = strings.TrimSpace(overlay)
+		if len(overlay) == 0 {
+			continue
+		}
+
+		if _, ok := enabled[overlay]; !ok {
+			return defaultOverlays(), fmt.Errorf("unknown overlay '%s'", overlay)
+		}
+		enabled[overlay] = true
+	}
+
+	return enabled, nil
+}
+
+// reportOverlays pushes the overlays errors to zui, an empty list clears them
+func reportOverlays(ctx context.Context, cl zbus.Client, errs []string) {
+	if err := stubs.NewZUIStub(cl).PushErrors(ctx, overlaysZuiLabel, errs); err != nil {
+		log.Error().Err(err).Msg("failed to push overlays errors to zui")
+	}
+}
@@ -0,0 +1,108 @@
+package networkd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/zosbase/pkg/kernel"
+	"github.com/threefoldtech/zosbase/pkg/network/dhcp"
+	"github.com/threefoldtech/zosbase/pkg/network/ndmz"
+	"github.com/threefoldtech/zosbase/pkg/zinit"
+)
+
+const (
+	// kernel param with the static address of the zos bridge, set by the
+	// internet bootstrap
+	paramAddress = "zos.ip"
+	// kernel param with the static address of the ndmz public interface in
+	// cidr notation, it must be in the network of zos.ip
+	paramNDMZAddress = "zos.ndmz.ip"
+	// kernel param with the default gateway of zos.ip and zos.ndmz.ip
+	paramGateway = "zos.gw"
+	// kernel param set on ipv6 only nodes, the zos bridge and ndmz only get
+	// ipv6 addresses over slaac
+	paramIPv6Only = "zos.ipv6only"
+
+	// ndmzPub4 is the ndmz interface attached to the zos bridge
+	ndmzPub4 = "npub4"
+)
+
+// ndmzStatic is the static config of the ndmz public interface
+type ndmzStatic struct {
+	Address *net.IPNet
+	Gateway net.IP
+}
+
+// ndmzStaticFromKernel loads the static config of the ndmz public interface
+// from kernel params, it's nil if the interface uses dhcp
+func ndmzStaticFromKernel(params kernel.Params) (*ndmzStatic, error) {
+	address, ok := params.GetOne(paramNDMZAddress)
+	if !ok {
+		if params.Exists(paramAddress) {
+			log.Warn().Msgf("%s is set without %s, ndmz will get its address over dhcp", paramAddress, paramNDMZAddress)
+		}
+		return nil, nil
+	}
+
+	ip, ipNet, err := net.ParseCIDR(address)
+	if err != nil || ip.To4() == nil {
+		return nil, fmt.Errorf("invalid %s '%s', expecting an ipv4 cidr", paramNDMZAddress, address)
+	}
+	ipNet.IP = ip
+
+	value, ok := params.GetOne(paramAddress)
+	if !ok {
+		return nil, fmt.Errorf("%s requires %s", paramNDMZAddress, paramAddress)
+	}
+
+	if zosIP, _, err := net.ParseCIDR(value); err == nil && zosIP.Equal(ip) {
+		return nil, fmt.Errorf("%s must not be the address of %s", paramNDMZAddress, paramAddress)
+	}
+
+	value, _ = params.GetOne(paramGateway)
+	gw := net.ParseIP(value)
+	if gw == nil || gw.To4() == nil {
+		return nil, fmt.Errorf("invalid %s '%s', required with %s", paramGateway, value, paramNDMZAddress)
+	}
+
+	if !ipNet.Contains(gw) {
+		return nil, fmt.Errorf("gateway '%s' is not in the network of '%s'", gw, address)
+	}
+
+	return &ndmzStatic{Address: ipNet, Gateway: gw}, nil
+}
+
+// configureNDMZ stops the dhcp client of the ndmz public interface and sets
+// its static address and default route
+func configureNDMZ(ctx context.Context, cfg *ndmzStatic) error {
+	stopNDMZDHCP()
+
+	for _, args := range [][]string{
+		{"addr", "replace", cfg.Address.String(), "dev", ndmzPub4},
+		{"route", "replace", "default", "via", cfg.Gateway.String(), "dev", ndmzPub4},
+	} {
+		cmd := append([]string{"-n", ndmz.NetNSNDMZ, "-4"}, args...)
+		if output, err := exec.CommandContext(ctx, "ip", cmd...).CombinedOutput(); err != nil {
+			return errors.Wrapf(err, "failed to %s %s on %s: %s", args[0], args[1], ndmzPub4, output)
+		}
+	}
+
+	return nil
+}
+
+// stopNDMZDHCP stops and removes the dhcp client of the ndmz public
+// interface
+func stopNDMZDHCP() {
+	dhcpService := dhcp.NewService(ndmzPub4, ndmz.NetNSNDMZ, zinit.Default())
+	if err := dhcpService.Stop(); err != nil {
+		log.Debug().Err(err).Msg("failed to stop ndmz dhcp service")
+	}
+
+	if err := dhcpService.Destroy(); err != nil {
+		log.Debug().Err(err).Msg("failed to destroy ndmz dhcp service")
+	}
+}
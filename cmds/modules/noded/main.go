@@ -12,6 +12,8 @@ import (
 	"github.com/urfave/cli/v2"
 
 	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	"github.com/threefoldtech/zos/pkg/diskhealth"
+	"github.com/threefoldtech/zos/pkg/inventory"
 	"github.com/threefoldtech/zosbase/pkg/app"
 	"github.com/threefoldtech/zosbase/pkg/capacity"
 	"github.com/threefoldtech/zosbase/pkg/environment"
@@ -43,6 +45,11 @@ var Module cli.Command = cli.Command{
 	Name:  "noded",
 	Usage: "reports the node total resources",
 	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "root",
+			Usage: "`ROOT` working directory of the module",
+			Value: "/var/cache/modules/noded",
+		},
 		&cli.StringFlag{
 			Name:  "broker",
 			Usage: "connection string to the message `BROKER`",
@@ -83,6 +90,7 @@ func registerationServer(ctx context.Context, msgBrokerCon string, info registra
 func action(cli *cli.Context) error {
 	var (
 		msgBrokerCon string = cli.String("broker")
+		rootDir      string = cli.String("root")
 		printID      bool   = cli.Bool("id")
 		printNet     bool   = cli.Bool("net")
 	)
@@ -237,12 +245,18 @@ func action(cli *cli.Context) error {
 	server.Register(zbus.ObjectID{Name: "host", Version: "0.0.1"}, host)
 	server.Register(zbus.ObjectID{Name: "system", Version: "0.0.1"}, system)
 	server.Register(zbus.ObjectID{Name: "performance-monitor", Version: "0.0.1"}, perfMon)
+	server.Register(zbus.ObjectID{Name: "inventory", Version: "0.0.1"}, inventory.NewManager(oracle))
+
+	diskHealth := diskhealth.NewMonitor(redis, rootDir, 30*time.Minute)
+	go diskHealth.Run(ctx)
+	server.Register(zbus.ObjectID{Name: "disk-health", Version: "0.0.1"}, diskHealth)
 
 	log.Info().Uint32("node", node).Uint32("twin", twin).Msg("node registered")
 
 	go func() {
+		applier := &publicApplier{cl: redis}
 		for {
-			if err := public(ctx, node, redis, consumer); err != nil {
+			if err := public(ctx, node, redis, consumer, applier); err != nil {
 				log.Error().Err(err).Msg("setting public config failed")
 				<-time.After(10 * time.Second)
 			}
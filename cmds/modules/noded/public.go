@@ -2,22 +2,81 @@ package noded
 
 import (
 	"context"
+	"fmt"
+	"net"
+	"reflect"
 	"time"
 
+	"github.com/containernetworking/plugins/pkg/ns"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
 	"github.com/threefoldtech/zbus"
 	"github.com/threefoldtech/zosbase/pkg"
 	"github.com/threefoldtech/zosbase/pkg/events"
+	"github.com/threefoldtech/zosbase/pkg/network/namespace"
+	netpublic "github.com/threefoldtech/zosbase/pkg/network/public"
 	"github.com/threefoldtech/zosbase/pkg/stubs"
 )
 
-func setPublicConfig(ctx context.Context, cl zbus.Client, cfg *substrate.PublicConfig) error {
+const (
+	// publicZuiLabel is the label used to push public config errors to zui
+	publicZuiLabel = "public-config-apply"
+	// probeTimeout is the max time to wait for the public namespace to get
+	// connectivity after applying a new public config
+	probeTimeout = 2 * time.Minute
+	// retryMin and retryMax bound the backoff of configs rejected because of
+	// failed probes, the upstream may just have been down
+	retryMin = 5 * time.Minute
+	retryMax = 2 * time.Hour
+)
+
+var (
+	probeTargets4 = []string{"1.1.1.1:443", "8.8.8.8:53", "9.9.9.9:443"}
+	probeTargets6 = []string{"[2606:4700:4700::1111]:443", "[2001:4860:4860::8888]:53", "[2620:fe::fe]:443"}
+)
+
+// publicApplier applies the public config in stages. The config is validated
+// first, then applied and connectivity is probed from the public namespace. If
+// the probe fails the previous config is restored.
+type publicApplier struct {
+	cl zbus.Client
+	// rejected is the last config that failed to apply. Invalid configs are
+	// not tried again until the config is changed, configs that failed the
+	// probe are retried at retryAt
+	rejected  *pkg.PublicConfig
+	retryable bool
+	attempts  int
+	retryAt   time.Time
+}
+
+// retryDelay is the delay before the retry of a config that failed attempts times
+func retryDelay(attempts int) time.Duration {
+	delay := retryMin
+	for i := 1; i < attempts && delay < retryMax; i++ {
+		delay *= 2
+	}
+
+	return min(delay, retryMax)
+}
+
+// retry fires when the rejected config should be tried again, it never fires
+// if there is nothing to retry
+func (a *publicApplier) retry() <-chan time.Time {
+	if a.rejected == nil || !a.retryable {
+		return nil
+	}
+
+	return time.After(time.Until(a.retryAt))
+}
+
+func (a *publicApplier) apply(ctx context.Context, cfg *substrate.PublicConfig) error {
 	log.Info().Msg("setting node public config")
-	netMgr := stubs.NewNetworkerStub(cl)
+	netMgr := stubs.NewNetworkerStub(a.cl)
 
 	if cfg == nil {
+		a.rejected = nil
+		a.attempts = 0
 		return netMgr.UnsetPublicConfig(ctx)
 	}
 
@@ -26,11 +85,202 @@ func setPublicConfig(ctx context.Context, cl zbus.Client, cfg *substrate.PublicC
 		return errors.Wrap(err, "failed to create public config from setup")
 	}
 
-	return netMgr.SetPublicConfig(ctx, pub)
+	if a.rejected != nil && reflect.DeepEqual(*a.rejected, pub) {
+		if !a.retryable || time.Now().Before(a.retryAt) {
+			log.Warn().Msg("public config was rejected before, not applying it again yet")
+			return nil
+		}
+
+		log.Info().Int("attempts", a.attempts).Msg("retrying rejected public config")
+	}
+
+	if err := validatePublicConfig(pub); err != nil {
+		a.reject(ctx, pub, errors.Wrap(err, "invalid public config"), false)
+		return nil
+	}
+
+	previous, err := netMgr.GetPublicConfig(ctx)
+	hasPrevious := err == nil
+	if hasPrevious && reflect.DeepEqual(previous, pub) {
+		// nothing to probe, but still make sure it's applied
+		return netMgr.SetPublicConfig(ctx, pub)
+	}
+
+	if err := netMgr.SetPublicConfig(ctx, pub); err != nil {
+		return err
+	}
+
+	if err := probe(ctx, pub); err != nil {
+		log.Error().Err(err).Msg("public config has no connectivity, rolling back")
+		if hasPrevious {
+			err = netMgr.SetPublicConfig(ctx, previous)
+		} else {
+			err = netMgr.UnsetPublicConfig(ctx)
+		}
+
+		if err != nil {
+			return errors.Wrap(err, "failed to roll back public config")
+		}
+
+		a.reject(ctx, pub, fmt.Errorf("no connectivity with public config (ip: %s, gw: %s), previous config restored", pub.IPv4.String(), pub.GW4), true)
+		return nil
+	}
+
+	a.rejected = nil
+	a.attempts = 0
+	a.pushErrors(ctx)
+	return nil
+}
+
+// reject records the config as rejected, retryable configs are tried again
+// with an exponential backoff
+func (a *publicApplier) reject(ctx context.Context, cfg pkg.PublicConfig, err error, retryable bool) {
+	if a.rejected == nil || !reflect.DeepEqual(*a.rejected, cfg) {
+		a.attempts = 0
+	}
+
+	a.rejected = &cfg
+	a.retryable = retryable
+	a.attempts++
+
+	msg := err.Error()
+	if retryable {
+		a.retryAt = time.Now().Add(retryDelay(a.attempts))
+		msg = fmt.Sprintf("%s, retrying at %s", msg, a.retryAt.UTC().Format(time.RFC3339))
+	}
+
+	log.Error().Err(err).Int("attempts", a.attempts).Bool("retry", retryable).Msg("public config rejected")
+	a.pushErrors(ctx, msg)
+}
+
+func (a *publicApplier) pushErrors(ctx context.Context, errs ...string) {
+	zui := stubs.NewZUIStub(a.cl)
+	if err := zui.PushErrors(ctx, publicZuiLabel, errs); err != nil {
+		log.Error().Err(err).Msg("failed to push public config errors to zui")
+	}
+}
+
+// validatePublicConfig validates the ip/gateway combinations of the config
+func validatePublicConfig(cfg pkg.PublicConfig) error {
+	if cfg.IPv4.IP == nil && cfg.IPv6.IP == nil {
+		return fmt.Errorf("no ip addresses")
+	}
+
+	if cfg.IPv4.IP != nil {
+		if err := validateIPGateway(cfg.IPv4.IPNet, cfg.GW4, false); err != nil {
+			return errors.Wrap(err, "invalid ipv4 setup")
+		}
+	}
+
+	if cfg.IPv6.IP != nil {
+		if err := validateIPGateway(cfg.IPv6.IPNet, cfg.GW6, true); err != nil {
+			return errors.Wrap(err, "invalid ipv6 setup")
+		}
+	}
+
+	return nil
+}
+
+func validateIPGateway(ip net.IPNet, gw net.IP, v6 bool) error {
+	if (ip.IP.To4() == nil) != v6 {
+		return fmt.Errorf("wrong address family of ip '%s'", ip.String())
+	}
+
+	if !ip.IP.IsGlobalUnicast() {
+		return fmt.Errorf("ip '%s' is not a unicast address", ip.String())
+	}
+
+	if gw == nil {
+		return fmt.Errorf("missing gateway")
+	}
+
+	if (gw.To4() == nil) != v6 {
+		return fmt.Errorf("wrong address family of gateway '%s'", gw)
+	}
+
+	if gw.Equal(ip.IP) {
+		return fmt.Errorf("gateway '%s' is the same as the ip", gw)
+	}
+
+	// ipv6 gateways are commonly link local
+	if v6 && gw.IsLinkLocalUnicast() {
+		return nil
+	}
+
+	subnet := net.IPNet{IP: ip.IP.Mask(ip.Mask), Mask: ip.Mask}
+	if !subnet.Contains(gw) {
+		return fmt.Errorf("gateway '%s' is not reachable from '%s'", gw, ip.String())
+	}
+
+	ones, bits := ip.Mask.Size()
+	if !v6 && bits-ones > 1 {
+		// for subnets larger than /31 the network and broadcast
+		// addresses can't be used
+		broadcast := make(net.IP, len(subnet.IP.To4()))
+		for i, b := range subnet.IP.To4() {
+			broadcast[i] = b | ^ip.Mask[len(ip.Mask)-4+i]
+		}
+
+		for _, addr := range []net.IP{ip.IP, gw} {
+			if addr.Equal(subnet.IP) || addr.Equal(broadcast) {
+				return fmt.Errorf("'%s' is the network or broadcast address of '%s'", addr, subnet.String())
+			}
+		}
+	}
+
+	return nil
+}
+
+// probe checks connectivity from the public namespace until it succeeds or
+// probeTimeout elapses
+func probe(ctx context.Context, cfg pkg.PublicConfig) error {
+	network, targets := "tcp4", probeTargets4
+	if cfg.IPv4.IP == nil {
+		network, targets = "tcp6", probeTargets6
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	for {
+		err := probeOnce(network, targets)
+		if err == nil {
+			return nil
+		}
+
+		log.Debug().Err(err).Msg("public config connectivity probe failed")
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func probeOnce(network string, targets []string) error {
+	netNS, err := namespace.GetByName(netpublic.PublicNamespace)
+	if err != nil {
+		return errors.Wrap(err, "failed to get public namespace")
+	}
+	defer netNS.Close()
+
+	return netNS.Do(func(_ ns.NetNS) error {
+		var err error
+		for _, target := range targets {
+			var conn net.Conn
+			conn, err = net.DialTimeout(network, target, 5*time.Second)
+			if err == nil {
+				conn.Close()
+				return nil
+			}
+		}
+
+		return err
+	})
 }
 
 // public sets and watches changes to public config on chain and tries to apply the provided setup
-func public(ctx context.Context, nodeID uint32, cl zbus.Client, events *events.RedisConsumer) error {
+func public(ctx context.Context, nodeID uint32, cl zbus.Client, events *events.RedisConsumer, applier *publicApplier) error {
 	ch, err := events.PublicConfig(ctx)
 	if err != nil {
 		return errors.Wrap(err, "failed to subscribe to node events")
@@ -50,7 +300,7 @@ reapply:
 			cfg = &node.PublicConfig.AsValue
 		}
 
-		if err := setPublicConfig(ctx, cl, cfg); err != nil {
+		if err := applier.apply(ctx, cfg); err != nil {
 			return errors.Wrap(err, "failed to set public config (reapply)")
 		}
 
@@ -64,9 +314,11 @@ reapply:
 				if event.PublicConfig.HasValue {
 					cfg = &event.PublicConfig.AsValue
 				}
-				if err := setPublicConfig(ctx, cl, cfg); err != nil {
+				if err := applier.apply(ctx, cfg); err != nil {
 					return errors.Wrap(err, "failed to set public config")
 				}
+			case <-applier.retry():
+				continue reapply
 			case <-time.After(2 * time.Hour):
 				// last resort, if none of the events
 				// was received, it will be a good idea to just
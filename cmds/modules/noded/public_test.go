@@ -0,0 +1,100 @@
+package noded
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/threefoldtech/zosbase/pkg"
+	"github.com/threefoldtech/zosbase/pkg/gridtypes"
+)
+
+func mustIPNet(t *testing.T, s string) gridtypes.IPNet {
+	ip, network, err := net.ParseCIDR(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	network.IP = ip
+	return gridtypes.IPNet{IPNet: *network}
+}
+
+func TestValidatePublicConfig(t *testing.T) {
+	cases := []struct {
+		name  string
+		cfg   pkg.PublicConfig
+		valid bool
+	}{
+		{
+			name:  "valid",
+			cfg:   pkg.PublicConfig{IPv4: mustIPNet(t, "185.69.166.10/24"), GW4: net.ParseIP("185.69.166.1")},
+			valid: true,
+		},
+		{
+			name: "gateway outside subnet",
+			cfg:  pkg.PublicConfig{IPv4: mustIPNet(t, "185.69.166.10/24"), GW4: net.ParseIP("185.69.167.1")},
+		},
+		{
+			name: "missing gateway",
+			cfg:  pkg.PublicConfig{IPv4: mustIPNet(t, "185.69.166.10/24")},
+		},
+		{
+			name: "gateway is the ip",
+			cfg:  pkg.PublicConfig{IPv4: mustIPNet(t, "185.69.166.10/24"), GW4: net.ParseIP("185.69.166.10")},
+		},
+		{
+			name: "broadcast gateway",
+			cfg:  pkg.PublicConfig{IPv4: mustIPNet(t, "185.69.166.10/24"), GW4: net.ParseIP("185.69.166.255")},
+		},
+		{
+			name:  "point to point",
+			cfg:   pkg.PublicConfig{IPv4: mustIPNet(t, "185.69.166.10/31"), GW4: net.ParseIP("185.69.166.11")},
+			valid: true,
+		},
+		{
+			name: "ipv6 gateway family",
+			cfg: pkg.PublicConfig{
+				IPv4: mustIPNet(t, "185.69.166.10/24"), GW4: net.ParseIP("185.69.166.1"),
+				IPv6: mustIPNet(t, "2a02:1802:5e::10/64"), GW6: net.ParseIP("185.69.166.1"),
+			},
+		},
+		{
+			name: "ipv6 link local gateway",
+			cfg: pkg.PublicConfig{
+				IPv4: mustIPNet(t, "185.69.166.10/24"), GW4: net.ParseIP("185.69.166.1"),
+				IPv6: mustIPNet(t, "2a02:1802:5e::10/64"), GW6: net.ParseIP("fe80::1"),
+			},
+			valid: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := validatePublicConfig(c.cfg)
+			if c.valid && err != nil {
+				t.Errorf("expected valid config, got: %s", err)
+			} else if !c.valid && err == nil {
+				t.Error("expected invalid config")
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	cases := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, 5 * time.Minute},
+		{2, 10 * time.Minute},
+		{3, 20 * time.Minute},
+		{5, 80 * time.Minute},
+		{6, 2 * time.Hour},
+		{20, 2 * time.Hour},
+	}
+
+	for _, c := range cases {
+		if got := retryDelay(c.attempts); got != c.expected {
+			t.Fatalf("attempt %d: expected %s got %s", c.attempts, c.expected, got)
+		}
+	}
+}
@@ -3,11 +3,15 @@ package powerd
 import (
 	"context"
 	"crypto/ed25519"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
 	"github.com/threefoldtech/zbus"
+	"github.com/threefoldtech/zos/pkg/proxy"
+	zosstubs "github.com/threefoldtech/zos/pkg/stubs"
+	"github.com/threefoldtech/zos/pkg/uptimeledger"
 	"github.com/threefoldtech/zosbase/pkg/environment"
 	"github.com/threefoldtech/zosbase/pkg/events"
 	"github.com/threefoldtech/zosbase/pkg/power"
@@ -18,6 +22,9 @@ import (
 
 const (
 	module = "power"
+
+	// uptimeInterval is how often an uptime sample is taken and reported
+	uptimeInterval = 40 * time.Minute
 )
 
 // Module is entry point for module
@@ -25,6 +32,11 @@ var Module cli.Command = cli.Command{
 	Name:  "powerd",
 	Usage: "handles the node power events",
 	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "root",
+			Usage: "`ROOT` working directory of the module",
+			Value: "/var/cache/modules/powerd",
+		},
 		&cli.StringFlag{
 			Name:  "broker",
 			Usage: "connection string to the message `BROKER`",
@@ -37,9 +49,15 @@ var Module cli.Command = cli.Command{
 func action(cli *cli.Context) error {
 	var (
 		msgBrokerCon string = cli.String("broker")
+		rootDir      string = cli.String("root")
 		powerdLabel  string = "powerd"
 	)
 
+	// zos-config (power policy) is fetched through the proxy if any
+	if err := proxy.Setup(); err != nil {
+		return errors.Wrap(err, "failed to set up proxy")
+	}
+
 	ctx, _ := utils.WithSignal(cli.Context)
 	utils.OnDone(ctx, func(_ error) {
 		log.Info().Msg("shutting down")
@@ -47,6 +65,11 @@ func action(cli *cli.Context) error {
 
 	env := environment.MustGet()
 
+	server, err := zbus.NewRedisServer(module, msgBrokerCon, 1)
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to message broker")
+	}
+
 	cl, err := zbus.NewRedisClient(msgBrokerCon)
 	if err != nil {
 		return errors.Wrap(err, "failed to connect to message broker server")
@@ -69,14 +92,6 @@ func action(cli *cli.Context) error {
 		return errors.Wrap(err, "failed to get node id")
 	}
 
-	twinID, err := register.TwinID(ctx)
-	if err != nil {
-		if zuiErr := zui.PushErrors(cli.Context, powerdLabel, []string{err.Error()}); zuiErr != nil {
-			log.Info().Err(zuiErr).Send()
-		}
-		return errors.Wrap(err, "failed to get twin id")
-	}
-
 	sk := ed25519.PrivateKey(identity.PrivateKey(ctx))
 	id, err := substrate.NewIdentityFromEd25519Key(sk)
 	log.Info().Str("address", id.Address()).Msg("node address")
@@ -86,40 +101,82 @@ func action(cli *cli.Context) error {
 
 	substrateGateway := stubs.NewSubstrateGatewayStub(cl)
 
-	uptime, err := power.NewUptime(substrateGateway, id)
+	// uptime samples are queued on disk so the ones taken while the chain
+	// is not reachable are covered by the next report. Reports go through
+	// the extrinsic queue so they don't hold a gateway worker.
+	ledger, err := uptimeledger.NewLedger(rootDir, zosstubs.NewExtrinsicQueueStub(cl))
 	if err != nil {
-		return errors.Wrap(err, "failed to initialize uptime reported")
+		return errors.Wrap(err, "failed to initialize uptime ledger")
 	}
 
-	// start uptime reporting
-	go uptime.Start(cli.Context)
+	// start uptime reporting, power targets are applied after the first
+	// report
+	reported := make(chan struct{})
+	go ledger.Run(ctx, uptimeInterval, func() { close(reported) })
 
 	// if the feature is globally enabled try to ensure
 	// wake on lan is set correctly.
 	// then override the enabled flag
-	enabled, err := power.EnsureWakeOnLan(cli.Context)
-	if err != nil {
+	if _, err := power.EnsureWakeOnLan(cli.Context); err != nil {
 		return errors.Wrap(err, "failed to enable wol")
 	}
 
+	// the farm nodes wake the node through the target nic, it's the zos nic
+	// unless another one is set with zos.wol
+	wakeOnLan := newWakeOnLan(cl, substrateGateway, rootDir, uint32(env.FarmID), nodeID, sk)
+	enabled := wakeOnLan.setup(ctx)
 	if !enabled {
-		// if the zos nics don't support wol we can automatically
+		// if the target nic doesn't support wol we can automatically
 		// disable the feature
-		log.Info().Msg("no wol support found by zos nic")
+		log.Info().Msg("no wol support found by target nic")
+	}
+	go wakeOnLan.run(ctx)
+
+	orchestrator := &orchestrator{
+		cl:     cl,
+		gw:     substrateGateway,
+		ledger: ledger,
 	}
 
+	server.Register(zbus.ObjectID{Name: "uptime", Version: "0.0.1"}, ledger)
+	server.Register(zbus.ObjectID{Name: "shutdown", Version: "0.0.1"}, orchestrator)
+	server.Register(zbus.ObjectID{Name: "wol", Version: "0.0.1"}, wakeOnLan)
+	go func() {
+		if err := server.Run(ctx); err != nil && err != context.Canceled {
+			log.Fatal().Err(err).Msg("zbus power api exited unexpectedly")
+		}
+	}()
+
 	consumer, err := events.NewConsumer(msgBrokerCon, module)
 	if err != nil {
 		return errors.Wrap(err, "failed to to create event consumer")
 	}
 
-	// start power manager
-	power, err := power.NewPowerServer(substrateGateway, consumer, enabled, env.FarmID, nodeID, twinID, uptime)
-	if err != nil {
-		return errors.Wrap(err, "failed to initialize power manager")
+	// start farm power policy
+	policy := powerPolicy{
+		cl:    cl,
+		gw:    substrateGateway,
+		chain: zosstubs.NewChainReaderStub(cl),
+		farm:  uint32(env.FarmID),
+		node:  nodeID,
+		wol:   enabled,
+		lan:   wakeOnLan,
+		off:   orchestrator,
+	}
+	go policy.run(ctx)
+
+	// apply the power targets set by the farmer
+	target := powerTarget{
+		gw:       substrateGateway,
+		consumer: consumer,
+		farm:     uint32(env.FarmID),
+		node:     nodeID,
+		wol:      enabled,
+		lan:      wakeOnLan,
+		off:      orchestrator,
 	}
 
-	if err := power.Start(ctx); err != nil && !errors.Is(err, context.Canceled) {
+	if err := target.run(ctx, reported); err != nil && !errors.Is(err, context.Canceled) {
 		return err
 	}
 
@@ -0,0 +1,220 @@
+package powerd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/zbus"
+	"github.com/threefoldtech/zos/pkg/powerpolicy"
+	zosstubs "github.com/threefoldtech/zos/pkg/stubs"
+	"github.com/threefoldtech/zosbase/pkg/stubs"
+)
+
+const (
+	// policyInterval is how often the power policy is evaluated
+	policyInterval = time.Minute
+	// policyRefresh is how often the policy and the farm nodes are reloaded
+	policyRefresh = 10 * time.Minute
+)
+
+// cpuSample is a sample of the cpu times from /proc/stat
+type cpuSample struct {
+	idle  uint64
+	total uint64
+}
+
+func readCPU() (cpuSample, error) {
+	file, err := os.Open("/proc/stat")
+	if err != nil {
+		return cpuSample{}, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || fields[0] != "cpu" {
+			continue
+		}
+
+		var sample cpuSample
+		for i, field := range fields[1:] {
+			value, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return cpuSample{}, errors.Wrapf(err, "invalid cpu time '%s'", field)
+			}
+
+			sample.total += value
+			// idle and iowait
+			if i == 3 || i == 4 {
+				sample.idle += value
+			}
+		}
+
+		return sample, nil
+	}
+
+	return cpuSample{}, fmt.Errorf("no cpu line in /proc/stat")
+}
+
+// powerPolicy applies the farm power policy on the node
+type powerPolicy struct {
+	cl      zbus.Client
+	gw      *stubs.SubstrateGatewayStub
+	chain   *zosstubs.ChainReaderStub
+	farm    uint32
+	node    uint32
+	wol     bool
+	lan     *wakeOnLan
+	off     *orchestrator
+	last    cpuSample
+	policy  powerpolicy.Policy
+	nodes   []uint32
+	awake   []uint32
+	updated time.Time
+}
+
+// run evaluates the power policy every minute until the context is cancelled
+func (p *powerPolicy) run(ctx context.Context) {
+	var evaluator powerpolicy.Evaluator
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(policyInterval):
+		}
+
+		if time.Since(p.updated) > policyRefresh {
+			p.refresh(ctx)
+		}
+
+		signals, err := p.signals(ctx)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to get node idle signals")
+			continue
+		}
+
+		_, keeper := powerpolicy.Keepers(p.awake, p.policy.KeepAwake)[p.node]
+		action := evaluator.Evaluate(p.policy, time.Now(), keeper, signals)
+		switch action {
+		case powerpolicy.Shutdown:
+			err = p.shutdown(ctx)
+		case powerpolicy.WakePeers:
+			err = p.wakePeers(ctx)
+		}
+
+		if err != nil {
+			log.Error().Err(err).Stringer("action", action).Msg("failed to apply power policy")
+		}
+	}
+}
+
+func (p *powerPolicy) refresh(ctx context.Context) {
+	// failures are retried on next refresh
+	p.updated = time.Now()
+
+	policy, err := powerpolicy.Load(p.farm)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to load power policy")
+		return
+	}
+
+	nodes, err := p.gw.GetNodes(ctx, p.farm)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list farm nodes")
+		return
+	}
+
+	// this node is up even if the chain didn't catch up yet
+	awake := []uint32{p.node}
+	for _, id := range nodes {
+		if id == p.node {
+			continue
+		}
+
+		power, err := p.chain.GetNodePowerTarget(ctx, id)
+		if err != nil {
+			log.Error().Err(err).Uint32("node", id).Msg("failed to get node power state")
+			return
+		}
+
+		if power.State.IsUp {
+			awake = append(awake, id)
+		}
+	}
+
+	p.policy = policy
+	p.nodes = nodes
+	p.awake = awake
+}
+
+func (p *powerPolicy) signals(ctx context.Context) (powerpolicy.Signals, error) {
+	workloads, err := stubs.NewStatisticsStub(p.cl).Workloads(ctx)
+	if err != nil {
+		return powerpolicy.Signals{}, errors.Wrap(err, "failed to get active workloads")
+	}
+
+	sample, err := readCPU()
+	if err != nil {
+		return powerpolicy.Signals{}, errors.Wrap(err, "failed to read cpu usage")
+	}
+
+	// the first sample has no usage
+	usage := 100.0
+	if p.last.total != 0 && sample.total > p.last.total {
+		idle := sample.idle - p.last.idle
+		total := sample.total - p.last.total
+		usage = 100 * float64(total-idle) / float64(total)
+	}
+	p.last = sample
+
+	return powerpolicy.Signals{Workloads: workloads, CPU: usage}, nil
+}
+
+// shutdown powers down the node, the orchestrator refuses if workloads
+// were deployed meanwhile
+func (p *powerPolicy) shutdown(ctx context.Context) error {
+	if !p.wol {
+		// the node can't be woken by the farm nodes
+		log.Warn().Msg("power policy asks for shutdown but wol is not supported")
+		return nil
+	}
+
+	log.Info().Msg("shutting down node because of farm power policy")
+	return p.off.powerOff(ctx, false)
+}
+
+// wakePeers sends a wake on lan packet to the other nodes of the farm that
+// are down on chain while their power target is up. Nodes the farmer powered
+// off stay down.
+func (p *powerPolicy) wakePeers(ctx context.Context) error {
+	for _, id := range p.nodes {
+		if id == p.node {
+			continue
+		}
+
+		power, err := p.chain.GetNodePowerTarget(ctx, id)
+		if err != nil {
+			log.Error().Err(err).Uint32("node", id).Msg("failed to get node power state")
+			continue
+		}
+
+		if !power.Target.IsUp || !power.State.IsDown {
+			continue
+		}
+
+		log.Info().Uint32("node", id).Msg("waking node because of farm power policy")
+		if err := p.lan.wake(ctx, id); err != nil {
+			log.Error().Err(err).Uint32("node", id).Msg("failed to wake node")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,194 @@
+package powerd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/zbus"
+	zos "github.com/threefoldtech/zos/pkg"
+	zosstubs "github.com/threefoldtech/zos/pkg/stubs"
+	"github.com/threefoldtech/zos/pkg/uptimeledger"
+	"github.com/threefoldtech/zosbase/pkg"
+	"github.com/threefoldtech/zosbase/pkg/stubs"
+	"github.com/threefoldtech/zosbase/pkg/zinit"
+)
+
+const (
+	// stepTimeout is how long a single step of the power off can take
+	stepTimeout = 2 * time.Minute
+	// vmTimeout is how long a vm guest has to power off before it's forced
+	vmTimeout = time.Minute
+)
+
+// orchestrator powers the node off gracefully
+type orchestrator struct {
+	cl     zbus.Client
+	gw     *stubs.SubstrateGatewayStub
+	ledger *uptimeledger.Ledger
+
+	// m makes sure only one power off runs at a time
+	m sync.Mutex
+}
+
+var _ zos.NodeShutdown = (*orchestrator)(nil)
+
+// PowerOff implements zos.NodeShutdown
+func (o *orchestrator) PowerOff(force bool) error {
+	return o.powerOff(context.Background(), force)
+}
+
+// powerOff refuses to power off the node if deployments are active unless
+// forced. The provision engine is paused and its state flushed, the final
+// uptime is reported and the node is marked down on chain before the vms and
+// containers are stopped and the node halts. A failing step aborts the power
+// off unless forced, the engine is resumed and the node keeps running as is.
+func (o *orchestrator) powerOff(ctx context.Context, force bool) error {
+	if !o.m.TryLock() {
+		return fmt.Errorf("power off already in progress")
+	}
+	defer o.m.Unlock()
+
+	workloads, err := stubs.NewStatisticsStub(o.cl).Workloads(ctx)
+	if err != nil && !force {
+		return errors.Wrap(err, "failed to get active workloads")
+	}
+
+	if workloads != 0 && !force {
+		return fmt.Errorf("refusing to power off, node has %d active workloads", workloads)
+	}
+
+	log.Info().Int("workloads", workloads).Bool("force", force).Msg("powering off node")
+
+	steps := []struct {
+		name string
+		fn   func(ctx context.Context) error
+	}{
+		{"quiesce provision engine", func(ctx context.Context) error {
+			return zosstubs.NewQuiescerStub(o.cl).Quiesce(ctx)
+		}},
+		{"report final uptime", o.ledger.Flush},
+		{"set node power state", func(ctx context.Context) error {
+			_, err := o.gw.SetNodePowerState(ctx, false)
+			return err
+		}},
+	}
+
+	for _, step := range steps {
+		err := o.step(ctx, step.fn)
+		if err == nil {
+			continue
+		}
+
+		if !force {
+			o.resume(ctx)
+			return errors.Wrapf(err, "failed to %s, aborting power off", step.name)
+		}
+		log.Error().Err(err).Msgf("failed to %s", step.name)
+	}
+
+	// nothing is undone past this point, the node halts
+	o.stopVMs(ctx)
+	o.stopContainers(ctx)
+
+	log.Info().Msg("halting node")
+	return zinit.Default().Shutdown()
+}
+
+// resume resumes the provision engine once the power off is aborted
+func (o *orchestrator) resume(ctx context.Context) {
+	if err := o.step(ctx, func(ctx context.Context) error {
+		return zosstubs.NewQuiescerStub(o.cl).Resume(ctx)
+	}); err != nil {
+		log.Error().Err(err).Msg("failed to resume provision engine")
+	}
+}
+
+// step runs fn with the step timeout
+func (o *orchestrator) step(ctx context.Context, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, stepTimeout)
+	defer cancel()
+
+	return fn(ctx)
+}
+
+// stopVMs shuts the vms down gracefully so their disks are consistent when
+// the node halts, vmd forces them off after vmTimeout. The vms are booted
+// again by provisiond on next boot.
+func (o *orchestrator) stopVMs(ctx context.Context) {
+	vmd := stubs.NewVMModuleStub(o.cl)
+	var names []string
+	err := o.step(ctx, func(ctx context.Context) (err error) {
+		names, err = vmd.List(ctx)
+		return err
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list vms")
+		return
+	}
+
+	shutdown := zosstubs.NewVMShutdownStub(o.cl)
+	var wg sync.WaitGroup
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+
+			log.Info().Str("vm", name).Msg("shutting vm down")
+			if err := o.step(ctx, func(ctx context.Context) error {
+				return shutdown.Shutdown(ctx, name, vmTimeout)
+			}); err != nil {
+				log.Error().Err(err).Str("vm", name).Msg("failed to shut vm down")
+			}
+		}(name)
+	}
+
+	wg.Wait()
+}
+
+// stopContainers stops the containers through contd before zinit stops the
+// services they depend on
+func (o *orchestrator) stopContainers(ctx context.Context) {
+	contd := stubs.NewContainerModuleStub(o.cl)
+	var namespaces []string
+	err := o.step(ctx, func(ctx context.Context) (err error) {
+		namespaces, err = contd.ListNS(ctx)
+		return err
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list container namespaces")
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, ns := range namespaces {
+		var ids []pkg.ContainerID
+		err := o.step(ctx, func(ctx context.Context) (err error) {
+			ids, err = contd.List(ctx, ns)
+			return err
+		})
+		if err != nil {
+			log.Error().Err(err).Str("namespace", ns).Msg("failed to list containers")
+			continue
+		}
+
+		for _, id := range ids {
+			wg.Add(1)
+			go func(ns string, id pkg.ContainerID) {
+				defer wg.Done()
+
+				log.Info().Str("namespace", ns).Str("container", string(id)).Msg("stopping container")
+				if err := o.step(ctx, func(ctx context.Context) error {
+					return contd.Delete(ctx, ns, id)
+				}); err != nil {
+					log.Error().Err(err).Str("container", string(id)).Msg("failed to stop container")
+				}
+			}(ns, id)
+		}
+	}
+
+	wg.Wait()
+}
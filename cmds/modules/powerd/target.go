@@ -0,0 +1,104 @@
+package powerd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/zosbase/pkg/events"
+	"github.com/threefoldtech/zosbase/pkg/stubs"
+)
+
+// powerTarget applies the power targets the farmer sets on chain. The node
+// is powered off through the orchestrator so it's refused while deployments
+// are active, and the farm nodes that are powered on are woken.
+type powerTarget struct {
+	gw       *stubs.SubstrateGatewayStub
+	consumer *events.RedisConsumer
+	farm     uint32
+	node     uint32
+	// wol is false if the node can't be woken again, power targets down
+	// are ignored then
+	wol bool
+	lan *wakeOnLan
+	off *orchestrator
+}
+
+// run waits for the first uptime report, syncs the node power state then
+// applies the power target changes until the context is cancelled
+func (t *powerTarget) run(ctx context.Context, reported <-chan struct{}) error {
+	// the node state can't be set before it's known up on chain
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-reported:
+	}
+
+	if err := t.sync(ctx); err != nil {
+		log.Error().Err(err).Msg("failed to sync node power state")
+	}
+
+	changes, err := t.consumer.PowerTargetChange(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to subscribe to power target changes")
+	}
+
+	for event := range changes {
+		if uint32(event.FarmID) != t.farm {
+			continue
+		}
+
+		if event.NodeID == t.node {
+			if event.Target.IsDown {
+				if err := t.down(ctx); err != nil {
+					log.Error().Err(err).Msg("failed to apply power target down")
+				}
+			}
+			continue
+		}
+
+		if event.Target.IsUp {
+			log.Info().Uint32("node", event.NodeID).Msg("waking node because of power target")
+			if err := t.lan.wake(ctx, event.NodeID); err != nil {
+				log.Error().Err(err).Uint32("node", event.NodeID).Msg("failed to wake node")
+			}
+		}
+	}
+
+	return ctx.Err()
+}
+
+// sync powers the node off if its target is down, otherwise it makes sure
+// the node is marked up on chain
+func (t *powerTarget) sync(ctx context.Context) error {
+	power, err := t.gw.GetPowerTarget(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get node power target")
+	}
+
+	if power.Target.IsDown {
+		err := t.down(ctx)
+		if err == nil {
+			return nil
+		}
+		// the node keeps running so it must be marked up
+		log.Error().Err(err).Msg("failed to apply power target down")
+	}
+
+	if power.State.IsUp {
+		return nil
+	}
+
+	_, err = t.gw.SetNodePowerState(ctx, true)
+	return err
+}
+
+// down powers the node off, it's refused if deployments are active
+func (t *powerTarget) down(ctx context.Context) error {
+	if !t.wol {
+		return fmt.Errorf("node can't be woken by wake on lan")
+	}
+
+	return t.off.powerOff(ctx, false)
+}
@@ -0,0 +1,418 @@
+package powerd
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/zbus"
+	"github.com/threefoldtech/zos/pkg"
+	zosstubs "github.com/threefoldtech/zos/pkg/stubs"
+	"github.com/threefoldtech/zos/pkg/wol"
+	"github.com/threefoldtech/zosbase/pkg/kernel"
+	"github.com/threefoldtech/zosbase/pkg/network/bootstrap"
+	"github.com/threefoldtech/zosbase/pkg/stubs"
+	"github.com/vishvananda/netlink"
+)
+
+const (
+	// kernel param with the name of the nic the farm nodes send magic
+	// packets to, defaults to the nic attached to the zos bridge
+	paramWol    = "zos.wol"
+	wolZuiLabel = "wol"
+	wolPeers    = "wol-peers.json"
+
+	// wolTestInterval is how often the self test runs
+	wolTestInterval = 24 * time.Hour
+	// wolTestTimeout is how long a neighbor has to answer the self test
+	wolTestTimeout = 5 * time.Second
+	// wolNeighbors is the max number of neighbors tried by the self test
+	wolNeighbors = 3
+	// wolVerifyTimeout is how long the chain is queried to verify a claim
+	wolVerifyTimeout = 10 * time.Second
+)
+
+// wakeOnLan manages wake on lan of the node
+type wakeOnLan struct {
+	cl    zbus.Client
+	gw    *stubs.SubstrateGatewayStub
+	chain *zosstubs.ChainReaderStub
+	root  string
+	farm  uint32
+	node  uint32
+	sk    ed25519.PrivateKey
+
+	m      sync.Mutex
+	status pkg.WolStatus
+}
+
+var _ pkg.WakeOnLan = (*wakeOnLan)(nil)
+
+func newWakeOnLan(cl zbus.Client, gw *stubs.SubstrateGatewayStub, root string, farm, node uint32, sk ed25519.PrivateKey) *wakeOnLan {
+	w := &wakeOnLan{
+		cl:     cl,
+		gw:     gw,
+		chain:  zosstubs.NewChainReaderStub(cl),
+		root:   root,
+		farm:   farm,
+		node:   node,
+		sk:     sk,
+		status: pkg.WolStatus{Peers: make(map[uint32]string)},
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, wolPeers))
+	if err == nil {
+		err = json.Unmarshal(data, &w.status.Peers)
+	}
+
+	if err != nil && !os.IsNotExist(err) {
+		log.Error().Err(err).Msg("failed to load wol peers")
+	}
+
+	return w
+}
+
+// Status implements pkg.WakeOnLan
+func (w *wakeOnLan) Status() pkg.WolStatus {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	status := w.status
+	status.NICs = append([]pkg.WolNIC{}, w.status.NICs...)
+	status.Peers = make(map[uint32]string)
+	for node, mac := range w.status.Peers {
+		status.Peers[node] = mac
+	}
+
+	return status
+}
+
+// physicalNICs returns the physical nics and the one attached to the zos
+// bridge if any
+func physicalNICs() ([]string, string, error) {
+	links, err := netlink.LinkList()
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to list links")
+	}
+
+	zos := -1
+	for _, link := range links {
+		if link.Attrs().Name == "zos" {
+			zos = link.Attrs().Index
+		}
+	}
+
+	var names []string
+	var attached string
+	for _, link := range links {
+		if ok, err := bootstrap.PhysicalFilter(link); err != nil || !ok {
+			continue
+		}
+
+		names = append(names, link.Attrs().Name)
+		if link.Attrs().MasterIndex == zos && len(attached) == 0 {
+			attached = link.Attrs().Name
+		}
+	}
+
+	sort.Strings(names)
+	return names, attached, nil
+}
+
+// setup inspects the physical nics and enables wake on magic packet on the
+// target nic. It returns true if the node can be woken by the farm nodes.
+func (w *wakeOnLan) setup(ctx context.Context) bool {
+	nics, target, err := physicalNICs()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list physical nics")
+	}
+
+	if value, ok := kernel.GetParams().GetOne(paramWol); ok {
+		target = value
+	}
+
+	status := pkg.WolStatus{Target: target}
+	for _, name := range nics {
+		nic := pkg.WolNIC{Name: name}
+		if inf, err := net.InterfaceByName(name); err == nil {
+			nic.MAC = inf.HardwareAddr.String()
+		}
+
+		settings, err := wol.Inspect(ctx, name)
+		if err == nil && name == target && settings.Capable() && !settings.Enabled() {
+			if err = wol.Enable(ctx, name); err == nil {
+				settings, err = wol.Inspect(ctx, name)
+			}
+		}
+
+		if err != nil {
+			nic.Error = err.Error()
+		}
+
+		nic.Supports = settings.Supports
+		nic.Current = settings.Current
+		nic.Capable = settings.Capable()
+		nic.Enabled = settings.Enabled()
+
+		if name == target {
+			status.MAC = nic.MAC
+			status.Enabled = nic.Enabled
+		}
+
+		status.NICs = append(status.NICs, nic)
+	}
+
+	w.m.Lock()
+	w.status.Target = status.Target
+	w.status.MAC = status.MAC
+	w.status.Enabled = status.Enabled
+	w.status.NICs = status.NICs
+	w.m.Unlock()
+
+	w.report(ctx)
+	return status.Enabled
+}
+
+// problems are the wake on lan problems shown on zui
+func (w *wakeOnLan) problems() []string {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	var problems []string
+	status := w.status
+	switch {
+	case len(status.Target) == 0:
+		problems = append(problems, "wake on lan: no nic attached to the zos bridge")
+	case len(status.MAC) == 0:
+		problems = append(problems, fmt.Sprintf("wake on lan: nic '%s' not found", status.Target))
+	case !status.Enabled:
+		for _, nic := range status.NICs {
+			if nic.Name != status.Target {
+				continue
+			}
+
+			reason := nic.Error
+			if !nic.Capable && len(reason) == 0 {
+				reason = fmt.Sprintf("magic packet not supported (%s)", nic.Supports)
+			}
+			problems = append(problems, fmt.Sprintf("wake on lan not enabled on %s: %s", nic.Name, reason))
+		}
+	}
+
+	if len(status.Test.Error) != 0 {
+		problems = append(problems, fmt.Sprintf("wake on lan self test failed: %s", status.Test.Error))
+	}
+
+	return problems
+}
+
+func (w *wakeOnLan) report(ctx context.Context) {
+	if err := stubs.NewZUIStub(w.cl).PushErrors(ctx, wolZuiLabel, w.problems()); err != nil {
+		log.Info().Err(err).Send()
+	}
+}
+
+// run answers the self tests of the farm nodes and runs the self test once a
+// day until the context is cancelled
+func (w *wakeOnLan) run(ctx context.Context) {
+	go func() {
+		learn := func(claim wol.Claim) {
+			w.learn(ctx, claim)
+		}
+
+		if err := wol.Respond(ctx, learn); err != nil && !errors.Is(err, context.Canceled) {
+			log.Error().Err(err).Msg("wol responder stopped")
+		}
+	}()
+
+	for {
+		w.selfTest(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wolTestInterval):
+		}
+	}
+}
+
+// learn records the target mac of a farm node, if the claim is signed by
+// the node key
+func (w *wakeOnLan) learn(ctx context.Context, claim wol.Claim) {
+	node, mac := claim.Node, claim.MAC
+	if node == w.node || w.target(node, "") == mac.String() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, wolVerifyTimeout)
+	defer cancel()
+
+	if err := w.verify(ctx, claim); err != nil {
+		log.Warn().Err(err).Uint32("node", node).Stringer("mac", mac).Msg("ignoring wol target of node")
+		return
+	}
+
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	log.Info().Uint32("node", node).Stringer("mac", mac).Msg("learned wol target of node")
+	w.status.Peers[node] = mac.String()
+
+	data, err := json.Marshal(w.status.Peers)
+	if err == nil {
+		err = os.WriteFile(filepath.Join(w.root, wolPeers), data, 0644)
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("failed to save wol peers")
+	}
+}
+
+// verify checks the claim is made by a node of the farm
+func (w *wakeOnLan) verify(ctx context.Context, claim wol.Claim) error {
+	node, err := w.gw.GetNode(ctx, claim.Node)
+	if err != nil {
+		return errors.Wrap(err, "failed to get node")
+	}
+
+	if uint32(node.FarmID) != w.farm {
+		return fmt.Errorf("node is not in farm %d", w.farm)
+	}
+
+	twin, err := w.gw.GetTwin(ctx, uint32(node.TwinID))
+	if err != nil {
+		return errors.Wrap(err, "failed to get node twin")
+	}
+
+	if !claim.Verify(twin.Account.PublicKey()) {
+		return fmt.Errorf("claim is not signed by the node")
+	}
+
+	return nil
+}
+
+// target returns the mac to wake the node with, the one learned from the node
+// self test if any or else the mac of the node zos interface
+func (w *wakeOnLan) target(node uint32, zos string) string {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if mac, ok := w.status.Peers[node]; ok {
+		return mac
+	}
+
+	return zos
+}
+
+// wake sends a magic packet to the wol target of the node
+func (w *wakeOnLan) wake(ctx context.Context, node uint32) error {
+	info, err := w.gw.GetNode(ctx, node)
+	if err != nil {
+		return errors.Wrap(err, "failed to get node")
+	}
+
+	var zos string
+	for _, inf := range info.Interfaces {
+		if inf.Name == "zos" {
+			zos = inf.Mac
+			break
+		}
+	}
+
+	mac, err := net.ParseMAC(w.target(node, zos))
+	if err != nil {
+		return fmt.Errorf("node has no wol target")
+	}
+
+	log.Debug().Uint32("node", node).Stringer("mac", mac).Msg("sending magic packet")
+	return wol.Wake("zos", mac)
+}
+
+// selfTest sends a magic packet to up to wolNeighbors farm nodes that are up
+// until one of them answers
+func (w *wakeOnLan) selfTest(ctx context.Context) {
+	result := pkg.WolTest{Time: time.Now()}
+	err := w.test(ctx, &result)
+	if err != nil {
+		result.Error = err.Error()
+		log.Error().Err(err).Msg("wol self test failed")
+	}
+
+	w.m.Lock()
+	w.status.Test = result
+	w.m.Unlock()
+
+	w.report(ctx)
+}
+
+func (w *wakeOnLan) test(ctx context.Context, result *pkg.WolTest) error {
+	status := w.Status()
+	if len(status.MAC) == 0 {
+		return fmt.Errorf("no target nic")
+	}
+
+	nodes, err := w.gw.GetNodes(ctx, w.farm)
+	if err != nil {
+		return errors.Wrap(err, "failed to list farm nodes")
+	}
+
+	tried := 0
+	for _, id := range nodes {
+		if tried == wolNeighbors {
+			break
+		}
+
+		if id == w.node {
+			continue
+		}
+
+		// a magic packet wakes nodes that are down
+		power, err := w.chain.GetNodePowerTarget(ctx, id)
+		if err != nil || !power.State.IsUp {
+			continue
+		}
+
+		node, err := w.gw.GetNode(ctx, id)
+		if err != nil {
+			continue
+		}
+
+		var mac net.HardwareAddr
+		for _, inf := range node.Interfaces {
+			if inf.Name == "zos" {
+				mac, _ = net.ParseMAC(inf.Mac)
+			}
+		}
+
+		if mac == nil {
+			continue
+		}
+
+		tried++
+		testCtx, cancel := context.WithTimeout(ctx, wolTestTimeout)
+		err = wol.Test(testCtx, status.Target, mac, w.node, w.sk)
+		cancel()
+		if err != nil {
+			log.Debug().Err(err).Uint32("node", id).Msg("wol self test neighbor didn't answer")
+			continue
+		}
+
+		result.Neighbor = id
+		return nil
+	}
+
+	if tried == 0 {
+		return fmt.Errorf("no neighbor node is up")
+	}
+
+	return fmt.Errorf("no answer from %d neighbor nodes", tried)
+}
@@ -2,15 +2,13 @@ package provisiond
 
 import (
 	"context"
-	"time"
 
-	"github.com/cenkalti/backoff/v3"
 	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
 	"github.com/rs/zerolog/log"
 	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	zosstubs "github.com/threefoldtech/zos/pkg/stubs"
 	"github.com/threefoldtech/zosbase/pkg/gridtypes"
 	"github.com/threefoldtech/zosbase/pkg/provision"
-	"github.com/threefoldtech/zosbase/pkg/stubs"
 )
 
 type DeploymentID struct {
@@ -19,16 +17,16 @@ type DeploymentID struct {
 }
 
 type CapacitySetter struct {
-	substrateGateway *stubs.SubstrateGatewayStub
-	ch               chan DeploymentID
-	storage          provision.Storage
+	extrinsics *zosstubs.ExtrinsicQueueStub
+	ch         chan DeploymentID
+	storage    provision.Storage
 }
 
-func NewCapacitySetter(substrateGateway *stubs.SubstrateGatewayStub, storage provision.Storage) CapacitySetter {
+func NewCapacitySetter(extrinsics *zosstubs.ExtrinsicQueueStub, storage provision.Storage) CapacitySetter {
 	return CapacitySetter{
-		substrateGateway: substrateGateway,
-		storage:          storage,
-		ch:               make(chan DeploymentID, 215),
+		extrinsics: extrinsics,
+		storage:    storage,
+		ch:         make(chan DeploymentID, 215),
 	}
 }
 
@@ -82,16 +80,14 @@ func (c *CapacitySetter) setWithClient(deployments ...gridtypes.Deployment) erro
 		caps = append(caps, cap)
 	}
 
-	bo := backoff.WithMaxRetries(
-		backoff.NewConstantBackOff(6*time.Second),
-		4,
-	)
+	// the api-gateway takes care of retries
+	ticket, err := c.extrinsics.SubmitContractConsumption(context.Background(), caps)
+	if err != nil {
+		return err
+	}
 
-	return backoff.RetryNotify(func() error {
-		return c.substrateGateway.SetContractConsumption(context.Background(), caps...)
-	}, bo, func(err error, d time.Duration) {
-		log.Error().Err(err).Dur("retry-in", d).Msg("failed to set contract consumption")
-	})
+	log.Debug().Uint64("ticket", ticket).Msg("contract usage queued")
+	return nil
 }
 
 func (c *CapacitySetter) Set(deployment ...gridtypes.Deployment) error {
@@ -25,6 +25,9 @@ import (
 	fsStorage "github.com/threefoldtech/zosbase/pkg/provision/storage.fs"
 	"github.com/urfave/cli/v2"
 
+	"github.com/threefoldtech/zos/pkg/egress"
+	"github.com/threefoldtech/zos/pkg/proxy"
+	zosstubs "github.com/threefoldtech/zos/pkg/stubs"
 	"github.com/threefoldtech/zosbase/pkg/stubs"
 	"github.com/threefoldtech/zosbase/pkg/utils"
 
@@ -133,6 +136,11 @@ func action(cli *cli.Context) error {
 		integrity    bool   = cli.Bool("integrity")
 	)
 
+	// zos-config (egress policy) is fetched through the proxy if any
+	if err := proxy.Setup(); err != nil {
+		return errors.Wrap(err, "failed to set up proxy")
+	}
+
 	server, err := zbus.NewRedisServer(serverName, msgBrokerCon, 1)
 	if err != nil {
 		return errors.Wrap(err, "failed to connect to message broker")
@@ -301,7 +309,7 @@ func action(cli *cli.Context) error {
 		return errors.Wrap(err, "failed to create storage for queues")
 	}
 
-	setter := NewCapacitySetter(substrateGateway, store)
+	setter := NewCapacitySetter(zosstubs.NewExtrinsicQueueStub(cl), store)
 
 	log.Info().Int("contracts", len(active)).Msg("setting used capacity by contracts")
 	if err := setter.Set(active...); err != nil {
@@ -316,9 +324,14 @@ func action(cli *cli.Context) error {
 		}
 	}()
 
+	enforcer := egress.NewEnforcer(cl, store, uint32(env.FarmID))
+	go enforcer.Run(ctx)
+
+	// the gate lets the quiescer pause the engine jobs on power off
+	jobs := newGate(statistics)
 	engine, err := provision.New(
 		store,
-		statistics,
+		jobs,
 		queues,
 		provision.WithTwins(users),
 		provision.WithAdmins(admins),
@@ -341,8 +354,12 @@ func action(cli *cli.Context) error {
 		provision.WithRerunAll(app.IsFirstBoot(serverName)),
 		// Callback when a deployment changes capacity it must
 		// be called. this one used by the setter to set used
-		// capacity on chain.
-		provision.WithCallback(setter.Callback),
+		// capacity on chain, and to update the workloads egress
+		// filters.
+		provision.WithCallback(func(twin uint32, contract uint64, delete bool) {
+			setter.Callback(twin, contract, delete)
+			enforcer.Callback(twin, contract, delete)
+		}),
 	)
 	if err != nil {
 		return errors.Wrap(err, "failed to instantiate provision engine")
@@ -400,6 +417,11 @@ func action(cli *cli.Context) error {
 		return errors.Wrap(err, "failed to setup capacity reporter")
 	}
 
+	server.Register(
+		zbus.ObjectID{Name: quiescerModule, Version: "0.0.1"},
+		&quiescer{gate: jobs, reporter: reporter},
+	)
+
 	// also spawn the capacity reporter
 	go func() {
 		defer reporter.Close()
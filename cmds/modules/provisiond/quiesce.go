@@ -0,0 +1,121 @@
+package provisiond
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/zos/pkg"
+	"github.com/threefoldtech/zosbase/pkg/gridtypes"
+	"github.com/threefoldtech/zosbase/pkg/provision"
+)
+
+const quiescerModule = "quiescer"
+
+// gate wraps the engine provisioner so the engine queue can be paused, a
+// paused gate waits for the job in flight and holds the next jobs until
+// it's released
+type gate struct {
+	provision.Provisioner
+
+	jobs sync.RWMutex
+	// m protects held
+	m    sync.Mutex
+	held bool
+}
+
+func newGate(provisioner provision.Provisioner) *gate {
+	return &gate{Provisioner: provisioner}
+}
+
+// hold pauses the jobs, it returns once the job in flight is done
+func (g *gate) hold() {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	if g.held {
+		return
+	}
+
+	g.jobs.Lock()
+	g.held = true
+}
+
+// release resumes the jobs
+func (g *gate) release() {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	if !g.held {
+		return
+	}
+
+	g.jobs.Unlock()
+	g.held = false
+}
+
+func (g *gate) Provision(ctx context.Context, wl *gridtypes.WorkloadWithID) (gridtypes.Result, error) {
+	g.jobs.RLock()
+	defer g.jobs.RUnlock()
+
+	return g.Provisioner.Provision(ctx, wl)
+}
+
+func (g *gate) Deprovision(ctx context.Context, wl *gridtypes.WorkloadWithID) error {
+	g.jobs.RLock()
+	defer g.jobs.RUnlock()
+
+	return g.Provisioner.Deprovision(ctx, wl)
+}
+
+func (g *gate) Pause(ctx context.Context, wl *gridtypes.WorkloadWithID) (gridtypes.Result, error) {
+	g.jobs.RLock()
+	defer g.jobs.RUnlock()
+
+	return g.Provisioner.Pause(ctx, wl)
+}
+
+func (g *gate) Resume(ctx context.Context, wl *gridtypes.WorkloadWithID) (gridtypes.Result, error) {
+	g.jobs.RLock()
+	defer g.jobs.RUnlock()
+
+	return g.Provisioner.Resume(ctx, wl)
+}
+
+func (g *gate) Update(ctx context.Context, wl *gridtypes.WorkloadWithID) (gridtypes.Result, error) {
+	g.jobs.RLock()
+	defer g.jobs.RUnlock()
+
+	return g.Provisioner.Update(ctx, wl)
+}
+
+// quiescer pauses the engine queue and flushes the provision state before
+// the node is powered off. The store is not closed, bolt syncs every
+// transaction and provisiond closes it when it exits.
+type quiescer struct {
+	gate     *gate
+	reporter *Reporter
+}
+
+var _ pkg.Quiescer = (*quiescer)(nil)
+
+// Quiesce implements pkg.Quiescer
+func (q *quiescer) Quiesce() error {
+	log.Info().Msg("pausing provision engine")
+	q.gate.hold()
+
+	if err := q.reporter.Flush(context.Background()); err != nil {
+		return errors.Wrap(err, "failed to flush consumption reports")
+	}
+
+	log.Info().Msg("provision state flushed")
+	return nil
+}
+
+// Resume implements pkg.Quiescer
+func (q *quiescer) Resume() error {
+	log.Info().Msg("resuming provision engine")
+	q.gate.release()
+	return nil
+}
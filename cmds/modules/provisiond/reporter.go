@@ -5,6 +5,7 @@ import (
 	"crypto/ed25519"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
@@ -13,6 +14,7 @@ import (
 	"github.com/rs/zerolog/log"
 	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
 	"github.com/threefoldtech/zbus"
+	zosstubs "github.com/threefoldtech/zos/pkg/stubs"
 	"github.com/threefoldtech/zosbase/pkg"
 	"github.com/threefoldtech/zosbase/pkg/gridtypes"
 	"github.com/threefoldtech/zosbase/pkg/rrd"
@@ -33,9 +35,12 @@ type Reporter struct {
 	cl  zbus.Client
 	rrd rrd.RRD
 
-	identity         substrate.Identity
-	queue            *dque.DQue
-	substrateGateway *stubs.SubstrateGatewayStub
+	identity   substrate.Identity
+	queue      *dque.DQue
+	extrinsics *zosstubs.ExtrinsicQueueStub
+
+	// m serializes reports and their submission with Flush
+	m sync.Mutex
 }
 
 func reportBuilder() interface{} {
@@ -79,7 +84,7 @@ func NewReporter(metricsPath string, cl zbus.Client, root string) (*Reporter, er
 		return nil, errors.Wrap(err, "failed to setup report persisted queue")
 	}
 
-	substrateGateway := stubs.NewSubstrateGatewayStub(cl)
+	extrinsics := zosstubs.NewExtrinsicQueueStub(cl)
 
 	rrd, err := rrd.NewRRDBolt(metricsPath, 5*time.Minute, 24*time.Hour)
 	if err != nil {
@@ -87,38 +92,86 @@ func NewReporter(metricsPath string, cl zbus.Client, root string) (*Reporter, er
 	}
 
 	return &Reporter{
-		cl:               cl,
-		rrd:              rrd,
-		identity:         id,
-		queue:            queue,
-		substrateGateway: substrateGateway,
+		cl:         cl,
+		rrd:        rrd,
+		identity:   id,
+		queue:      queue,
+		extrinsics: extrinsics,
 	}, nil
 }
 
 func (r *Reporter) pushOne() error {
-	item, err := r.queue.PeekBlock()
-	if err != nil {
+	// wait for a report
+	if _, err := r.queue.PeekBlock(); err != nil {
 		return errors.Wrap(err, "failed to peek into capacity queue. #properlyfatal")
 	}
 
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return r.submit()
+}
+
+// submit hands the first queued report to the api-gateway
+func (r *Reporter) submit() error {
+	item, err := r.queue.Peek()
+	if err == dque.ErrEmpty {
+		// already submitted by flush
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "failed to peek into capacity queue")
+	}
+
 	report := item.(*Report)
 
 	log.Info().Int("len", len(report.Consumption)).Msgf("sending capacity report")
 
-	hash, err := r.substrateGateway.Report(context.Background(), report.Consumption)
+	// the api-gateway persists the report and takes care of submitting it
+	ticket, err := r.extrinsics.SubmitReport(context.Background(), report.Consumption)
 	if err != nil {
-		return errors.Wrap(err, "failed to publish consumption report")
+		return errors.Wrap(err, "failed to queue consumption report")
 	}
 
-	log.Info().Str("hash", hash.Hex()).Msg("report block hash")
+	log.Info().Uint64("ticket", ticket).Msg("consumption report queued")
 
-	// only removed if report is reported to substrate
+	// only removed if report is queued by the api-gateway
 	// remove item from queue
 	_, err = r.queue.Dequeue()
 
 	return err
 }
 
+// Flush reports the consumption since the last report and hands all queued
+// reports to the api-gateway, it's called before the node is powered off
+func (r *Reporter) Flush(ctx context.Context) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	lastReport, ok, err := r.getLastReportTime()
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		ts, err := r.report(ctx, time.Unix(lastReport, 0))
+		if err != nil {
+			return errors.Wrap(err, "failed to create consumption report")
+		}
+
+		if err := r.setLastReportTime(ts.Unix()); err != nil {
+			return err
+		}
+	}
+
+	for r.queue.Size() > 0 {
+		if err := r.submit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (r *Reporter) pusher(ctx context.Context) {
 	for {
 		select {
@@ -339,19 +392,33 @@ func (r *Reporter) Run(ctx context.Context) error {
 		case <-time.After(time.Duration(delay) * time.Second):
 		}
 
-		since := time.Unix(lastReport, 0)
-		log.Debug().Time("since", since).Msg("collecting consumption since")
-		ts, err := r.report(ctx, since)
-		if err != nil {
-			return errors.Wrap(err, "failed to create consumption report")
-		}
-
-		if err := r.setLastReportTime(ts.Unix()); err != nil {
+		if err := r.reportSince(ctx); err != nil {
 			return err
 		}
 	}
 }
 
+// reportSince reports the consumption since the last report, it's read again
+// since a flush may have reported while waiting
+func (r *Reporter) reportSince(ctx context.Context) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	lastReport, _, err := r.getLastReportTime()
+	if err != nil {
+		return err
+	}
+
+	since := time.Unix(lastReport, 0)
+	log.Debug().Time("since", since).Msg("collecting consumption since")
+	ts, err := r.report(ctx, since)
+	if err != nil {
+		return errors.Wrap(err, "failed to create consumption report")
+	}
+
+	return r.setLastReportTime(ts.Unix())
+}
+
 func (r *Reporter) report(ctx context.Context, since time.Time) (time.Time, error) {
 	now := time.Now()
 	window := now.Sub(since)
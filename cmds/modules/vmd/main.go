@@ -141,6 +141,7 @@ func action(cli *cli.Context) error {
 	}
 
 	server.Register(zbus.ObjectID{Name: "manager", Version: "0.0.1"}, mod)
+	server.Register(zbus.ObjectID{Name: "shutdown", Version: "0.0.1"}, &vmShutdown{mod: mod})
 
 	ctx, _ := utils.WithSignal(context.Background())
 	utils.OnDone(ctx, func(_ error) {
@@ -0,0 +1,81 @@
+package vmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/zos/pkg"
+	"github.com/threefoldtech/zosbase/pkg/vm"
+)
+
+// socketDir is where cloud-hypervisor api sockets of the vms are
+const socketDir = "/var/run/cloud-hypervisor"
+
+// vmShutdown stops the vms gracefully before the node powers off
+type vmShutdown struct {
+	mod *vm.Module
+}
+
+var _ pkg.VMShutdown = (*vmShutdown)(nil)
+
+// Shutdown implements pkg.VMShutdown
+func (s *vmShutdown) Shutdown(name string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := powerButton(ctx, name); err != nil {
+		log.Error().Err(err).Str("vm", name).Msg("failed to press vm power button")
+	} else {
+		// the guest exits cloud-hypervisor once it's off
+		for s.mod.Exists(name) && ctx.Err() == nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+		}
+	}
+
+	if ctx.Err() != nil {
+		log.Warn().Str("vm", name).Msg("vm didn't power off in time, forcing it off")
+	}
+
+	// delete makes sure the monitor doesn't boot the vm again, it kills the
+	// vm if it's still running
+	return s.mod.Delete(name)
+}
+
+// powerButton sends an acpi power button event to the vm guest
+func powerButton(ctx context.Context, name string) error {
+	socket := filepath.Join(socketDir, name)
+	client := http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPut, "http://localhost/api/v1/vm.power-button", nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return errors.Wrap(err, "failed to call cloud-hypervisor api")
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusNoContent && response.StatusCode != http.StatusOK {
+		return fmt.Errorf("cloud-hypervisor api returned '%s'", response.Status)
+	}
+
+	return nil
+}
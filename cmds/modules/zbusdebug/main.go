@@ -8,6 +8,7 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/threefoldtech/zbus"
+	"github.com/threefoldtech/zos/pkg/stubs"
 	"github.com/urfave/cli/v2"
 	"gopkg.in/yaml.v2"
 
@@ -19,16 +20,18 @@ var (
 	// the module name declared by the server. Hence, we collect them here for
 	// validation
 	PossibleModules = map[string]struct{}{
-		"storage":   {},
-		"node":      {},
-		"identityd": {},
-		"vmd":       {},
-		"flist":     {},
-		"network":   {},
-		"container": {},
-		"provision": {},
-		"gateway":   {},
-		"qsfsd":     {},
+		"storage":     {},
+		"node":        {},
+		"identityd":   {},
+		"vmd":         {},
+		"flist":       {},
+		"network":     {},
+		"container":   {},
+		"provision":   {},
+		"gateway":     {},
+		"qsfsd":       {},
+		"api-gateway": {},
+		"power":       {},
 	}
 
 	//Module entry point
@@ -45,6 +48,26 @@ var (
 				Name:  "module",
 				Usage: "debug specific `MODULE`",
 			},
+			&cli.BoolFlag{
+				Name:  "substrate",
+				Usage: "show health of substrate endpoints used by the api-gateway",
+			},
+			&cli.BoolFlag{
+				Name:  "rmb",
+				Usage: "show recent rmb calls served by the api-gateway",
+			},
+			&cli.BoolFlag{
+				Name:  "network-gc",
+				Usage: "show orphaned network objects pending and removed by networkd",
+			},
+			&cli.BoolFlag{
+				Name:  "uptime",
+				Usage: "show uptime reports sent by powerd and the samples pending report",
+			},
+			&cli.BoolFlag{
+				Name:  "wol",
+				Usage: "show wake on lan state of the nics and the last self test",
+			},
 		},
 		Action: action,
 	}
@@ -54,6 +77,11 @@ func action(cli *cli.Context) error {
 	var (
 		msgBrokerCon string = cli.String("broker")
 		module       string = cli.String("module")
+		substrate    bool   = cli.Bool("substrate")
+		rmb          bool   = cli.Bool("rmb")
+		networkGC    bool   = cli.Bool("network-gc")
+		uptime       bool   = cli.Bool("uptime")
+		wakeOnLan    bool   = cli.Bool("wol")
 	)
 
 	cl, err := zbus.NewRedisClient(msgBrokerCon)
@@ -61,6 +89,26 @@ func action(cli *cli.Context) error {
 		return errors.Wrap(err, "failed to initialize zbus client")
 	}
 
+	if substrate {
+		return printSubstrateHealth(cli.Context, cl)
+	}
+
+	if rmb {
+		return printRMBCalls(cli.Context, cl)
+	}
+
+	if networkGC {
+		return printNetworkGC(cli.Context, cl)
+	}
+
+	if uptime {
+		return printUptime(cli.Context, cl)
+	}
+
+	if wakeOnLan {
+		return printWakeOnLan(cli.Context, cl)
+	}
+
 	var debug []string
 	if module != "" {
 		_, ok := PossibleModules[module]
@@ -103,3 +151,113 @@ func printModuleStatus(ctx context.Context, cl zbus.Client, module string) error
 	fmt.Println()
 	return nil
 }
+
+func printSubstrateHealth(ctx context.Context, cl zbus.Client) (err error) {
+	fmt.Println("## Substrate endpoints")
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	// stubs panic on errors
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("%v", p)
+		}
+	}()
+
+	endpoints := stubs.NewSubstrateHealthStub(cl).Endpoints(ctx)
+
+	enc := yaml.NewEncoder(os.Stdout)
+	defer enc.Close()
+
+	return enc.Encode(endpoints)
+}
+
+func printRMBCalls(ctx context.Context, cl zbus.Client) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	// stubs panic on errors
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("%v", p)
+		}
+	}()
+
+	tracer := stubs.NewRMBTracerStub(cl)
+
+	enc := yaml.NewEncoder(os.Stdout)
+	defer enc.Close()
+
+	fmt.Println("## RMB commands")
+	if err := enc.Encode(tracer.Stats(ctx)); err != nil {
+		return err
+	}
+
+	fmt.Println("## Recent RMB calls")
+	return enc.Encode(tracer.Recent(ctx))
+}
+
+func printNetworkGC(ctx context.Context, cl zbus.Client) (err error) {
+	fmt.Println("## Network garbage collector")
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	// stubs panic on errors
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("%v", p)
+		}
+	}()
+
+	status := stubs.NewNetworkGCStub(cl).Status(ctx)
+
+	enc := yaml.NewEncoder(os.Stdout)
+	defer enc.Close()
+
+	return enc.Encode(status)
+}
+
+func printUptime(ctx context.Context, cl zbus.Client) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	// stubs panic on errors
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("%v", p)
+		}
+	}()
+
+	history := stubs.NewUptimeHistoryStub(cl)
+
+	enc := yaml.NewEncoder(os.Stdout)
+	defer enc.Close()
+
+	fmt.Println("## Pending uptime samples")
+	if err := enc.Encode(history.Pending(ctx)); err != nil {
+		return err
+	}
+
+	fmt.Println("## Uptime reports")
+	return enc.Encode(history.Reports(ctx))
+}
+
+func printWakeOnLan(ctx context.Context, cl zbus.Client) (err error) {
+	fmt.Println("## Wake on lan")
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	// stubs panic on errors
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("%v", p)
+		}
+	}()
+
+	status := stubs.NewWakeOnLanStub(cl).Status(ctx)
+
+	enc := yaml.NewEncoder(os.Stdout)
+	defer enc.Close()
+
+	return enc.Encode(status)
+}
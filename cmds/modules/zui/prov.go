@@ -21,12 +21,14 @@ const (
 func resourcesRender(client zbus.Client, grid *ui.Grid, render *signalFlag) error {
 	prov := widgets.NewTable()
 	usage := widgets.NewTable()
+	rmb := widgets.NewTable()
 	prov.FillRow = true
 
 	grid.Set(
 		ui.NewRow(1.0,
-			ui.NewCol(.6, prov),
-			ui.NewCol(.4, usage),
+			ui.NewCol(.4, prov),
+			ui.NewCol(.2, usage),
+			ui.NewCol(.4, rmb),
 		),
 	)
 
@@ -38,6 +40,8 @@ func resourcesRender(client zbus.Client, grid *ui.Grid, render *signalFlag) erro
 		return errors.Wrap(err, "failed to render system resources usage")
 	}
 
+	rmbRender(client, render, rmb)
+
 	return nil
 }
 
@@ -0,0 +1,72 @@
+package zui
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gizak/termui/v3/widgets"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/zbus"
+	zosstubs "github.com/threefoldtech/zos/pkg/stubs"
+)
+
+// rmbCalls is the number of recent rmb calls shown
+const rmbCalls = 5
+
+// rmbRender shows the last rmb calls served by the node
+func rmbRender(client zbus.Client, render *signalFlag, table *widgets.Table) {
+	table.Title = "RMB"
+	table.RowSeparator = false
+	table.FillRow = true
+
+	table.Rows = [][]string{
+		{loading, ""},
+	}
+
+	tracer := zosstubs.NewRMBTracerStub(client)
+
+	go func() {
+		for {
+			rows, err := rmbRows(tracer)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to get recent rmb calls")
+			} else {
+				table.Rows = rows
+				render.Signal()
+			}
+
+			<-time.After(5 * time.Second)
+		}
+	}()
+}
+
+func rmbRows(tracer *zosstubs.RMBTracerStub) (rows [][]string, err error) {
+	// stubs panic on errors
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("%v", p)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	calls := tracer.Recent(ctx)
+	if len(calls) == 0 {
+		return [][]string{{"No calls yet", ""}}, nil
+	}
+
+	if len(calls) > rmbCalls {
+		calls = calls[:rmbCalls]
+	}
+
+	for _, call := range calls {
+		rows = append(rows, []string{
+			fmt.Sprintf("%d %s", call.Twin, call.Command),
+			fmt.Sprintf("%s %s", call.Result, call.Duration.Round(time.Millisecond)),
+		})
+	}
+
+	return rows, nil
+}
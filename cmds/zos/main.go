@@ -11,6 +11,7 @@ import (
 	"github.com/threefoldtech/zos/cmds/modules/contd"
 	"github.com/threefoldtech/zos/cmds/modules/flistd"
 	"github.com/threefoldtech/zos/cmds/modules/gateway"
+	"github.com/threefoldtech/zos/cmds/modules/metricsd"
 	"github.com/threefoldtech/zos/cmds/modules/networkd"
 	"github.com/threefoldtech/zos/cmds/modules/noded"
 	"github.com/threefoldtech/zos/cmds/modules/powerd"
@@ -58,6 +59,7 @@ func main() {
 			&qsfsd.Module,
 			&powerd.Module,
 			&apigateway.Module,
+			&metricsd.Module,
 		},
 		Before: func(c *cli.Context) error {
 			if c.Bool("debug") {
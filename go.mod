@@ -7,6 +7,7 @@ require (
 	github.com/cenkalti/backoff v2.2.1+incompatible
 	github.com/cenkalti/backoff/v3 v3.2.2
 	github.com/centrifuge/go-substrate-rpc-client/v4 v4.2.1
+	github.com/containernetworking/plugins v1.2.0
 	github.com/gizak/termui/v3 v3.1.0
 	github.com/go-redis/redis v6.15.9+incompatible
 	github.com/joncrlsn/dque v0.0.0-20200702023911-3e80e3146ce5
@@ -35,7 +36,6 @@ require (
 	github.com/containerd/fifo v1.1.0 // indirect
 	github.com/containerd/ttrpc v1.2.7 // indirect
 	github.com/containernetworking/cni v1.1.2 // indirect
-	github.com/containernetworking/plugins v1.2.0 // indirect
 	github.com/dave/jennifer v1.3.0 // indirect
 	github.com/deckarep/golang-set v1.8.0 // indirect
 	github.com/decred/base58 v1.0.6 // indirect
@@ -0,0 +1,14 @@
+package pkg
+
+import (
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+)
+
+//go:generate zbusc -module api-gateway -version 0.0.1 -name chain-reader -package stubs github.com/threefoldtech/zos/pkg+ChainReader stubs/chain_reader_stub.go
+
+// ChainReader reads the chain state the substrate gateway doesn't expose
+type ChainReader interface {
+	// GetNodePowerTarget returns the power state and target of any node, the
+	// substrate gateway only returns the ones of this node
+	GetNodePowerTarget(node uint32) (substrate.NodePower, error)
+}
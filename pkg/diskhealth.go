@@ -0,0 +1,39 @@
+package pkg
+
+import "time"
+
+//go:generate zbusc -module node -version 0.0.1 -name disk-health -package stubs github.com/threefoldtech/zos/pkg+DiskHealthMonitor stubs/disk_health_stub.go
+
+// DiskHealth is the last known SMART health of a disk
+type DiskHealth struct {
+	Path   string `json:"path"`
+	Model  string `json:"model"`
+	Serial string `json:"serial"`
+	// Passed is the overall SMART self assessment of the disk
+	Passed bool `json:"passed"`
+	// ReallocatedSectors is the number of sectors that were remapped
+	ReallocatedSectors uint64 `json:"reallocated_sectors"`
+	// PendingSectors is the number of unstable sectors waiting to be remapped
+	PendingSectors uint64 `json:"pending_sectors"`
+	// MediaErrors is the number of unrecovered data integrity errors (nvme)
+	MediaErrors uint64 `json:"media_errors"`
+	// WearLevel is the estimated percentage of the disk endurance used (ssd only)
+	WearLevel    uint64 `json:"wear_level"`
+	Temperature  uint64 `json:"temperature"`
+	PowerOnHours uint64 `json:"power_on_hours"`
+	// Warnings are human readable warnings about the disk health, empty if disk is healthy
+	Warnings []string  `json:"warnings"`
+	Error    string    `json:"error"`
+	Checked  time.Time `json:"checked"`
+}
+
+// Healthy returns true if disk has no warnings
+func (d *DiskHealth) Healthy() bool {
+	return len(d.Warnings) == 0 && len(d.Error) == 0
+}
+
+// DiskHealthMonitor interface
+type DiskHealthMonitor interface {
+	// Health returns last known health of all node disks
+	Health() []DiskHealth
+}
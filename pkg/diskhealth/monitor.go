@@ -0,0 +1,237 @@
+package diskhealth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/zbus"
+	"github.com/threefoldtech/zos/pkg"
+	"github.com/threefoldtech/zosbase/pkg/stubs"
+)
+
+const (
+	// zuiLabel is the label used to push disk warnings to zui
+	zuiLabel = "disk-health"
+
+	// reallocatedThreshold is the number of reallocated sectors after which
+	// we always warn, even if the count is not growing
+	reallocatedThreshold = 100
+	// wearThreshold is the percentage of ssd endurance used after which we warn
+	wearThreshold = 90
+
+	// baselineFile is where the disks baseline is persisted in the module root
+	baselineFile = "disk-health-baseline.json"
+)
+
+var _ pkg.DiskHealthMonitor = (*Monitor)(nil)
+
+// Monitor periodically checks the SMART health of all devices
+// known by the storage module
+type Monitor struct {
+	cl       zbus.Client
+	root     string
+	interval time.Duration
+
+	m      sync.RWMutex
+	health map[string]pkg.DiskHealth
+	// baseline is the first health seen for each disk, by serial. It's
+	// persisted in root and used to detect degradation of the disk
+	baseline map[string]pkg.DiskHealth
+}
+
+// NewMonitor creates a new disk health monitor that checks all disks every
+// interval, the disks baseline is kept in root
+func NewMonitor(cl zbus.Client, root string, interval time.Duration) *Monitor {
+	m := &Monitor{
+		cl:       cl,
+		root:     root,
+		interval: interval,
+		health:   make(map[string]pkg.DiskHealth),
+		baseline: make(map[string]pkg.DiskHealth),
+	}
+
+	if err := m.load(); err != nil {
+		log.Error().Err(err).Msg("failed to load disk health baseline")
+	}
+
+	return m
+}
+
+// key identifies a disk in the baseline, the path of a disk can change
+// between boots
+func key(h pkg.DiskHealth) string {
+	if len(h.Serial) != 0 {
+		return h.Serial
+	}
+
+	return h.Path
+}
+
+func (m *Monitor) load() error {
+	data, err := os.ReadFile(filepath.Join(m.root, baselineFile))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, &m.baseline)
+}
+
+func (m *Monitor) save() error {
+	if err := os.MkdirAll(m.root, 0755); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(m.baseline)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(m.root, baselineFile)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return errors.Wrap(err, "failed to write disk health baseline")
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+// baselineOf returns the baseline of the disk, the current health becomes
+// the baseline of disks that are seen for the first time
+func (m *Monitor) baselineOf(h pkg.DiskHealth) pkg.DiskHealth {
+	baseline, ok := m.baseline[key(h)]
+	if ok {
+		return baseline
+	}
+
+	m.baseline[key(h)] = h
+	if err := m.save(); err != nil {
+		log.Error().Err(err).Msg("failed to save disk health baseline")
+	}
+
+	return h
+}
+
+// Health implements pkg.DiskHealthMonitor
+func (m *Monitor) Health() []pkg.DiskHealth {
+	m.m.RLock()
+	defer m.m.RUnlock()
+
+	result := make([]pkg.DiskHealth, 0, len(m.health))
+	for _, h := range m.health {
+		result = append(result, h)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Path < result[j].Path
+	})
+
+	return result
+}
+
+// Run runs the monitor until context is cancelled. Run must only be called once
+func (m *Monitor) Run(ctx context.Context) {
+	if _, err := exec.LookPath("smartctl"); err != nil {
+		const msg = "smartctl is not available, disk health monitoring is disabled"
+		log.Error().Err(err).Msg(msg)
+		if err := stubs.NewZUIStub(m.cl).PushErrors(ctx, zuiLabel, []string{msg}); err != nil {
+			log.Error().Err(err).Msg("failed to push disk health warnings to zui")
+		}
+		return
+	}
+
+	for {
+		m.check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(m.interval):
+		}
+	}
+}
+
+func (m *Monitor) check(ctx context.Context) {
+	storage := stubs.NewStorageModuleStub(m.cl)
+	devices, err := storage.Devices(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list storage devices")
+		return
+	}
+
+	current := make(map[string]pkg.DiskHealth)
+	var warnings []string
+	for _, device := range devices {
+		var h pkg.DiskHealth
+		out, err := read(ctx, device.Path)
+		if err != nil {
+			log.Debug().Err(err).Str("device", device.Path).Msg("failed to read disk smart information")
+			h = pkg.DiskHealth{Path: device.Path, Passed: true, Error: err.Error()}
+		} else {
+			h = health(device.Path, out)
+			h.Warnings = evaluate(m.baselineOf(h), h)
+		}
+
+		h.Checked = time.Now()
+		current[device.Path] = h
+
+		for _, warning := range h.Warnings {
+			log.Warn().Str("device", h.Path).Str("serial", h.Serial).Msg(warning)
+			warnings = append(warnings, fmt.Sprintf("%s: %s", h.Path, warning))
+		}
+	}
+
+	m.m.Lock()
+	m.health = current
+	m.m.Unlock()
+
+	// this also clears the errors if all disks are healthy
+	zui := stubs.NewZUIStub(m.cl)
+	if err := zui.PushErrors(ctx, zuiLabel, warnings); err != nil {
+		log.Error().Err(err).Msg("failed to push disk health warnings to zui")
+	}
+}
+
+// evaluate returns the warnings of the current disk health compared to
+// its baseline state
+func evaluate(baseline, current pkg.DiskHealth) []string {
+	var warnings []string
+	if !current.Passed {
+		warnings = append(warnings, "SMART self assessment failed, disk failure is imminent")
+	}
+
+	if current.PendingSectors > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d sectors pending reallocation", current.PendingSectors))
+	}
+
+	if current.ReallocatedSectors > baseline.ReallocatedSectors {
+		warnings = append(warnings, fmt.Sprintf(
+			"reallocated sectors increased from %d to %d",
+			baseline.ReallocatedSectors, current.ReallocatedSectors,
+		))
+	} else if current.ReallocatedSectors >= reallocatedThreshold {
+		warnings = append(warnings, fmt.Sprintf("%d sectors reallocated", current.ReallocatedSectors))
+	}
+
+	if current.MediaErrors > baseline.MediaErrors {
+		warnings = append(warnings, fmt.Sprintf(
+			"media errors increased from %d to %d",
+			baseline.MediaErrors, current.MediaErrors,
+		))
+	}
+
+	if current.WearLevel >= wearThreshold {
+		warnings = append(warnings, fmt.Sprintf("%d%% of disk endurance is used", current.WearLevel))
+	}
+
+	return warnings
+}
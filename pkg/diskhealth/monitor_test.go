@@ -0,0 +1,151 @@
+package diskhealth
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/threefoldtech/zos/pkg"
+)
+
+func TestEvaluate(t *testing.T) {
+	cases := []struct {
+		name     string
+		baseline pkg.DiskHealth
+		current  pkg.DiskHealth
+		warnings []string
+	}{
+		{
+			name:     "healthy",
+			baseline: pkg.DiskHealth{Passed: true},
+			current:  pkg.DiskHealth{Passed: true},
+		},
+		{
+			name:     "failed",
+			baseline: pkg.DiskHealth{Passed: true},
+			current:  pkg.DiskHealth{Passed: false},
+			warnings: []string{"SMART self assessment failed, disk failure is imminent"},
+		},
+		{
+			name:     "pending",
+			baseline: pkg.DiskHealth{Passed: true},
+			current:  pkg.DiskHealth{Passed: true, PendingSectors: 2},
+			warnings: []string{"2 sectors pending reallocation"},
+		},
+		{
+			name:     "reallocated growing",
+			baseline: pkg.DiskHealth{Passed: true, ReallocatedSectors: 1},
+			current:  pkg.DiskHealth{Passed: true, ReallocatedSectors: 3},
+			warnings: []string{"reallocated sectors increased from 1 to 3"},
+		},
+		{
+			name:     "reallocated stable under threshold",
+			baseline: pkg.DiskHealth{Passed: true, ReallocatedSectors: 10},
+			current:  pkg.DiskHealth{Passed: true, ReallocatedSectors: 10},
+		},
+		{
+			name:     "reallocated stable over threshold",
+			baseline: pkg.DiskHealth{Passed: true, ReallocatedSectors: 150},
+			current:  pkg.DiskHealth{Passed: true, ReallocatedSectors: 150},
+			warnings: []string{"150 sectors reallocated"},
+		},
+		{
+			name:     "media errors",
+			baseline: pkg.DiskHealth{Passed: true, MediaErrors: 0},
+			current:  pkg.DiskHealth{Passed: true, MediaErrors: 4},
+			warnings: []string{"media errors increased from 0 to 4"},
+		},
+		{
+			name:     "worn",
+			baseline: pkg.DiskHealth{Passed: true},
+			current:  pkg.DiskHealth{Passed: true, WearLevel: 95},
+			warnings: []string{"95% of disk endurance is used"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			warnings := evaluate(c.baseline, c.current)
+			if !reflect.DeepEqual(warnings, c.warnings) {
+				t.Fatalf("expected %v got %v", c.warnings, warnings)
+			}
+		})
+	}
+}
+
+func TestHealth(t *testing.T) {
+	cases := []struct {
+		name     string
+		output   string
+		expected pkg.DiskHealth
+	}{
+		{
+			name: "ata",
+			output: `{
+				"model_name": "ST4000",
+				"serial_number": "Z1",
+				"smart_status": {"passed": true},
+				"temperature": {"current": 35},
+				"power_on_time": {"hours": 1000},
+				"ata_smart_attributes": {"table": [
+					{"id": 5, "value": 100, "raw": {"value": 8}},
+					{"id": 197, "value": 100, "raw": {"value": 1}},
+					{"id": 177, "value": 80, "raw": {"value": 120}}
+				]}
+			}`,
+			expected: pkg.DiskHealth{
+				Path: "/dev/sda", Model: "ST4000", Serial: "Z1", Passed: true,
+				Temperature: 35, PowerOnHours: 1000,
+				ReallocatedSectors: 8, PendingSectors: 1, WearLevel: 20,
+			},
+		},
+		{
+			name: "nvme",
+			output: `{
+				"model_name": "NVMe",
+				"serial_number": "N1",
+				"smart_status": {"passed": false},
+				"nvme_smart_health_information_log": {"percentage_used": 7, "media_errors": 2}
+			}`,
+			expected: pkg.DiskHealth{
+				Path: "/dev/sda", Model: "NVMe", Serial: "N1", Passed: false,
+				WearLevel: 7, MediaErrors: 2,
+			},
+		},
+		{
+			name:     "no smart status",
+			output:   `{"serial_number": "U1"}`,
+			expected: pkg.DiskHealth{Path: "/dev/sda", Serial: "U1", Passed: true},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var out smartOutput
+			if err := json.Unmarshal([]byte(c.output), &out); err != nil {
+				t.Fatal(err)
+			}
+
+			if h := health("/dev/sda", out); !reflect.DeepEqual(h, c.expected) {
+				t.Fatalf("expected %+v got %+v", c.expected, h)
+			}
+		})
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	root := t.TempDir()
+	m := NewMonitor(nil, root, 0)
+
+	first := pkg.DiskHealth{Path: "/dev/sda", Serial: "Z1", ReallocatedSectors: 1}
+	if baseline := m.baselineOf(first); baseline.ReallocatedSectors != 1 {
+		t.Fatalf("unexpected baseline %+v", baseline)
+	}
+
+	// the disk got another path after a reboot
+	reopened := NewMonitor(nil, root, 0)
+	later := pkg.DiskHealth{Path: "/dev/sdb", Serial: "Z1", ReallocatedSectors: 5}
+	if baseline := reopened.baselineOf(later); baseline.ReallocatedSectors != 1 {
+		t.Fatalf("expected persisted baseline got %+v", baseline)
+	}
+}
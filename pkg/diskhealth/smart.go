@@ -0,0 +1,120 @@
+package diskhealth
+
+import (
+	"context"
+	"encoding/json"
+	"os/exec"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/zos/pkg"
+)
+
+// ata smart attributes ids
+const (
+	attrReallocatedSectors = 5
+	attrWearLevelingCount  = 177
+	attrPendingSectors     = 197
+	attrSSDLifeLeft        = 231
+	attrMediaWearout       = 233
+)
+
+type smartAttribute struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Value uint64 `json:"value"`
+	Raw   struct {
+		Value uint64 `json:"value"`
+	} `json:"raw"`
+}
+
+type smartOutput struct {
+	ModelName    string `json:"model_name"`
+	SerialNumber string `json:"serial_number"`
+	SmartStatus  *struct {
+		Passed bool `json:"passed"`
+	} `json:"smart_status"`
+	Temperature struct {
+		Current uint64 `json:"current"`
+	} `json:"temperature"`
+	PowerOnTime struct {
+		Hours uint64 `json:"hours"`
+	} `json:"power_on_time"`
+	ATASmartAttributes struct {
+		Table []smartAttribute `json:"table"`
+	} `json:"ata_smart_attributes"`
+	// smartctl already takes the nvme critical warning into
+	// account in smart_status
+	NVMeHealth *struct {
+		PercentageUsed uint64 `json:"percentage_used"`
+		MediaErrors    uint64 `json:"media_errors"`
+	} `json:"nvme_smart_health_information_log"`
+	Smartctl struct {
+		Messages []struct {
+			String   string `json:"string"`
+			Severity string `json:"severity"`
+		} `json:"messages"`
+	} `json:"smartctl"`
+}
+
+// read reads smart information of the device at path
+func read(ctx context.Context, path string) (smartOutput, error) {
+	var out smartOutput
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	// smartctl exit code is a bit mask of the device status, so a
+	// non zero exit code is not an error as long as we have output
+	output, err := exec.CommandContext(ctx, "smartctl", "--json", "-a", path).Output()
+	if err != nil && len(output) == 0 {
+		return out, errors.Wrapf(err, "failed to run smartctl on '%s'", path)
+	}
+
+	if err := json.Unmarshal(output, &out); err != nil {
+		return out, errors.Wrap(err, "failed to parse smartctl output")
+	}
+
+	if out.SmartStatus == nil {
+		for _, msg := range out.Smartctl.Messages {
+			if msg.Severity == "error" {
+				return out, errors.Errorf("smartctl: %s", msg.String)
+			}
+		}
+	}
+
+	return out, nil
+}
+
+// health extracts the disk health from smartctl output
+func health(path string, out smartOutput) pkg.DiskHealth {
+	h := pkg.DiskHealth{
+		Path:         path,
+		Model:        out.ModelName,
+		Serial:       out.SerialNumber,
+		Passed:       out.SmartStatus == nil || out.SmartStatus.Passed,
+		Temperature:  out.Temperature.Current,
+		PowerOnHours: out.PowerOnTime.Hours,
+	}
+
+	for _, attr := range out.ATASmartAttributes.Table {
+		switch attr.ID {
+		case attrReallocatedSectors:
+			h.ReallocatedSectors = attr.Raw.Value
+		case attrPendingSectors:
+			h.PendingSectors = attr.Raw.Value
+		case attrWearLevelingCount, attrSSDLifeLeft, attrMediaWearout:
+			// normalized value is the remaining life in percent
+			if attr.Value <= 100 {
+				h.WearLevel = max(h.WearLevel, 100-attr.Value)
+			}
+		}
+	}
+
+	if nvme := out.NVMeHealth; nvme != nil {
+		h.WearLevel = nvme.PercentageUsed
+		h.MediaErrors = nvme.MediaErrors
+	}
+
+	return h
+}
@@ -0,0 +1,319 @@
+package egress
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/zbus"
+	"github.com/threefoldtech/zos/pkg/hostfw"
+	"github.com/threefoldtech/zosbase/pkg/gridtypes"
+	"github.com/threefoldtech/zosbase/pkg/gridtypes/zos"
+	"github.com/threefoldtech/zosbase/pkg/provision"
+	"github.com/threefoldtech/zosbase/pkg/stubs"
+)
+
+const (
+	// netnsDir is where named network namespaces are mounted
+	netnsDir = "/var/run/netns"
+	// vmdDir is where vmd keeps the config of the running vms
+	vmdDir = "/var/run/cache/vmd"
+)
+
+// Enforcer applies the egress policy to the twins workloads.
+//
+// The private ipv4 traffic of the workloads is filtered in the network
+// resources namespaces. The public ip, planetary and mycelium interfaces are
+// vm taps bridged on the host, their traffic is filtered in the host bridge
+// forward chain matched on the tap name.
+type Enforcer struct {
+	cl      zbus.Client
+	storage provision.Storage
+	farm    uint32
+	// ch wakes up Run when twins are added to pending
+	ch chan struct{}
+
+	m       sync.Mutex
+	policy  Policy
+	pending map[uint32]struct{}
+	// host are the host taps rules of each twin
+	host map[uint32][]hostfw.Rule
+}
+
+// NewEnforcer creates a new egress enforcer for the workloads of the farm
+func NewEnforcer(cl zbus.Client, storage provision.Storage, farm uint32) *Enforcer {
+	return &Enforcer{
+		cl:      cl,
+		storage: storage,
+		farm:    farm,
+		ch:      make(chan struct{}, 1),
+		pending: make(map[uint32]struct{}),
+		host:    make(map[uint32][]hostfw.Rule),
+	}
+}
+
+// Callback is the provision engine callback, it must be called when a
+// deployment changes. It never blocks, changes of a twin that is already
+// pending are applied once.
+func (e *Enforcer) Callback(twin uint32, contract uint64, delete bool) {
+	e.m.Lock()
+	e.pending[twin] = struct{}{}
+	e.m.Unlock()
+
+	select {
+	case e.ch <- struct{}{}:
+	default:
+	}
+}
+
+// Run enforces the policy on the twins that changed until the context is
+// cancelled. Every 10 minutes the policy is loaded from zos-config and all
+// twins are reconciled, so namespaces and taps that were missing or recreated
+// since get their rules.
+func (e *Enforcer) Run(ctx context.Context) {
+	e.refresh(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-e.ch:
+			e.reconcile(ctx, e.take())
+		case <-time.After(10 * time.Minute):
+			e.refresh(ctx)
+		}
+	}
+}
+
+// take returns the pending twins and clears them
+func (e *Enforcer) take() []uint32 {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	twins := make([]uint32, 0, len(e.pending))
+	for twin := range e.pending {
+		twins = append(twins, twin)
+	}
+	e.pending = make(map[uint32]struct{})
+
+	return twins
+}
+
+func (e *Enforcer) refresh(ctx context.Context) {
+	config, err := Load()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to load egress policy")
+		return
+	}
+
+	policy := config.For(e.farm)
+
+	e.m.Lock()
+	changed := !reflect.DeepEqual(policy, e.policy)
+	e.policy = policy
+	e.m.Unlock()
+
+	if changed {
+		log.Info().Bool("enabled", policy.Enabled).Msg("egress policy changed")
+	}
+
+	twins, err := e.storage.Twins()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list twins")
+		return
+	}
+
+	e.reconcile(ctx, twins)
+}
+
+// reconcile enforces the policy on the twins, then applies the host taps
+// rules of all twins
+func (e *Enforcer) reconcile(ctx context.Context, twins []uint32) {
+	for _, twin := range twins {
+		if err := e.enforce(ctx, twin); err != nil {
+			log.Error().Err(err).Uint32("twin", twin).Msg("failed to enforce egress policy")
+		}
+	}
+
+	e.m.Lock()
+	ids := make([]uint32, 0, len(e.host))
+	for twin := range e.host {
+		ids = append(ids, twin)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var rules []hostfw.Rule
+	for _, twin := range ids {
+		rules = append(rules, e.host[twin]...)
+	}
+	e.m.Unlock()
+
+	if err := hostfw.Apply(ctx, hostfw.HostNamespace, HostRuleset(rules)); err != nil {
+		log.Error().Err(err).Msg("failed to apply egress policy of host taps")
+	}
+}
+
+// enforce applies the policy in all the networks of the twin
+func (e *Enforcer) enforce(ctx context.Context, twin uint32) error {
+	e.m.Lock()
+	policy := e.policy
+	e.m.Unlock()
+
+	contracts, err := e.storage.ByTwin(twin)
+	if err != nil {
+		return errors.Wrap(err, "failed to list twin deployments")
+	}
+
+	ranges := make(map[gridtypes.Name]string)
+	workloads := make(map[gridtypes.Name][]Workload)
+	var host []hostfw.Rule
+	for _, contract := range contracts {
+		deployment, err := e.storage.Get(twin, contract)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get deployment '%d'", contract)
+		}
+
+		for i := range deployment.Workloads {
+			wl := &deployment.Workloads[i]
+			if !wl.Result.State.IsOkay() {
+				continue
+			}
+
+			switch wl.Type {
+			case zos.NetworkType:
+				var network zos.Network
+				if err := json.Unmarshal(wl.Data, &network); err != nil {
+					return errors.Wrapf(err, "failed to decode network '%s'", wl.Name)
+				}
+				ranges[wl.Name] = network.NetworkIPRange.String()
+			case zos.ZMachineType:
+				var vm zos.ZMachine
+				if err := json.Unmarshal(wl.Data, &vm); err != nil {
+					return errors.Wrapf(err, "failed to decode zmachine '%s'", wl.Name)
+				}
+
+				id, _ := gridtypes.NewWorkloadID(twin, contract, wl.Name)
+				exception := ParseException(wl.Metadata)
+				for _, inf := range vm.Network.Interfaces {
+					workloads[inf.Network] = append(workloads[inf.Network], Workload{
+						ID:        string(id),
+						IP:        inf.IP.String(),
+						Exception: exception,
+					})
+				}
+
+				taps, err := hostTaps(id, &vm)
+				if err != nil {
+					log.Error().Err(err).Str("workload", string(id)).Msg("failed to get vm host taps")
+				}
+
+				for _, tap := range taps {
+					host = append(host, policy.Rules(Workload{
+						ID:        string(id),
+						Tap:       tap,
+						Exception: exception,
+					})...)
+				}
+			}
+		}
+	}
+
+	e.m.Lock()
+	if len(host) != 0 {
+		e.host[twin] = host
+	} else {
+		delete(e.host, twin)
+	}
+	e.m.Unlock()
+
+	networker := stubs.NewNetworkerStub(e.cl)
+	for name, network := range ranges {
+		var rules []hostfw.Rule
+		for _, wl := range workloads[name] {
+			wl.Network = network
+			rules = append(rules, policy.Rules(wl)...)
+		}
+
+		ns := networker.Namespace(ctx, zos.NetworkID(twin, name))
+		if _, err := os.Stat(filepath.Join(netnsDir, ns)); os.IsNotExist(err) {
+			// network resource is not created yet or is already deleted
+			continue
+		}
+
+		if err := hostfw.Apply(ctx, ns, Ruleset(rules)); err != nil {
+			return errors.Wrapf(err, "failed to apply egress policy of network '%s'", name)
+		}
+	}
+
+	return nil
+}
+
+// hostTaps returns the taps of the vm that are bridged on the host. vmd
+// config has the private networks taps first, followed by the public ip and
+// overlay taps. It's empty if the vm is not running.
+func hostTaps(id gridtypes.WorkloadID, vm *zos.ZMachine) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(vmdDir, string(id)))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to read vm config")
+	}
+
+	var config struct {
+		Interfaces []struct {
+			Tap string `json:"tap"`
+		} `json:"interfaces"`
+	}
+
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, errors.Wrap(err, "failed to decode vm config")
+	}
+
+	var taps []string
+	for i, inf := range config.Interfaces {
+		if i < len(vm.Network.Interfaces) || len(inf.Tap) == 0 {
+			continue
+		}
+		taps = append(taps, inf.Tap)
+	}
+
+	return taps, nil
+}
+
+// Ruleset is the egress ruleset of a network resource namespace
+func Ruleset(rules []hostfw.Rule) hostfw.Ruleset {
+	return hostfw.Ruleset{
+		Tables: []hostfw.Table{
+			{
+				Family: "inet",
+				Name:   "egress",
+				Chains: []hostfw.Chain{
+					{Name: "forward", Hook: "forward", Priority: "filter", Policy: "accept", Owned: true, Rules: rules},
+				},
+			},
+		},
+	}
+}
+
+// HostRuleset is the egress ruleset of the host taps, the traffic of the
+// taps goes through the host bridges forward chain
+func HostRuleset(rules []hostfw.Rule) hostfw.Ruleset {
+	return hostfw.Ruleset{
+		Tables: []hostfw.Table{
+			{
+				Family: "bridge",
+				Name:   "egress",
+				Chains: []hostfw.Chain{
+					{Name: "forward", Hook: "forward", Priority: "filter", Policy: "accept", Owned: true, Rules: rules},
+				},
+			},
+		},
+	}
+}
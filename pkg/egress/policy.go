@@ -0,0 +1,195 @@
+package egress
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/zos/pkg/hostfw"
+	"github.com/threefoldtech/zos/pkg/zosconfig"
+)
+
+// Policy is the egress policy applied to each workload. It applies to the
+// private ipv4 traffic leaving the workload network, and to all the traffic
+// of the workload public ip and overlay taps.
+type Policy struct {
+	Enabled bool `json:"enabled"`
+	// DenyPorts are ports workloads can't connect to
+	DenyPorts []hostfw.Port `json:"deny_ports"`
+	// ConnRate is the max number of new connections per second, 0 is unlimited
+	ConnRate uint `json:"conn_rate"`
+	// Bandwidth is the max egress bandwidth in Mbit/s, 0 is unlimited
+	Bandwidth uint `json:"bandwidth"`
+	// Exceptions allows tenants to request exceptions for their workloads
+	Exceptions bool `json:"exceptions"`
+}
+
+// Valid checks the policy
+func (p *Policy) Valid() error {
+	for _, port := range p.DenyPorts {
+		if port.Protocol != "tcp" && port.Protocol != "udp" {
+			return fmt.Errorf("invalid deny port protocol '%s'", port.Protocol)
+		}
+
+		if port.Port == 0 {
+			return fmt.Errorf("invalid deny port 0")
+		}
+	}
+
+	return nil
+}
+
+// Exception is requested by the tenant in the "egress" section of the
+// zmachine workload metadata
+type Exception struct {
+	// AllowPorts are ports of the policy deny list the workload can connect to
+	AllowPorts []hostfw.Port `json:"allow_ports"`
+}
+
+// ParseException gets the exception from the workload metadata, if any.
+// Metadata is free form so it's not an error if it's not json.
+func ParseException(metadata string) Exception {
+	var data struct {
+		Egress Exception `json:"egress"`
+	}
+
+	if err := json.Unmarshal([]byte(metadata), &data); err != nil {
+		return Exception{}
+	}
+
+	return data.Egress
+}
+
+// Config is the egress config of all farms
+type Config struct {
+	// Default is the policy of farms without their own policy
+	Default Policy `json:"default"`
+	// Farms are the policies of farms by farm id
+	Farms map[string]Policy `json:"farms"`
+}
+
+// For returns the policy of the farm
+func (c *Config) For(farm uint32) Policy {
+	if policy, ok := c.Farms[fmt.Sprint(farm)]; ok {
+		return policy
+	}
+
+	return c.Default
+}
+
+// Load gets the egress config from the zos-config of the running mode. The
+// config is in the "egress" section, egress filtering is disabled if it's
+// missing.
+func Load() (Config, error) {
+	var config struct {
+		Egress *Config `json:"egress"`
+	}
+
+	if err := zosconfig.GetConfig(&config); err != nil {
+		return Config{}, err
+	}
+
+	if config.Egress == nil {
+		return Config{}, nil
+	}
+
+	if err := config.Egress.Default.Valid(); err != nil {
+		return Config{}, errors.Wrap(err, "invalid default egress policy")
+	}
+
+	for farm, policy := range config.Egress.Farms {
+		if err := policy.Valid(); err != nil {
+			return Config{}, errors.Wrapf(err, "invalid egress policy of farm '%s'", farm)
+		}
+	}
+
+	return *config.Egress, nil
+}
+
+// Workload is a workload interface, either in a network resource or a tap
+// bridged on the host
+type Workload struct {
+	ID string
+	IP string
+	// Network is the ip range of the workload network
+	Network string
+	// Tap is the host tap of the public ip and overlay interfaces, all the
+	// traffic coming from the tap is filtered then
+	Tap       string
+	Exception Exception
+}
+
+// Rules are the egress filter rules of the workload
+func (p *Policy) Rules(wl Workload) []hostfw.Rule {
+	if !p.Enabled {
+		return nil
+	}
+
+	allowed := make(map[hostfw.Port]struct{})
+	if p.Exceptions {
+		for _, port := range wl.Exception.AllowPorts {
+			allowed[port] = struct{}{}
+		}
+	}
+
+	denied := make(map[string][]uint16)
+	for _, port := range p.DenyPorts {
+		if _, ok := allowed[port]; ok {
+			continue
+		}
+		denied[port.Protocol] = append(denied[port.Protocol], port.Port)
+	}
+
+	protocols := make([]string, 0, len(denied))
+	for protocol := range denied {
+		protocols = append(protocols, protocol)
+	}
+	sort.Strings(protocols)
+
+	egress := func(name string) hostfw.Rule {
+		if len(wl.Tap) != 0 {
+			return hostfw.Rule{
+				Name:    fmt.Sprintf("%s-%s-%s", wl.ID, wl.Tap, name),
+				InIface: wl.Tap,
+			}
+		}
+
+		return hostfw.Rule{
+			Name:     fmt.Sprintf("%s-%s", wl.ID, name),
+			SAddr:    []string{wl.IP},
+			NotDAddr: []string{wl.Network},
+		}
+	}
+
+	var rules []hostfw.Rule
+	for _, protocol := range protocols {
+		ports := denied[protocol]
+		sort.Slice(ports, func(i, j int) bool { return ports[i] < ports[j] })
+
+		rule := egress("deny-" + protocol)
+		rule.Protocol = protocol
+		rule.DPorts = ports
+		rule.Verdict = "reject with icmpx type admin-prohibited"
+		rules = append(rules, rule)
+	}
+
+	if p.ConnRate > 0 {
+		rule := egress("conn-rate")
+		rule.New = true
+		rule.Limit = fmt.Sprintf("%d/second", p.ConnRate)
+		rule.Verdict = "drop"
+		rules = append(rules, rule)
+	}
+
+	if p.Bandwidth > 0 {
+		// Mbit/s to kbytes/s, with a burst of one second
+		rate := p.Bandwidth * 125
+		rule := egress("bandwidth")
+		rule.Limit = fmt.Sprintf("%d kbytes/second burst %d kbytes", rate, rate)
+		rule.Verdict = "drop"
+		rules = append(rules, rule)
+	}
+
+	return rules
+}
@@ -0,0 +1,84 @@
+package egress
+
+import (
+	"testing"
+
+	"github.com/threefoldtech/zos/pkg/hostfw"
+)
+
+func TestRules(t *testing.T) {
+	policy := Policy{
+		Enabled:    true,
+		DenyPorts:  []hostfw.Port{{Protocol: "tcp", Port: 587}, {Protocol: "tcp", Port: 465}, {Protocol: "udp", Port: 53}},
+		ConnRate:   20,
+		Bandwidth:  100,
+		Exceptions: true,
+	}
+
+	wl := Workload{
+		ID:        "1-2-vm",
+		IP:        "10.1.3.2",
+		Network:   "10.1.0.0/16",
+		Exception: ParseException(`{"egress": {"allow_ports": [{"protocol": "udp", "port": 53}]}}`),
+	}
+
+	rules := policy.Rules(wl)
+	var names []string
+	for _, rule := range rules {
+		names = append(names, rule.Name)
+	}
+
+	expected := []string{"1-2-vm-deny-tcp", "1-2-vm-conn-rate", "1-2-vm-bandwidth"}
+	if len(names) != len(expected) {
+		t.Fatalf("expected rules %v got %v", expected, names)
+	}
+
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Fatalf("expected rules %v got %v", expected, names)
+		}
+	}
+
+	if ports := rules[0].DPorts; len(ports) != 2 || ports[0] != 465 || ports[1] != 587 {
+		t.Fatalf("unexpected denied ports %v", ports)
+	}
+
+	if rules[2].Limit != "12500 kbytes/second burst 12500 kbytes" {
+		t.Fatalf("unexpected bandwidth limit '%s'", rules[2].Limit)
+	}
+
+	// exceptions are ignored if the farm doesn't allow them
+	policy.Exceptions = false
+	if rules := policy.Rules(wl); rules[1].Name != "1-2-vm-deny-udp" {
+		t.Fatalf("expected udp port to be denied, got %s", rules[1].Name)
+	}
+
+	policy.Enabled = false
+	if rules := policy.Rules(wl); len(rules) != 0 {
+		t.Fatalf("disabled policy must have no rules, got %v", rules)
+	}
+}
+
+func TestParseException(t *testing.T) {
+	if exception := ParseException("my vm"); len(exception.AllowPorts) != 0 {
+		t.Fatal("expected no exception for non json metadata")
+	}
+}
+
+func TestTapRules(t *testing.T) {
+	policy := Policy{Enabled: true, ConnRate: 20}
+
+	rules := policy.Rules(Workload{ID: "1-2-vm", Tap: "t-ygg"})
+	if len(rules) != 1 {
+		t.Fatalf("expected one rule got %v", rules)
+	}
+
+	rule := rules[0]
+	if rule.Name != "1-2-vm-t-ygg-conn-rate" || rule.InIface != "t-ygg" {
+		t.Fatalf("unexpected tap rule %+v", rule)
+	}
+
+	if len(rule.SAddr) != 0 || len(rule.NotDAddr) != 0 {
+		t.Fatalf("tap rule must match all the tap traffic, got %+v", rule)
+	}
+}
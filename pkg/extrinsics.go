@@ -0,0 +1,69 @@
+package pkg
+
+import (
+	"time"
+
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+)
+
+//go:generate zbusc -module api-gateway -version 0.0.1 -name extrinsics -package stubs github.com/threefoldtech/zos/pkg+ExtrinsicQueue stubs/extrinsic_queue_stub.go
+
+// ExtrinsicClass sets the order in which queued extrinsics are submitted,
+// all extrinsics of a class are submitted before the next class. It's a local
+// order only, extrinsics are signed without a tip whatever their class.
+type ExtrinsicClass string
+
+const (
+	// ExtrinsicOperational are calls that keep the node in good standing
+	// on chain, like uptime and power state reports
+	ExtrinsicOperational ExtrinsicClass = "operational"
+	// ExtrinsicNormal are contract calls
+	ExtrinsicNormal ExtrinsicClass = "normal"
+	// ExtrinsicBulk are consumption reports that can wait
+	ExtrinsicBulk ExtrinsicClass = "bulk"
+)
+
+// ExtrinsicState is the state of a queued extrinsic
+type ExtrinsicState string
+
+const (
+	// ExtrinsicQueued is waiting to be submitted
+	ExtrinsicQueued ExtrinsicState = "queued"
+	// ExtrinsicDone was included in a block
+	ExtrinsicDone ExtrinsicState = "done"
+	// ExtrinsicFailed was rejected by the chain or expired before
+	// it could be submitted
+	ExtrinsicFailed ExtrinsicState = "failed"
+)
+
+// ExtrinsicStatus is the status of a queued extrinsic
+type ExtrinsicStatus struct {
+	Ticket uint64         `json:"ticket"`
+	Call   string         `json:"call"`
+	Class  ExtrinsicClass `json:"class"`
+	State  ExtrinsicState `json:"state"`
+	// Nonce is the account nonce the extrinsic was submitted with
+	Nonce uint64 `json:"nonce"`
+	// Hash is the hash of the block that included the extrinsic
+	Hash     string    `json:"hash"`
+	Attempts uint      `json:"attempts"`
+	Error    string    `json:"error"`
+	Queued   time.Time `json:"queued"`
+	Updated  time.Time `json:"updated"`
+}
+
+// ExtrinsicQueue is the outbound extrinsic queue of the node. All extrinsics
+// signed with the node identity are submitted one at a time, in order, by the
+// api-gateway. Submit calls return a ticket that can be used to query the status
+// of the extrinsic.
+type ExtrinsicQueue interface {
+	SubmitReport(consumptions []substrate.NruConsumption) (uint64, error)
+	SubmitContractConsumption(resources []substrate.ContractResources) (uint64, error)
+	SubmitUptime(uptime uint64, timestampHint uint64) (uint64, error)
+	SubmitPowerState(up bool) (uint64, error)
+	// Status returns the status of the extrinsic with ticket. Status of
+	// finished extrinsics is kept for an hour.
+	Status(ticket uint64) (ExtrinsicStatus, error)
+	// Pending returns all queued extrinsics in submission order
+	Pending() []ExtrinsicStatus
+}
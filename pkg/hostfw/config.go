@@ -0,0 +1,58 @@
+package hostfw
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/zos/pkg/zosconfig"
+)
+
+// Port is a port of an l4 protocol
+type Port struct {
+	Protocol string `json:"protocol"`
+	Port     uint16 `json:"port"`
+}
+
+// Policy is the part of the host firewall farmers can configure
+type Policy struct {
+	// BlockedEgress are ports workloads can't connect to, smtp is always blocked
+	BlockedEgress []Port `json:"blocked_egress"`
+}
+
+// Valid checks the policy
+func (p *Policy) Valid() error {
+	for _, port := range p.BlockedEgress {
+		if port.Protocol != "tcp" && port.Protocol != "udp" {
+			return fmt.Errorf("invalid blocked egress protocol '%s'", port.Protocol)
+		}
+
+		if port.Port == 0 {
+			return fmt.Errorf("invalid blocked egress port 0")
+		}
+	}
+
+	return nil
+}
+
+// Load gets the host firewall policy from the zos-config of the running
+// mode. The policy is in the "host_firewall" section, an empty policy is
+// returned if it's missing.
+func Load() (Policy, error) {
+	var config struct {
+		Policy *Policy `json:"host_firewall"`
+	}
+
+	if err := zosconfig.GetConfig(&config); err != nil {
+		return Policy{}, err
+	}
+
+	if config.Policy == nil {
+		return Policy{}, nil
+	}
+
+	if err := config.Policy.Valid(); err != nil {
+		return Policy{}, errors.Wrap(err, "invalid host firewall policy")
+	}
+
+	return *config.Policy, nil
+}
@@ -0,0 +1,370 @@
+package hostfw
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// nftError matches the location of an error reported by `nft -f`
+var nftError = regexp.MustCompile(`(?m)^[^\s:]+:(\d+):[\d-]+: Error: (.*)$`)
+
+// Firewall manages the host firewall. The last applied policy is persisted
+// so the node starts with it on next boot.
+type Firewall struct {
+	path string
+
+	m       sync.Mutex
+	policy  Policy
+	version string
+}
+
+// New creates a new firewall that persists its policy in path. The persisted
+// policy is loaded if it exists.
+func New(path string) (*Firewall, error) {
+	fw := &Firewall{path: path}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return fw, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to read host firewall policy")
+	}
+
+	if err := json.Unmarshal(data, &fw.policy); err != nil {
+		log.Error().Err(err).Msg("invalid persisted host firewall policy, using default")
+		fw.policy = Policy{}
+	}
+
+	return fw, nil
+}
+
+// Ensure applies the current policy
+func (f *Firewall) Ensure(ctx context.Context) error {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	return f.apply(ctx, f.policy)
+}
+
+// Apply applies and persists the given policy
+func (f *Firewall) Apply(ctx context.Context, policy Policy) error {
+	if err := policy.Valid(); err != nil {
+		return err
+	}
+
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if err := f.apply(ctx, policy); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode host firewall policy")
+	}
+
+	if err := os.WriteFile(f.path, data, 0644); err != nil {
+		return errors.Wrap(err, "failed to persist host firewall policy")
+	}
+
+	f.policy = policy
+	return nil
+}
+
+// apply applies the policy ruleset in a single nft transaction and verifies
+// the live ruleset, must be called with f.m held
+func (f *Firewall) apply(ctx context.Context, policy Policy) error {
+	ruleset := Build(policy)
+	version := ruleset.Version()
+	log.Info().Str("version", version).Msg("applying host firewall")
+
+	if err := Apply(ctx, "", ruleset); err != nil {
+		return errors.Wrapf(err, "failed to apply host firewall version '%s'", version)
+	}
+
+	f.version = version
+	return nil
+}
+
+// HostNamespace is the path of the host network namespace, modules that run
+// in another namespace use it to apply rulesets on the host
+const HostNamespace = "/proc/1/ns/net"
+
+// nft runs nft with stdin in the given network namespace and returns its
+// output and errors. The namespace is a named namespace, the path of a
+// namespace like HostNamespace, or empty for the current namespace.
+func nft(ctx context.Context, namespace string, stdin io.Reader, args ...string) ([]byte, string, error) {
+	name := "nft"
+	if len(namespace) != 0 && !filepath.IsAbs(namespace) {
+		name, args = "ip", append([]string{"netns", "exec", namespace, "nft"}, args...)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if !filepath.IsAbs(namespace) {
+		err := cmd.Run()
+		return stdout.Bytes(), stderr.String(), err
+	}
+
+	netNS, err := ns.GetNS(namespace)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "failed to get namespace '%s'", namespace)
+	}
+	defer netNS.Close()
+
+	// nft is started from the thread that is switched to the namespace
+	err = netNS.Do(func(_ ns.NetNS) error {
+		return cmd.Run()
+	})
+
+	return stdout.Bytes(), stderr.String(), err
+}
+
+// Apply applies the ruleset in a single nft transaction in the given network
+// namespace, and verifies the live ruleset
+func Apply(ctx context.Context, namespace string, ruleset Ruleset) error {
+	live := make(map[string]liveTable)
+	for _, table := range ruleset.Tables {
+		name := fmt.Sprintf("%s %s", table.Family, table.Name)
+		output, _, err := nft(ctx, namespace, nil, "-j", "list", "table", table.Family, table.Name)
+		if err != nil {
+			// the table doesn't exist yet
+			continue
+		}
+
+		if live[name], err = parseTable(output); err != nil {
+			return errors.Wrapf(err, "failed to parse table %s", name)
+		}
+
+		for _, chain := range table.Chains {
+			if chain.wrong(live[name][chain.Name]) {
+				log.Warn().Str("table", name).Str("chain", chain.Name).Msg("chain has the wrong type, creating it again")
+			}
+		}
+	}
+
+	stmts := ruleset.statements(live)
+
+	if _, stderr, err := nft(ctx, namespace, strings.NewReader(render(stmts)), "-f", "-"); err != nil {
+		if len(stderr) == 0 {
+			return errors.Wrap(err, "failed to run nft")
+		}
+		return scriptError(stmts, stderr)
+	}
+
+	if err := Verify(ctx, namespace, ruleset); err != nil {
+		return errors.Wrap(err, "ruleset is not applied")
+	}
+
+	return nil
+}
+
+// scriptError points the nft errors to the ruleset objects that caused them
+func scriptError(stmts []statement, stderr string) error {
+	matches := nftError.FindAllStringSubmatch(stderr, -1)
+	if len(matches) == 0 {
+		return fmt.Errorf("nft: %s", strings.TrimSpace(stderr))
+	}
+
+	var errs []string
+	for _, match := range matches {
+		line, _ := strconv.Atoi(match[1])
+		if line < 1 || line > len(stmts) {
+			errs = append(errs, match[2])
+			continue
+		}
+
+		errs = append(errs, fmt.Sprintf("%s: %s", stmts[line-1].what, match[2]))
+	}
+
+	return fmt.Errorf("%s", strings.Join(errs, "; "))
+}
+
+// Verify reads back the live ruleset in the given network namespace and makes
+// sure it has the chains and rules of the given ruleset. Rules added by other
+// components are ignored.
+func Verify(ctx context.Context, namespace string, ruleset Ruleset) error {
+	for _, table := range ruleset.Tables {
+		output, _, err := nft(ctx, namespace, nil, "-j", "list", "table", table.Family, table.Name)
+		if err != nil {
+			return errors.Wrapf(err, "failed to list table %s %s", table.Family, table.Name)
+		}
+
+		live, err := parseTable(output)
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse table %s %s", table.Family, table.Name)
+		}
+
+		if err := live.matches(table); err != nil {
+			return errors.Wrapf(err, "table %s %s", table.Family, table.Name)
+		}
+	}
+
+	return nil
+}
+
+type liveChain struct {
+	typ    string
+	hook   string
+	policy string
+	rules  []string
+}
+
+// has checks if the chain has a rule with the given comment
+func (c *liveChain) has(comment string) bool {
+	for _, rule := range c.rules {
+		if rule == comment {
+			return true
+		}
+	}
+
+	return false
+}
+
+type liveTable map[string]*liveChain
+
+// parseTable parses the output of `nft -j list table`
+func parseTable(data []byte) (liveTable, error) {
+	var output struct {
+		Objects []struct {
+			Chain *struct {
+				Name   string `json:"name"`
+				Type   string `json:"type"`
+				Hook   string `json:"hook"`
+				Policy string `json:"policy"`
+			} `json:"chain"`
+			Rule *struct {
+				Chain   string `json:"chain"`
+				Comment string `json:"comment"`
+			} `json:"rule"`
+		} `json:"nftables"`
+	}
+
+	if err := json.Unmarshal(data, &output); err != nil {
+		return nil, err
+	}
+
+	table := make(liveTable)
+	for _, obj := range output.Objects {
+		if obj.Chain != nil {
+			table[obj.Chain.Name] = &liveChain{typ: obj.Chain.Type, hook: obj.Chain.Hook, policy: obj.Chain.Policy}
+		}
+	}
+
+	for _, obj := range output.Objects {
+		if obj.Rule == nil {
+			continue
+		}
+
+		chain, ok := table[obj.Rule.Chain]
+		if !ok {
+			continue
+		}
+		chain.rules = append(chain.rules, obj.Rule.Comment)
+	}
+
+	return table, nil
+}
+
+func (t liveTable) matches(table Table) error {
+	for _, chain := range table.Chains {
+		live, ok := t[chain.Name]
+		if !ok {
+			return fmt.Errorf("chain %s is missing", chain.Name)
+		}
+
+		if chain.wrong(live) || live.policy != chain.Policy {
+			return fmt.Errorf("chain %s has type '%s', hook '%s' and policy '%s'", chain.Name, live.typ, live.hook, live.policy)
+		}
+
+		if !chain.Owned {
+			continue
+		}
+
+		if !live.has(chain.rulesChain()) {
+			return fmt.Errorf("chain %s doesn't jump to %s", chain.Name, chain.rulesChain())
+		}
+
+		rules, ok := t[chain.rulesChain()]
+		if !ok {
+			return fmt.Errorf("chain %s is missing", chain.rulesChain())
+		}
+
+		var expected []string
+		for _, rule := range chain.Rules {
+			expected = append(expected, rule.Name)
+		}
+
+		if strings.Join(rules.rules, ",") != strings.Join(expected, ",") {
+			return fmt.Errorf("chain %s has rules [%s] expected [%s]", chain.rulesChain(), strings.Join(rules.rules, ", "), strings.Join(expected, ", "))
+		}
+	}
+
+	return nil
+}
+
+// Version returns the version of the applied ruleset
+func (f *Firewall) Version() string {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	return f.version
+}
+
+// Watch loads the policy from zos-config every 10 minutes until context is
+// cancelled. The firewall is applied again if the policy changed or if the
+// live ruleset doesn't match it anymore.
+func (f *Firewall) Watch(ctx context.Context) {
+	for {
+		f.refresh(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(10 * time.Minute):
+		}
+	}
+}
+
+func (f *Firewall) refresh(ctx context.Context) {
+	policy, err := Load()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to load host firewall policy")
+		f.m.Lock()
+		policy = f.policy
+		f.m.Unlock()
+	}
+
+	ruleset := Build(policy)
+	if ruleset.Version() == f.Version() {
+		err := Verify(ctx, "", ruleset)
+		if err == nil {
+			return
+		}
+		log.Warn().Err(err).Msg("host firewall changed, applying it again")
+	}
+
+	if err := f.Apply(ctx, policy); err != nil {
+		log.Error().Err(err).Msg("failed to apply host firewall")
+	}
+}
@@ -0,0 +1,142 @@
+package hostfw
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/zos/pkg/zosconfig"
+	"github.com/threefoldtech/zosbase/pkg/kernel"
+)
+
+const (
+	// kernel param to enable lan isolation on the node
+	paramLANIsolation = "lan.isolation"
+	// kernel param with a comma separated list of lan hosts or networks
+	// workloads can still reach
+	paramLANAllow = "lan.allow"
+
+	// lanIface is the ndmz interface connected to the zos bridge
+	lanIface = "npub4"
+)
+
+// PrivateRanges are the rfc1918 ranges blocked by lan isolation
+var PrivateRanges = []string{
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+}
+
+// LANIsolation config
+type LANIsolation struct {
+	Enabled bool `json:"enabled"`
+	// Allow are lan hosts or networks workloads can reach. The gateway and
+	// dns servers are always allowed.
+	Allow []string `json:"allow"`
+}
+
+// Valid checks the config
+func (l *LANIsolation) Valid() error {
+	for _, allow := range l.Allow {
+		if net.ParseIP(allow) != nil {
+			continue
+		}
+
+		if _, _, err := net.ParseCIDR(allow); err != nil {
+			return fmt.Errorf("invalid allowed lan host '%s'", allow)
+		}
+	}
+
+	return nil
+}
+
+// Merge adds the node config to the farm config. Isolation is enabled if
+// it's enabled by any of them.
+func (l LANIsolation) Merge(node LANIsolation) LANIsolation {
+	return LANIsolation{
+		Enabled: l.Enabled || node.Enabled,
+		Allow:   append(append([]string{}, l.Allow...), node.Allow...),
+	}
+}
+
+// LANIsolationFromKernel loads the node lan isolation config from kernel params
+func LANIsolationFromKernel(params kernel.Params) (LANIsolation, error) {
+	cfg := LANIsolation{Enabled: params.Exists(paramLANIsolation)}
+
+	allowed, _ := params.GetOne(paramLANAllow)
+	for _, value := range strings.Split(allowed, ",") {
+		value = strings.TrimSpace(value)
+		if len(value) != 0 {
+			cfg.Allow = append(cfg.Allow, value)
+		}
+	}
+
+	return cfg, cfg.Valid()
+}
+
+// LoadLANIsolation gets the lan isolation config of the farm from the
+// "lan_isolation" section of the zos-config of the running mode
+func LoadLANIsolation(farm uint32) (LANIsolation, error) {
+	var config struct {
+		LAN struct {
+			Farms map[string]LANIsolation `json:"farms"`
+		} `json:"lan_isolation"`
+	}
+
+	if err := zosconfig.GetConfig(&config); err != nil {
+		return LANIsolation{}, err
+	}
+
+	cfg := config.LAN.Farms[fmt.Sprint(farm)]
+	if err := cfg.Valid(); err != nil {
+		return LANIsolation{}, errors.Wrap(err, "invalid lan isolation config")
+	}
+
+	return cfg, nil
+}
+
+// LANRuleset is the ndmz ruleset that drops traffic forwarded from
+// workloads to the private ranges of the zos bridge network. gateway and
+// dns are the lan hosts the node uses, they are always allowed.
+func LANRuleset(cfg LANIsolation, gateway string, dns []string) Ruleset {
+	var rules []Rule
+	if cfg.Enabled {
+		allow := []string{gateway}
+		allow = append(allow, dns...)
+		allow = append(allow, cfg.Allow...)
+
+		// a rule per host, overlapping networks can't be in the same set
+		seen := make(map[string]struct{})
+		for _, host := range allow {
+			if _, ok := seen[host]; ok || len(host) == 0 {
+				continue
+			}
+			seen[host] = struct{}{}
+
+			rules = append(rules, Rule{
+				Name:     "lan-allow-" + host,
+				OutIface: lanIface,
+				DAddr:    []string{host},
+				Verdict:  "accept",
+			})
+		}
+
+		rules = append(rules, Rule{
+			Name:     "lan-isolation",
+			OutIface: lanIface,
+			DAddr:    PrivateRanges,
+			Verdict:  "reject with icmpx type admin-prohibited",
+		})
+	}
+
+	return Ruleset{
+		Tables: []Table{
+			{
+				Family: "inet",
+				Name:   "lan",
+				Chains: []Chain{ownedChain("forward", rules...)},
+			},
+		},
+	}
+}
@@ -0,0 +1,285 @@
+package hostfw
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Ruleset is a set of nft tables. It's applied as a whole in a single
+// transaction. Base chains are created if they are missing and are never
+// flushed, so rules added by other components to them are kept. The rules
+// of the ruleset are set in dedicated chains the base chains jump to.
+type Ruleset struct {
+	Tables []Table
+}
+
+// Table is an nft table
+type Table struct {
+	Family string
+	Name   string
+	Chains []Chain
+}
+
+// Chain is an nft base chain
+type Chain struct {
+	Name     string
+	Hook     string
+	Priority string
+	Policy   string
+	// Owned chains jump to a dedicated chain with the ruleset rules, it's
+	// flushed when the ruleset is applied so it only has these rules
+	Owned bool
+	Rules []Rule
+}
+
+// Rule is an nft rule. All set fields must match for the verdict to be
+// applied.
+type Rule struct {
+	// Name identifies the rule, it's set as the rule comment so the rule
+	// can be found in the live ruleset
+	Name     string
+	InIface  string
+	OutIface string
+	// SAddr, DAddr and NotDAddr are ipv4 addresses or ranges
+	SAddr    []string
+	DAddr    []string
+	NotDAddr []string
+	// Protocol is the l4 protocol (tcp or udp) of DPorts
+	Protocol string
+	DPorts   []uint16
+	// New only matches packets of new connections
+	New bool
+	// Limit only matches packets over the rate, like `10/second`
+	Limit   string
+	Verdict string
+}
+
+// statement is a line of the rendered ruleset, what is the object the line
+// creates so errors can point to it
+type statement struct {
+	line string
+	what string
+}
+
+func (r *Rule) expr() string {
+	var parts []string
+	if len(r.InIface) != 0 {
+		parts = append(parts, fmt.Sprintf("iifname %q", r.InIface))
+	}
+
+	if len(r.OutIface) != 0 {
+		parts = append(parts, fmt.Sprintf("oifname %q", r.OutIface))
+	}
+
+	if len(r.SAddr) != 0 {
+		parts = append(parts, fmt.Sprintf("ip saddr { %s }", strings.Join(r.SAddr, ", ")))
+	}
+
+	if len(r.DAddr) != 0 {
+		parts = append(parts, fmt.Sprintf("ip daddr { %s }", strings.Join(r.DAddr, ", ")))
+	}
+
+	if len(r.NotDAddr) != 0 {
+		parts = append(parts, fmt.Sprintf("ip daddr != { %s }", strings.Join(r.NotDAddr, ", ")))
+	}
+
+	if len(r.DPorts) != 0 {
+		ports := make([]string, 0, len(r.DPorts))
+		for _, port := range r.DPorts {
+			ports = append(ports, fmt.Sprint(port))
+		}
+		parts = append(parts, fmt.Sprintf("%s dport { %s }", r.Protocol, strings.Join(ports, ", ")))
+	}
+
+	if r.New {
+		parts = append(parts, "ct state new")
+	}
+
+	if len(r.Limit) != 0 {
+		parts = append(parts, "limit rate over "+r.Limit)
+	}
+
+	parts = append(parts, r.Verdict, fmt.Sprintf("comment %q", r.Name))
+	return strings.Join(parts, " ")
+}
+
+func (c *Chain) spec() string {
+	return fmt.Sprintf("{ type filter hook %s priority %s; policy %s; }", c.Hook, c.Priority, c.Policy)
+}
+
+// rulesChain is the name of the dedicated chain with the chain rules, it's
+// also the comment of the jump rule of the base chain
+func (c *Chain) rulesChain() string {
+	return "zos-" + c.Name
+}
+
+// wrong checks if the live chain can't be used as the chain, older nodes
+// created some base chains with the wrong type or hook
+func (c *Chain) wrong(live *liveChain) bool {
+	return live != nil && (live.typ != "filter" || live.hook != c.Hook)
+}
+
+// statements renders the ruleset as nft statements. live are the live tables
+// by family and name, nil if they are not known. Live chains with the wrong
+// type or hook are created again, and jumps to the rules chains are only
+// added if they are missing.
+func (r Ruleset) statements(live map[string]liveTable) []statement {
+	var stmts []statement
+	for _, table := range r.Tables {
+		table := fmt.Sprintf("%s %s", table.Family, table.Name)
+		stmts = append(stmts, statement{line: "add table " + table, what: "table " + table})
+	}
+
+	for _, table := range r.Tables {
+		liveTable := live[fmt.Sprintf("%s %s", table.Family, table.Name)]
+		for _, chain := range table.Chains {
+			name := fmt.Sprintf("%s %s %s", table.Family, table.Name, chain.Name)
+			what := "chain " + name
+
+			liveChain := liveTable[chain.Name]
+			if chain.wrong(liveChain) {
+				// only empty chains can be deleted
+				stmts = append(stmts,
+					statement{line: "flush chain " + name, what: what},
+					statement{line: "delete chain " + name, what: what},
+				)
+				liveChain = nil
+			}
+
+			stmts = append(stmts, statement{line: fmt.Sprintf("add chain %s %s", name, chain.spec()), what: what})
+			if !chain.Owned {
+				continue
+			}
+
+			rulesChain := fmt.Sprintf("%s %s %s", table.Family, table.Name, chain.rulesChain())
+			stmts = append(stmts,
+				statement{line: "add chain " + rulesChain, what: "chain " + rulesChain},
+				statement{line: "flush chain " + rulesChain, what: "chain " + rulesChain},
+			)
+
+			for _, rule := range chain.Rules {
+				stmts = append(stmts, statement{
+					line: fmt.Sprintf("add rule %s %s", rulesChain, rule.expr()),
+					what: fmt.Sprintf("rule '%s' in chain %s", rule.Name, rulesChain),
+				})
+			}
+
+			if liveChain == nil || !liveChain.has(chain.rulesChain()) {
+				stmts = append(stmts, statement{
+					line: fmt.Sprintf("add rule %s jump %s comment %q", name, chain.rulesChain(), chain.rulesChain()),
+					what: fmt.Sprintf("jump to %s in chain %s", chain.rulesChain(), name),
+				})
+			}
+		}
+	}
+
+	return stmts
+}
+
+// Render renders the ruleset as an nft script
+func (r Ruleset) Render() string {
+	return render(r.statements(nil))
+}
+
+func render(stmts []statement) string {
+	var buf strings.Builder
+	for _, stmt := range stmts {
+		buf.WriteString(stmt.line)
+		buf.WriteByte('\n')
+	}
+
+	return buf.String()
+}
+
+// Version is a short hash of the rendered ruleset
+func (r Ruleset) Version() string {
+	sum := sha256.Sum256([]byte(r.Render()))
+	return hex.EncodeToString(sum[:6])
+}
+
+// baseChain is a chain that is only created if it's missing
+func baseChain(name string) Chain {
+	return Chain{Name: name, Hook: name, Priority: "filter", Policy: "accept"}
+}
+
+// ownedChain is a chain that jumps to the given rules
+func ownedChain(name string, rules ...Rule) Chain {
+	chain := baseChain(name)
+	chain.Owned = true
+	chain.Rules = rules
+	return chain
+}
+
+// Build creates the host ruleset with the policy rules
+func Build(policy Policy) Ruleset {
+	prerouting := []Rule{
+		// drop smtp traffic for hidden nodes
+		{
+			Name:     "block-smtp",
+			InIface:  "b-*",
+			Protocol: "tcp",
+			DPorts:   []uint16{25},
+			Verdict:  "reject with icmp type admin-prohibited",
+		},
+	}
+
+	blocked := make(map[string][]uint16)
+	for _, port := range policy.BlockedEgress {
+		blocked[port.Protocol] = append(blocked[port.Protocol], port.Port)
+	}
+
+	protocols := make([]string, 0, len(blocked))
+	for protocol := range blocked {
+		protocols = append(protocols, protocol)
+	}
+	sort.Strings(protocols)
+
+	for _, protocol := range protocols {
+		ports := blocked[protocol]
+		sort.Slice(ports, func(i, j int) bool { return ports[i] < ports[j] })
+		prerouting = append(prerouting, Rule{
+			Name:     "blocked-egress-" + protocol,
+			InIface:  "b-*",
+			Protocol: protocol,
+			DPorts:   ports,
+			Verdict:  "reject with icmpx type admin-prohibited",
+		})
+	}
+
+	return Ruleset{
+		Tables: []Table{
+			{
+				Family: "inet",
+				Name:   "filter",
+				Chains: []Chain{
+					baseChain("input"),
+					baseChain("forward"),
+					baseChain("output"),
+					ownedChain("prerouting", prerouting...),
+				},
+			},
+			{
+				Family: "arp",
+				Name:   "filter",
+				Chains: []Chain{
+					baseChain("input"),
+					baseChain("output"),
+				},
+			},
+			{
+				Family: "bridge",
+				Name:   "filter",
+				Chains: []Chain{
+					baseChain("input"),
+					baseChain("forward"),
+					baseChain("prerouting"),
+					baseChain("postrouting"),
+					baseChain("output"),
+				},
+			},
+		},
+	}
+}
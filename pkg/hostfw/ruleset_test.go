@@ -0,0 +1,140 @@
+package hostfw
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestBuild(t *testing.T) {
+	ruleset := Build(Policy{
+		BlockedEgress: []Port{
+			{Protocol: "udp", Port: 53},
+			{Protocol: "tcp", Port: 587},
+			{Protocol: "tcp", Port: 465},
+		},
+	})
+
+	script := ruleset.Render()
+	for _, line := range []string{
+		"add chain inet filter prerouting { type filter hook prerouting priority filter; policy accept; }\nadd chain inet filter zos-prerouting\nflush chain inet filter zos-prerouting\n",
+		`add rule inet filter zos-prerouting iifname "b-*" tcp dport { 25 } reject with icmp type admin-prohibited comment "block-smtp"`,
+		`add rule inet filter zos-prerouting iifname "b-*" tcp dport { 465, 587 } reject with icmpx type admin-prohibited comment "blocked-egress-tcp"`,
+		`add rule inet filter zos-prerouting iifname "b-*" udp dport { 53 } reject with icmpx type admin-prohibited comment "blocked-egress-udp"`,
+		`add rule inet filter prerouting jump zos-prerouting comment "zos-prerouting"`,
+	} {
+		if !strings.Contains(script, line) {
+			t.Fatalf("expected script to contain %q:\n%s", line, script)
+		}
+	}
+
+	if strings.Contains(script, "delete chain") || strings.Count(script, "flush chain") != 1 {
+		t.Fatalf("only rules chains must be flushed:\n%s", script)
+	}
+
+	live := map[string]liveTable{
+		"inet filter": {
+			"input":      {hook: "input", policy: "accept"},
+			"prerouting": {typ: "filter", hook: "prerouting", policy: "accept", rules: []string{"zos-prerouting"}},
+		},
+		"bridge filter": {
+			"forward": {typ: "filter", hook: "forward", policy: "accept", rules: []string{"", "anti-spoof"}},
+		},
+	}
+
+	applied := render(ruleset.statements(live))
+	if !strings.Contains(applied, "flush chain inet filter input\ndelete chain inet filter input\n") {
+		t.Fatalf("expected input chain with the wrong type to be created again:\n%s", applied)
+	}
+
+	if strings.Contains(applied, "jump") || strings.Contains(applied, "bridge filter forward\n") {
+		t.Fatalf("expected existing jump and bridge forward rules to be kept:\n%s", applied)
+	}
+
+	if ruleset.Version() == Build(Policy{}).Version() {
+		t.Fatal("expected version to change with the policy")
+	}
+}
+
+func TestScriptError(t *testing.T) {
+	ruleset := Build(Policy{})
+	stmts := ruleset.statements(nil)
+
+	var line int
+	for i, stmt := range stmts {
+		if strings.Contains(stmt.line, "block-smtp") {
+			line = i + 1
+		}
+	}
+
+	stderr := fmt.Sprintf("/dev/stdin:%d:1-20: Error: Could not process rule: No such file or directory\n%s\n^^^^^\n", line, stmts[line-1].line)
+	err := scriptError(stmts, stderr)
+	expected := "rule 'block-smtp' in chain inet filter zos-prerouting: Could not process rule: No such file or directory"
+	if err.Error() != expected {
+		t.Fatalf("expected '%s' got '%s'", expected, err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	output := []byte(`{"nftables": [
+		{"metainfo": {"version": "1.0.9"}},
+		{"table": {"family": "inet", "name": "filter", "handle": 1}},
+		{"chain": {"family": "inet", "table": "filter", "name": "input", "handle": 1, "type": "filter", "hook": "input", "prio": 0, "policy": "accept"}},
+		{"chain": {"family": "inet", "table": "filter", "name": "forward", "handle": 2, "type": "filter", "hook": "forward", "prio": 0, "policy": "accept"}},
+		{"chain": {"family": "inet", "table": "filter", "name": "output", "handle": 3, "type": "filter", "hook": "output", "prio": 0, "policy": "accept"}},
+		{"chain": {"family": "inet", "table": "filter", "name": "prerouting", "handle": 4, "type": "filter", "hook": "prerouting", "prio": 0, "policy": "accept"}},
+		{"chain": {"family": "inet", "table": "filter", "name": "zos-prerouting", "handle": 5}},
+		{"rule": {"family": "inet", "table": "filter", "chain": "input", "handle": 6, "comment": "other", "expr": []}},
+		{"rule": {"family": "inet", "table": "filter", "chain": "prerouting", "handle": 7, "expr": []}},
+		{"rule": {"family": "inet", "table": "filter", "chain": "prerouting", "handle": 8, "comment": "zos-prerouting", "expr": []}},
+		{"rule": {"family": "inet", "table": "filter", "chain": "zos-prerouting", "handle": 9, "comment": "block-smtp", "expr": []}}
+	]}`)
+
+	live, err := parseTable(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := Build(Policy{}).Tables[0]
+	if err := live.matches(table); err != nil {
+		t.Fatal(err)
+	}
+
+	table = Build(Policy{BlockedEgress: []Port{{Protocol: "tcp", Port: 587}}}).Tables[0]
+	if err := live.matches(table); err == nil {
+		t.Fatal("expected missing rule error")
+	}
+}
+
+func TestLANRuleset(t *testing.T) {
+	cfg := LANIsolation{Enabled: true, Allow: []string{"192.168.1.10", "192.168.1.1"}}
+	if err := cfg.Valid(); err != nil {
+		t.Fatal(err)
+	}
+
+	ruleset := LANRuleset(cfg, "192.168.1.1", []string{"192.168.1.53"})
+	rules := ruleset.Tables[0].Chains[0].Rules
+
+	expected := []string{"lan-allow-192.168.1.1", "lan-allow-192.168.1.53", "lan-allow-192.168.1.10", "lan-isolation"}
+	if len(rules) != len(expected) {
+		t.Fatalf("expected %d rules got %d", len(expected), len(rules))
+	}
+
+	for i, rule := range rules {
+		if rule.Name != expected[i] {
+			t.Fatalf("expected rule '%s' got '%s'", expected[i], rule.Name)
+		}
+	}
+
+	if !strings.Contains(ruleset.Render(), `oifname "npub4" ip daddr { 10.0.0.0/8, 172.16.0.0/12, 192.168.0.0/16 } reject`) {
+		t.Fatalf("unexpected isolation rule:\n%s", ruleset.Render())
+	}
+
+	if rules := LANRuleset(LANIsolation{}, "192.168.1.1", nil).Tables[0].Chains[0].Rules; len(rules) != 0 {
+		t.Fatal("disabled lan isolation must have no rules")
+	}
+
+	if err := (&LANIsolation{Allow: []string{"lan"}}).Valid(); err == nil {
+		t.Fatal("expected invalid allowed host error")
+	}
+}
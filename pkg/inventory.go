@@ -0,0 +1,90 @@
+package pkg
+
+//go:generate mkdir -p stubs
+//go:generate zbusc -module node -version 0.0.1 -name inventory -package stubs github.com/threefoldtech/zos/pkg+HardwareInventory stubs/inventory_stub.go
+
+// CPUInfo describes the node processors
+type CPUInfo struct {
+	Model   string   `json:"model"`
+	Vendor  string   `json:"vendor"`
+	Sockets int      `json:"sockets"`
+	Cores   int      `json:"cores"`
+	Threads int      `json:"threads"`
+	MHz     float64  `json:"mhz"`
+	Flags   []string `json:"flags"`
+}
+
+// DIMM is a single installed memory module
+type DIMM struct {
+	Locator      string `json:"locator"`
+	Size         string `json:"size"`
+	Type         string `json:"type"`
+	Speed        string `json:"speed"`
+	Manufacturer string `json:"manufacturer"`
+	PartNumber   string `json:"part_number"`
+	Serial       string `json:"serial"`
+}
+
+// NIC is a physical network interface
+type NIC struct {
+	Name     string `json:"name"`
+	Mac      string `json:"mac"`
+	Driver   string `json:"driver"`
+	Firmware string `json:"firmware"`
+	// Speed in Mb/s, 0 if unknown (for example link is down)
+	Speed uint32 `json:"speed"`
+	Link  bool   `json:"link"`
+	// WOLSupported are the wake on lan modes supported by the nic (as reported by ethtool)
+	WOLSupported string `json:"wol_supported"`
+	// WOL is the currently enabled wake on lan modes
+	WOL string `json:"wol"`
+}
+
+// DiskInfo is the identity of a physical disk
+type DiskInfo struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	Model    string `json:"model"`
+	Serial   string `json:"serial"`
+	Firmware string `json:"firmware"`
+	// Size in bytes
+	Size       uint64 `json:"size"`
+	Rotational bool   `json:"rotational"`
+	// SMART is true if the disk supports (and has enabled) SMART
+	SMART bool `json:"smart"`
+}
+
+// GPU is a gpu device attached to the node
+type GPU struct {
+	ID     string `json:"id"`
+	Vendor string `json:"vendor"`
+	Device string `json:"device"`
+}
+
+// Firmware holds the system firmware versions
+type Firmware struct {
+	BIOSVendor   string `json:"bios_vendor"`
+	BIOSVersion  string `json:"bios_version"`
+	BIOSDate     string `json:"bios_date"`
+	BoardVendor  string `json:"board_vendor"`
+	BoardProduct string `json:"board_product"`
+	BoardVersion string `json:"board_version"`
+}
+
+// Inventory is the full hardware inventory of the node
+type Inventory struct {
+	CPU        CPUInfo    `json:"cpu"`
+	Memory     []DIMM     `json:"memory"`
+	NICs       []NIC      `json:"nics"`
+	Disks      []DiskInfo `json:"disks"`
+	GPUs       []GPU      `json:"gpus"`
+	Firmware   Firmware   `json:"firmware"`
+	Hypervisor string     `json:"hypervisor"`
+	SecureBoot bool       `json:"secure_boot"`
+}
+
+// HardwareInventory interface
+type HardwareInventory interface {
+	// Get returns the full node hardware inventory
+	Get() (Inventory, error)
+}
@@ -0,0 +1,89 @@
+package inventory
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/zos/pkg"
+)
+
+const cpuInfoPath = "/proc/cpuinfo"
+
+// CPU returns cpu information of the node
+func CPU() (pkg.CPUInfo, error) {
+	file, err := os.Open(cpuInfoPath)
+	if err != nil {
+		return pkg.CPUInfo{}, errors.Wrapf(err, "failed to open '%s'", cpuInfoPath)
+	}
+	defer file.Close()
+
+	return parseCPUInfo(file)
+}
+
+func parseCPUInfo(r io.Reader) (pkg.CPUInfo, error) {
+	var info pkg.CPUInfo
+
+	sockets := make(map[string]struct{})
+	cores := make(map[string]struct{})
+
+	// physical id is needed to identify a core, and comes before
+	// core id in the cpuinfo block of each processor
+	var physical string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "processor":
+			info.Threads++
+			physical = ""
+		case "vendor_id":
+			info.Vendor = value
+		case "model name":
+			info.Model = value
+		case "cpu MHz":
+			if mhz, err := strconv.ParseFloat(value, 64); err == nil && mhz > info.MHz {
+				info.MHz = mhz
+			}
+		case "physical id":
+			physical = value
+			sockets[value] = struct{}{}
+		case "core id":
+			cores[physical+":"+value] = struct{}{}
+		case "flags":
+			if len(info.Flags) == 0 {
+				info.Flags = strings.Fields(value)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return info, errors.Wrap(err, "failed to read cpu information")
+	}
+
+	info.Sockets = len(sockets)
+	info.Cores = len(cores)
+
+	// some platforms (and vms) don't report topology
+	if info.Sockets == 0 {
+		info.Sockets = 1
+	}
+
+	if info.Cores == 0 {
+		info.Cores = info.Threads
+	}
+
+	return info, nil
+}
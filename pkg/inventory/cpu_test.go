@@ -0,0 +1,71 @@
+package inventory
+
+import (
+	"strings"
+	"testing"
+)
+
+const cpuInfo = `processor	: 0
+vendor_id	: GenuineIntel
+model name	: Intel(R) Xeon(R) CPU E5-2620 v2 @ 2.10GHz
+cpu MHz		: 1200.000
+physical id	: 0
+core id		: 0
+flags		: fpu vme sse sse2 vmx
+
+processor	: 1
+vendor_id	: GenuineIntel
+model name	: Intel(R) Xeon(R) CPU E5-2620 v2 @ 2.10GHz
+cpu MHz		: 2100.000
+physical id	: 0
+core id		: 0
+flags		: fpu vme sse sse2 vmx
+
+processor	: 2
+vendor_id	: GenuineIntel
+model name	: Intel(R) Xeon(R) CPU E5-2620 v2 @ 2.10GHz
+cpu MHz		: 1200.000
+physical id	: 1
+core id		: 0
+flags		: fpu vme sse sse2 vmx
+`
+
+func TestParseCPUInfo(t *testing.T) {
+	info, err := parseCPUInfo(strings.NewReader(cpuInfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Model != "Intel(R) Xeon(R) CPU E5-2620 v2 @ 2.10GHz" {
+		t.Errorf("unexpected model '%s'", info.Model)
+	}
+
+	if info.Sockets != 2 || info.Cores != 2 || info.Threads != 3 {
+		t.Errorf("unexpected topology sockets=%d cores=%d threads=%d", info.Sockets, info.Cores, info.Threads)
+	}
+
+	if info.MHz != 2100 {
+		t.Errorf("unexpected frequency %f", info.MHz)
+	}
+
+	if len(info.Flags) != 5 {
+		t.Errorf("unexpected flags %v", info.Flags)
+	}
+}
+
+func TestParseEthtool(t *testing.T) {
+	output := `Settings for eth0:
+	Supported ports: [ TP ]
+	Supports Wake-on: pumbg
+	Wake-on: g
+	Link detected: yes
+`
+	values := parseEthtool([]byte(output))
+	if values["Supports Wake-on"] != "pumbg" {
+		t.Errorf("unexpected supported wol '%s'", values["Supports Wake-on"])
+	}
+
+	if values["Wake-on"] != "g" {
+		t.Errorf("unexpected wol '%s'", values["Wake-on"])
+	}
+}
@@ -0,0 +1,101 @@
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/zos/pkg"
+)
+
+const sysBlock = "/sys/block"
+
+type smartInfo struct {
+	ModelName       string `json:"model_name"`
+	SerialNumber    string `json:"serial_number"`
+	FirmwareVersion string `json:"firmware_version"`
+	SmartSupport    struct {
+		Available bool `json:"available"`
+		Enabled   bool `json:"enabled"`
+	} `json:"smart_support"`
+}
+
+// Disks lists all physical disks on the node. Disk identity is taken from
+// smartctl if available, otherwise from sysfs.
+func Disks(ctx context.Context) ([]pkg.DiskInfo, error) {
+	entries, err := os.ReadDir(sysBlock)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list '%s'", sysBlock)
+	}
+
+	_, err = exec.LookPath("smartctl")
+	hasSmartctl := err == nil
+
+	var disks []pkg.DiskInfo
+	for _, entry := range entries {
+		name := entry.Name()
+		base := filepath.Join(sysBlock, name)
+		// virtual devices (loop, ram, dm, nbd, etc...) have no device link
+		if _, err := os.Stat(filepath.Join(base, "device")); err != nil {
+			continue
+		}
+
+		disk := pkg.DiskInfo{
+			Name:       name,
+			Path:       filepath.Join("/dev", name),
+			Model:      readSysFile(filepath.Join(base, "device", "model")),
+			Serial:     readSysFile(filepath.Join(base, "device", "serial")),
+			Firmware:   readSysFile(filepath.Join(base, "device", "firmware_rev")),
+			Rotational: readSysFile(filepath.Join(base, "queue", "rotational")) == "1",
+		}
+
+		if disk.Firmware == "" {
+			disk.Firmware = readSysFile(filepath.Join(base, "device", "rev"))
+		}
+
+		// size is always in 512 bytes sectors
+		if sectors, err := strconv.ParseUint(readSysFile(filepath.Join(base, "size")), 10, 64); err == nil {
+			disk.Size = sectors * 512
+		}
+
+		if hasSmartctl {
+			if err := smartIdentity(ctx, &disk); err != nil {
+				log.Debug().Err(err).Str("disk", disk.Path).Msg("failed to get disk smart identity")
+			}
+		}
+
+		disks = append(disks, disk)
+	}
+
+	return disks, nil
+}
+
+func smartIdentity(ctx context.Context, disk *pkg.DiskInfo) error {
+	output, err := run(ctx, "smartctl", "--json", "-i", disk.Path)
+	if err != nil {
+		return err
+	}
+
+	var info smartInfo
+	if err := json.Unmarshal(output, &info); err != nil {
+		return errors.Wrap(err, "failed to parse smartctl output")
+	}
+
+	if info.ModelName != "" {
+		disk.Model = info.ModelName
+	}
+	if info.SerialNumber != "" {
+		disk.Serial = info.SerialNumber
+	}
+	if info.FirmwareVersion != "" {
+		disk.Firmware = info.FirmwareVersion
+	}
+
+	disk.SMART = info.SmartSupport.Available && info.SmartSupport.Enabled
+	return nil
+}
@@ -0,0 +1,71 @@
+package inventory
+
+import (
+	"strings"
+
+	"github.com/threefoldtech/zos/pkg"
+	"github.com/threefoldtech/zosbase/pkg/capacity/dmi"
+)
+
+// DIMMs returns the list of installed memory modules from dmi tables
+func DIMMs(info *dmi.DMI) []pkg.DIMM {
+	var dimms []pkg.DIMM
+	for _, section := range sections(info, dmi.TypeMemoryDevice) {
+		size := property(section, "Size")
+		if size == "" || strings.HasPrefix(size, "No Module") {
+			// empty slot
+			continue
+		}
+
+		dimms = append(dimms, pkg.DIMM{
+			Locator:      property(section, "Locator"),
+			Size:         size,
+			Type:         property(section, "Type"),
+			Speed:        property(section, "Speed"),
+			Manufacturer: property(section, "Manufacturer"),
+			PartNumber:   property(section, "Part Number"),
+			Serial:       property(section, "Serial Number"),
+		})
+	}
+
+	return dimms
+}
+
+// Firmware returns bios and board information from dmi tables
+func Firmware(info *dmi.DMI) pkg.Firmware {
+	var fw pkg.Firmware
+	for _, section := range sections(info, dmi.TypeBIOS) {
+		fw.BIOSVendor = property(section, "Vendor")
+		fw.BIOSVersion = property(section, "Version")
+		fw.BIOSDate = property(section, "Release Date")
+	}
+
+	for _, section := range sections(info, dmi.TypeBaseboard) {
+		fw.BoardVendor = property(section, "Manufacturer")
+		fw.BoardProduct = property(section, "Product Name")
+		fw.BoardVersion = property(section, "Version")
+	}
+
+	return fw
+}
+
+func sections(info *dmi.DMI, typ dmi.Type) []dmi.SubSection {
+	if info == nil {
+		return nil
+	}
+
+	var result []dmi.SubSection
+	for _, section := range info.Sections {
+		if section.Type != typ {
+			continue
+		}
+
+		result = append(result, section.SubSections...)
+	}
+
+	return result
+}
+
+func property(section dmi.SubSection, name string) string {
+	return strings.TrimSpace(section.Properties[name].Val)
+}
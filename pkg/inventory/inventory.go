@@ -0,0 +1,126 @@
+package inventory
+
+import (
+	"context"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/zos/pkg"
+	"github.com/threefoldtech/zosbase/pkg/capacity"
+)
+
+const (
+	// commandTimeout is the max time we wait for an external tool (ethtool, smartctl)
+	commandTimeout = 10 * time.Second
+)
+
+var _ pkg.HardwareInventory = (*Manager)(nil)
+
+// Manager collects the node hardware inventory. Static information
+// (cpu, memory, firmware, gpus) is collected once, while nics and disks
+// are probed on each call since link state and attached disks can change.
+type Manager struct {
+	oracle *capacity.ResourceOracle
+
+	m      sync.Mutex
+	static *pkg.Inventory
+}
+
+// NewManager creates a new inventory manager
+func NewManager(oracle *capacity.ResourceOracle) *Manager {
+	return &Manager{oracle: oracle}
+}
+
+// Get implements pkg.HardwareInventory
+func (m *Manager) Get() (pkg.Inventory, error) {
+	inv, err := m.staticInventory()
+	if err != nil {
+		return inv, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	inv.NICs, err = NICs(ctx)
+	if err != nil {
+		return inv, errors.Wrap(err, "failed to list network interfaces")
+	}
+
+	inv.Disks, err = Disks(ctx)
+	if err != nil {
+		return inv, errors.Wrap(err, "failed to list disks")
+	}
+
+	return inv, nil
+}
+
+func (m *Manager) staticInventory() (pkg.Inventory, error) {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	if m.static != nil {
+		return *m.static, nil
+	}
+
+	var inv pkg.Inventory
+	var err error
+
+	inv.CPU, err = CPU()
+	if err != nil {
+		return inv, errors.Wrap(err, "failed to get cpu information")
+	}
+
+	dmi, err := m.oracle.DMI()
+	if err != nil {
+		return inv, errors.Wrap(err, "failed to get dmi information")
+	}
+
+	inv.Memory = DIMMs(dmi)
+	inv.Firmware = Firmware(dmi)
+
+	gpus, err := m.oracle.GPUs()
+	if err != nil {
+		return inv, errors.Wrap(err, "failed to list gpus")
+	}
+
+	for _, gpu := range gpus {
+		info := pkg.GPU{ID: gpu.ShortID()}
+		if vendor, device, ok := gpu.GetDevice(); ok {
+			info.Vendor = vendor.Name
+			info.Device = device.Name
+		}
+		inv.GPUs = append(inv.GPUs, info)
+	}
+
+	inv.Hypervisor, err = m.oracle.GetHypervisor()
+	if err != nil {
+		return inv, errors.Wrap(err, "failed to get hypervisor")
+	}
+
+	inv.SecureBoot, err = capacity.IsSecureBoot()
+	if err != nil {
+		// not fatal, same as during registration
+		log.Error().Err(err).Msg("failed to detect secure boot flags")
+	}
+
+	m.static = &inv
+	return inv, nil
+}
+
+// run runs a command and returns its output. it's okay for the command
+// to exit with an error as long as it produced some output, since tools like
+// smartctl use the exit code as a bit mask of the device status
+func run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, name, args...).Output()
+	if err != nil && len(output) == 0 {
+		return nil, errors.Wrapf(err, "failed to run '%s'", name)
+	}
+
+	return output, nil
+}
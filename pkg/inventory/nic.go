@@ -0,0 +1,122 @@
+package inventory
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/zos/pkg"
+)
+
+const (
+	// hostNS is the host network namespace, the physical nics are not in
+	// the ndmz namespace noded runs in
+	hostNS = "/proc/1/ns/net"
+	// sysClassNet is read from the host root, sysfs only shows the nics of
+	// the namespace it was mounted in
+	sysClassNet = "/proc/1/root/sys/class/net"
+)
+
+// NICs lists all physical network interfaces on the node, they are probed
+// in the host network namespace
+func NICs(ctx context.Context) ([]pkg.NIC, error) {
+	netNS, err := ns.GetNS(hostNS)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get host namespace")
+	}
+	defer netNS.Close()
+
+	var nics []pkg.NIC
+	err = netNS.Do(func(_ ns.NetNS) (err error) {
+		nics, err = hostNICs(ctx)
+		return err
+	})
+
+	return nics, err
+}
+
+// hostNICs lists the physical nics, it must run in the host namespace so
+// ethtool finds them
+func hostNICs(ctx context.Context) ([]pkg.NIC, error) {
+	entries, err := os.ReadDir(sysClassNet)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list '%s'", sysClassNet)
+	}
+
+	var nics []pkg.NIC
+	for _, entry := range entries {
+		name := entry.Name()
+		// only physical devices has a device link
+		if _, err := os.Stat(filepath.Join(sysClassNet, name, "device")); err != nil {
+			continue
+		}
+
+		nic := pkg.NIC{
+			Name: name,
+			Mac:  readSysFile(filepath.Join(sysClassNet, name, "address")),
+			Link: readSysFile(filepath.Join(sysClassNet, name, "operstate")) == "up",
+		}
+
+		// speed is -1 or not readable if link is down
+		if speed, err := strconv.ParseInt(readSysFile(filepath.Join(sysClassNet, name, "speed")), 10, 64); err == nil && speed > 0 {
+			nic.Speed = uint32(speed)
+		}
+
+		if output, err := run(ctx, "ethtool", "-i", name); err != nil {
+			log.Debug().Err(err).Str("nic", name).Msg("failed to get nic driver information")
+		} else {
+			values := parseEthtool(output)
+			nic.Driver = values["driver"]
+			nic.Firmware = values["firmware-version"]
+		}
+
+		if output, err := run(ctx, "ethtool", name); err != nil {
+			log.Debug().Err(err).Str("nic", name).Msg("failed to get nic settings")
+		} else {
+			values := parseEthtool(output)
+			nic.WOLSupported = values["Supports Wake-on"]
+			nic.WOL = values["Wake-on"]
+		}
+
+		nics = append(nics, nic)
+	}
+
+	return nics, nil
+}
+
+// parseEthtool parses the `key: value` output of ethtool
+func parseEthtool(output []byte) map[string]string {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+
+		key = strings.TrimSpace(key)
+		if _, exists := values[key]; exists {
+			continue
+		}
+
+		values[key] = strings.TrimSpace(value)
+	}
+
+	return values
+}
+
+func readSysFile(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/zosbase/pkg/kernel"
+)
+
+const (
+	// kernel param to enable the exporter. The value is an optional
+	// comma separated list of targets to listen on, default to zos
+	paramMetrics = "metrics"
+	// kernel param with a comma separated list of networks allowed
+	// to scrape the metrics
+	paramMetricsAllow = "metrics.allow"
+)
+
+// DefaultAllowed are the networks allowed to scrape the metrics if not configured.
+// Those are only private networks, so scraping over overlay networks must be
+// explicitly allowed.
+var DefaultAllowed = []string{
+	"127.0.0.0/8",
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"::1/128",
+	"fc00::/7",
+}
+
+// Config of the metrics exporter
+type Config struct {
+	Targets []Target
+	Allowed []net.IPNet
+}
+
+// ConfigFromKernel loads exporter configuration from kernel params. It returns
+// false if the exporter is not enabled
+func ConfigFromKernel(params kernel.Params) (Config, bool, error) {
+	if !params.Exists(paramMetrics) {
+		return Config{}, false, nil
+	}
+
+	targets, _ := params.GetOne(paramMetrics)
+	allowed, ok := params.GetOne(paramMetricsAllow)
+	if !ok {
+		allowed = strings.Join(DefaultAllowed, ",")
+	}
+
+	cfg, err := ParseConfig(targets, allowed)
+	return cfg, true, err
+}
+
+// ParseConfig parses comma separated lists of targets and allowed networks
+func ParseConfig(targets, allowed string) (Config, error) {
+	var cfg Config
+	for _, value := range split(targets) {
+		target := Target(value)
+		if err := target.Valid(); err != nil {
+			return cfg, err
+		}
+		cfg.Targets = append(cfg.Targets, target)
+	}
+
+	if len(cfg.Targets) == 0 {
+		cfg.Targets = []Target{TargetZOS}
+	}
+
+	for _, value := range split(allowed) {
+		if !strings.Contains(value, "/") {
+			// single ip
+			if strings.Contains(value, ":") {
+				value += "/128"
+			} else {
+				value += "/32"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return cfg, errors.Wrapf(err, "invalid allowed network '%s'", value)
+		}
+		cfg.Allowed = append(cfg.Allowed, *network)
+	}
+
+	return cfg, nil
+}
+
+func split(s string) []string {
+	var values []string
+	for _, value := range strings.Split(s, ",") {
+		value = strings.TrimSpace(value)
+		if len(value) != 0 {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// sourceTimeout is the max time a single source can take to collect its metrics
+const sourceTimeout = 10 * time.Second
+
+type namedSource struct {
+	name   string
+	source Source
+}
+
+// Exporter serves the metrics of all registered sources in openmetrics
+// format to the allowed clients
+type Exporter struct {
+	m       sync.RWMutex
+	sources []namedSource
+	allowed []net.IPNet
+}
+
+// NewExporter creates a new exporter that accepts scrapes only from clients
+// in the allowed networks
+func NewExporter(allowed []net.IPNet) *Exporter {
+	return &Exporter{allowed: allowed}
+}
+
+// Register a metrics source with given name
+func (e *Exporter) Register(name string, source Source) {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.sources = append(e.sources, namedSource{name: name, source: source})
+}
+
+// Allowed checks if the remote address is allowed to scrape the metrics
+func (e *Exporter) Allowed(ip net.IP) bool {
+	for _, network := range e.allowed {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Collect collects the metrics of all sources. A failing source does not fail
+// the collection, instead it's reported down with the `zos_exporter_source_up` metric.
+func (e *Exporter) Collect(ctx context.Context) *Registry {
+	e.m.RLock()
+	defer e.m.RUnlock()
+
+	registry := NewRegistry()
+	up := registry.Gauge("zos_exporter_source_up", "whether the last collection of the metrics source succeeded")
+	for _, s := range e.sources {
+		// each source collects to its own registry so a failing
+		// source does not leave partial metrics behind
+		sub := NewRegistry()
+		ctx, cancel := context.WithTimeout(ctx, sourceTimeout)
+		err := collect(ctx, s.source, sub)
+		cancel()
+
+		if err != nil {
+			log.Error().Err(err).Str("source", s.name).Msg("failed to collect metrics")
+			up.Add(0, "source", s.name)
+			continue
+		}
+
+		up.Add(1, "source", s.name)
+		registry.merge(sub)
+	}
+
+	return registry
+}
+
+// collect calls the source Collect. zbus stubs panic on
+// errors so panics are reported as errors
+func collect(ctx context.Context, source Source, r *Registry) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("%v", p)
+		}
+	}()
+
+	return source.Collect(ctx, r)
+}
+
+// ServeHTTP implements http.Handler
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil || !e.Allowed(net.ParseIP(host)) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	registry := e.Collect(r.Context())
+	w.Header().Set("Content-Type", ContentType)
+	if _, err := registry.WriteTo(w); err != nil {
+		log.Debug().Err(err).Msg("failed to write metrics")
+	}
+}
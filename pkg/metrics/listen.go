@@ -0,0 +1,213 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/zosbase/pkg/network/namespace"
+	"github.com/threefoldtech/zosbase/pkg/network/ndmz"
+	"github.com/threefoldtech/zosbase/pkg/network/types"
+	"github.com/vishvananda/netlink"
+)
+
+// Target is a network the exporter can listen on
+type Target string
+
+const (
+	// TargetZOS listens on the zos bridge addresses (farm lan)
+	TargetZOS Target = "zos"
+	// TargetYggdrasil listens on the node yggdrasil address
+	TargetYggdrasil Target = "ygg"
+	// TargetMycelium listens on the node mycelium address
+	TargetMycelium Target = "mycelium"
+)
+
+var (
+	yggRange      = mustParseCIDR("200::/7")
+	myceliumRange = mustParseCIDR("400::/7")
+)
+
+func mustParseCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// Valid checks if target is known
+func (t Target) Valid() error {
+	switch t {
+	case TargetZOS, TargetYggdrasil, TargetMycelium:
+		return nil
+	}
+
+	return fmt.Errorf("unknown metrics target '%s'", t)
+}
+
+// addresses returns the target addresses
+func (t Target) addresses() ([]net.IP, error) {
+	if t == TargetZOS {
+		return linkAddresses(types.DefaultBridge, nil)
+	}
+
+	subnet := yggRange
+	if t == TargetMycelium {
+		subnet = myceliumRange
+	}
+
+	var ips []net.IP
+	err := t.do(func() (err error) {
+		ips, err = linkAddresses("", subnet)
+		return err
+	})
+
+	return ips, err
+}
+
+// listen creates listeners on all given addresses of the target
+func (t Target) listen(ips []net.IP, port uint16) ([]net.Listener, error) {
+	var listeners []net.Listener
+	err := t.do(func() (err error) {
+		listeners, err = listenAll(ips, port)
+		return err
+	})
+
+	return listeners, err
+}
+
+// do runs fn in the target namespace. The overlay networks live
+// inside the ndmz namespace
+func (t Target) do(fn func() error) error {
+	if t == TargetZOS {
+		return fn()
+	}
+
+	netNS, err := namespace.GetByName(ndmz.NetNSNDMZ)
+	if err != nil {
+		return errors.Wrap(err, "failed to get ndmz namespace")
+	}
+	defer netNS.Close()
+
+	return netNS.Do(func(_ ns.NetNS) error {
+		return fn()
+	})
+}
+
+// linkAddresses returns the global unicast addresses of the link with name,
+// or of all links if name is empty, limited to subnet if given.
+func linkAddresses(name string, subnet *net.IPNet) ([]net.IP, error) {
+	var link netlink.Link
+	if len(name) != 0 {
+		var err error
+		link, err = netlink.LinkByName(name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get link '%s'", name)
+		}
+	}
+
+	addrs, err := netlink.AddrList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list addresses")
+	}
+
+	var ips []net.IP
+	for _, addr := range addrs {
+		if !addr.IP.IsGlobalUnicast() {
+			continue
+		}
+		if subnet != nil && !subnet.Contains(addr.IP) {
+			continue
+		}
+		ips = append(ips, addr.IP)
+	}
+
+	return ips, nil
+}
+
+func listenAll(ips []net.IP, port uint16) ([]net.Listener, error) {
+	var listeners []net.Listener
+	for _, ip := range ips {
+		l, err := net.Listen("tcp", net.JoinHostPort(ip.String(), strconv.Itoa(int(port))))
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, errors.Wrapf(err, "failed to listen on '%s'", ip)
+		}
+		listeners = append(listeners, l)
+	}
+
+	return listeners, nil
+}
+
+// Serve serves handler on port of all targets addresses until context is
+// cancelled. Addresses are checked periodically and listeners are recreated
+// if the addresses of a target change.
+func Serve(ctx context.Context, handler http.Handler, port uint16, targets ...Target) {
+	for _, target := range targets {
+		go serveTarget(ctx, handler, port, target)
+	}
+
+	<-ctx.Done()
+}
+
+func serveTarget(ctx context.Context, handler http.Handler, port uint16, target Target) {
+	var (
+		servers []*http.Server
+		current []string
+	)
+
+	shutdown := func() {
+		for _, server := range servers {
+			server.Close()
+		}
+		servers = nil
+	}
+	defer shutdown()
+
+	for {
+		ips, err := target.addresses()
+		if err != nil {
+			log.Error().Err(err).Str("target", string(target)).Msg("failed to get metrics target addresses")
+		}
+
+		var addresses []string
+		for _, ip := range ips {
+			addresses = append(addresses, ip.String())
+		}
+		slices.Sort(addresses)
+
+		if err == nil && !slices.Equal(addresses, current) {
+			shutdown()
+			current = nil
+
+			listeners, err := target.listen(ips, port)
+			if err != nil {
+				log.Error().Err(err).Str("target", string(target)).Msg("failed to listen for metrics")
+			} else {
+				for _, l := range listeners {
+					log.Info().Str("address", l.Addr().String()).Msg("serving metrics")
+					server := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+					servers = append(servers, server)
+					go server.Serve(l)
+				}
+				current = addresses
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Minute):
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ContentType of the openmetrics text exposition format
+	ContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+	typeGauge     = "gauge"
+	typeCounter   = "counter"
+	typeHistogram = "histogram"
+)
+
+type sample struct {
+	suffix string
+	labels []string
+	value  float64
+}
+
+// Family is a set of samples of the same metric
+type Family struct {
+	name    string
+	kind    string
+	help    string
+	samples []sample
+}
+
+// Add adds a sample to the metric family with the given labels. labels
+// must be given as key, value pairs. For counters the `_total` suffix is
+// added to the sample name.
+func (f *Family) Add(value float64, labels ...string) {
+	suffix := ""
+	if f.kind == typeCounter {
+		suffix = "_total"
+	}
+
+	f.Sample(suffix, value, labels...)
+}
+
+// Sample adds a sample with the given name suffix to the metric family. This
+// is needed for histograms where samples are `_bucket`, `_sum` and `_count`
+func (f *Family) Sample(suffix string, value float64, labels ...string) {
+	if len(labels)%2 != 0 {
+		panic("labels must be key value pairs")
+	}
+
+	f.samples = append(f.samples, sample{suffix: suffix, labels: labels, value: value})
+}
+
+// Registry holds the metric families collected during a single scrape
+type Registry struct {
+	families []*Family
+	index    map[string]*Family
+}
+
+// NewRegistry creates a new empty registry
+func NewRegistry() *Registry {
+	return &Registry{index: make(map[string]*Family)}
+}
+
+func (r *Registry) family(name, kind, help string) *Family {
+	if f, ok := r.index[name]; ok {
+		if f.kind != kind {
+			panic(fmt.Sprintf("metric '%s' already registered as %s", name, f.kind))
+		}
+		return f
+	}
+
+	f := &Family{name: name, kind: kind, help: help}
+	r.index[name] = f
+	r.families = append(r.families, f)
+	return f
+}
+
+// Gauge gets or creates a gauge metric family
+func (r *Registry) Gauge(name, help string) *Family {
+	return r.family(name, typeGauge, help)
+}
+
+// Counter gets or creates a counter metric family. name must not
+// include the `_total` suffix
+func (r *Registry) Counter(name, help string) *Family {
+	return r.family(name, typeCounter, help)
+}
+
+// Histogram gets or creates a histogram metric family
+func (r *Registry) Histogram(name, help string) *Family {
+	return r.family(name, typeHistogram, help)
+}
+
+// merge adds all samples from other registry
+func (r *Registry) merge(other *Registry) {
+	for _, f := range other.families {
+		target := r.family(f.name, f.kind, f.help)
+		target.samples = append(target.samples, f.samples...)
+	}
+}
+
+// WriteTo writes all metric families in openmetrics text format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	cw := &countWriter{w: w}
+	buf := bufio.NewWriter(cw)
+
+	for _, f := range r.families {
+		if len(f.samples) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(buf, "# TYPE %s %s\n", f.name, f.kind)
+		if len(f.help) != 0 {
+			fmt.Fprintf(buf, "# HELP %s %s\n", f.name, escape(f.help, false))
+		}
+
+		for _, s := range f.samples {
+			buf.WriteString(f.name)
+			buf.WriteString(s.suffix)
+			if len(s.labels) != 0 {
+				buf.WriteByte('{')
+				for i := 0; i < len(s.labels); i += 2 {
+					if i != 0 {
+						buf.WriteByte(',')
+					}
+					fmt.Fprintf(buf, `%s="%s"`, s.labels[i], escape(s.labels[i+1], true))
+				}
+				buf.WriteByte('}')
+			}
+			buf.WriteByte(' ')
+			buf.WriteString(formatValue(s.value))
+			buf.WriteByte('\n')
+		}
+	}
+
+	buf.WriteString("# EOF\n")
+	err := buf.Flush()
+	return cw.n, err
+}
+
+func escape(s string, quote bool) string {
+	r := strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	if quote {
+		r = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	}
+
+	return r.Replace(s)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRegistryWriteTo(t *testing.T) {
+	r := NewRegistry()
+	r.Gauge("zos_cpu_usage_percent", "cpu usage").Add(12.5)
+	r.Counter("zos_disk_reads", "").Add(10, "device", "sda")
+	r.Gauge("zos_empty", "no samples")
+	r.Gauge("zos_label", "").Add(1, "name", "a \"quoted\"\nvalue")
+
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# TYPE zos_cpu_usage_percent gauge
+# HELP zos_cpu_usage_percent cpu usage
+zos_cpu_usage_percent 12.5
+# TYPE zos_disk_reads counter
+zos_disk_reads_total{device="sda"} 10
+# TYPE zos_label gauge
+zos_label{name="a \"quoted\"\nvalue"} 1
+# EOF
+`
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\n%s", buf.String())
+	}
+}
+
+func TestQueueDepth(t *testing.T) {
+	dir := t.TempDir()
+
+	var segment bytes.Buffer
+	record := func(data string) {
+		var length [4]byte
+		binary.LittleEndian.PutUint32(length[:], uint32(len(data)))
+		segment.Write(length[:])
+		segment.WriteString(data)
+	}
+
+	record("one")
+	record("two")
+	record("three")
+	// deletion marker
+	record("")
+	// partially written record
+	segment.Write([]byte{10, 0})
+
+	if err := os.WriteFile(filepath.Join(dir, "0000000000001.dque"), segment.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	depth, err := QueueDepth(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if depth != 2 {
+		t.Errorf("expected depth 2, got %d", depth)
+	}
+}
@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// QueueSource reports the depth of all disk queues (dque) found
+// under a root directory, like the provision engine queues
+type QueueSource struct {
+	root string
+}
+
+// NewQueueSource creates a queue source for queues under root
+func NewQueueSource(root string) *QueueSource {
+	return &QueueSource{root: root}
+}
+
+// Collect implements Source
+func (q *QueueSource) Collect(ctx context.Context, r *Registry) error {
+	entries, err := os.ReadDir(q.root)
+	if err != nil {
+		return errors.Wrapf(err, "failed to list queues in '%s'", q.root)
+	}
+
+	depth := r.Gauge("zos_provision_queue_depth", "number of pending items in provision queues")
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		size, err := QueueDepth(filepath.Join(q.root, entry.Name()))
+		if err != nil {
+			return err
+		}
+
+		depth.Add(float64(size), "queue", entry.Name())
+	}
+
+	return nil
+}
+
+// QueueDepth returns the number of pending items in the dque at path.
+// The queue files are only read, hence it's safe to call while the
+// queue is held open (and locked) by another process.
+func QueueDepth(path string) (int, error) {
+	segments, err := filepath.Glob(filepath.Join(path, "*.dque"))
+	if err != nil {
+		return 0, err
+	}
+
+	var total int
+	for _, segment := range segments {
+		size, err := segmentSize(segment)
+		if err != nil {
+			return 0, errors.Wrapf(err, "failed to read queue segment '%s'", segment)
+		}
+		total += size
+	}
+
+	return total, nil
+}
+
+// segmentSize counts items in a dque segment file. The segment is a list of
+// records prefixed with their 4 bytes (little endian) length, a zero length
+// record marks the removal of the first item in the segment.
+func segmentSize(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var size int
+	var length [4]byte
+	for {
+		if _, err := io.ReadFull(f, length[:]); err == io.EOF {
+			break
+		} else if err != nil {
+			// a partially written record, most probably being
+			// written right now.
+			break
+		}
+
+		l := binary.LittleEndian.Uint32(length[:])
+		if l == 0 {
+			size--
+			continue
+		}
+
+		size++
+		if _, err := f.Seek(int64(l), io.SeekCurrent); err != nil {
+			return 0, err
+		}
+	}
+
+	if size < 0 {
+		return 0, errors.New("segment has excess deletion records")
+	}
+
+	return size, nil
+}
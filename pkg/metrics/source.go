@@ -0,0 +1,253 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/zbus"
+	zosstubs "github.com/threefoldtech/zos/pkg/stubs"
+	"github.com/threefoldtech/zosbase/pkg"
+	"github.com/threefoldtech/zosbase/pkg/stubs"
+)
+
+// Source adds its metrics to the registry on each scrape
+type Source interface {
+	Collect(ctx context.Context, r *Registry) error
+}
+
+// SourceFunc is a function that implements Source
+type SourceFunc func(ctx context.Context, r *Registry) error
+
+// Collect implements Source
+func (f SourceFunc) Collect(ctx context.Context, r *Registry) error {
+	return f(ctx, r)
+}
+
+// HostSource exposes the host cpu, memory, disks and storage pools metrics. The
+// metrics are streamed from the node and storage modules, and the last received
+// values are reported on scrape.
+type HostSource struct {
+	cl zbus.Client
+
+	m      sync.RWMutex
+	cpu    *pkg.TimesStat
+	memory *pkg.VirtualMemoryStat
+	disks  pkg.DisksIOCountersStat
+	pools  pkg.PoolsStats
+}
+
+// NewHostSource creates a new host source, Run must be called to start
+// receiving the metrics
+func NewHostSource(cl zbus.Client) *HostSource {
+	return &HostSource{cl: cl}
+}
+
+// Run subscribes to the metric streams until context is cancelled
+func (h *HostSource) Run(ctx context.Context) {
+	system := stubs.NewSystemMonitorStub(h.cl)
+	storage := stubs.NewStorageModuleStub(h.cl)
+
+	go follow(ctx, "cpu", system.CPU, func(v pkg.TimesStat) {
+		h.m.Lock()
+		defer h.m.Unlock()
+		h.cpu = &v
+	})
+	go follow(ctx, "memory", system.Memory, func(v pkg.VirtualMemoryStat) {
+		h.m.Lock()
+		defer h.m.Unlock()
+		h.memory = &v
+	})
+	go follow(ctx, "disks", system.Disks, func(v pkg.DisksIOCountersStat) {
+		h.m.Lock()
+		defer h.m.Unlock()
+		h.disks = v
+	})
+	go follow(ctx, "pools", storage.Monitor, func(v pkg.PoolsStats) {
+		h.m.Lock()
+		defer h.m.Unlock()
+		h.pools = v
+	})
+}
+
+// Collect implements Source
+func (h *HostSource) Collect(ctx context.Context, r *Registry) error {
+	h.m.RLock()
+	defer h.m.RUnlock()
+
+	if h.cpu != nil {
+		r.Gauge("zos_cpu_usage_percent", "cpu usage percent of the host").Add(h.cpu.Percent)
+	}
+
+	if h.memory != nil {
+		r.Gauge("zos_memory_total_bytes", "total memory of the host").Add(float64(h.memory.Total))
+		r.Gauge("zos_memory_used_bytes", "used memory of the host").Add(float64(h.memory.Used))
+		r.Gauge("zos_memory_available_bytes", "available memory of the host").Add(float64(h.memory.Available))
+	}
+
+	if len(h.disks) != 0 {
+		reads := r.Counter("zos_disk_reads", "completed reads of the disk")
+		writes := r.Counter("zos_disk_writes", "completed writes of the disk")
+		read := r.Counter("zos_disk_read_bytes", "bytes read from the disk")
+		written := r.Counter("zos_disk_written_bytes", "bytes written to the disk")
+		for name, disk := range h.disks {
+			reads.Add(float64(disk.ReadCount), "device", name)
+			writes.Add(float64(disk.WriteCount), "device", name)
+			read.Add(float64(disk.ReadBytes), "device", name)
+			written.Add(float64(disk.WriteBytes), "device", name)
+		}
+	}
+
+	if len(h.pools) != 0 {
+		size := r.Gauge("zos_pool_size_bytes", "size of the storage pool")
+		used := r.Gauge("zos_pool_used_bytes", "used space of the storage pool")
+		for name, pool := range h.pools {
+			size.Add(float64(pool.Total), "pool", name)
+			used.Add(float64(pool.Used), "pool", name)
+		}
+	}
+
+	return nil
+}
+
+// follow subscribes to a zbus stream and calls update on each received
+// value. It subscribes again if the stream is closed before the context
+// is cancelled.
+func follow[T any](ctx context.Context, name string, subscribe func(context.Context) (<-chan T, error), update func(T)) {
+	for {
+		ch, err := subscribe(ctx)
+		if err != nil {
+			log.Error().Err(err).Str("stream", name).Msg("failed to subscribe to metrics stream")
+		} else {
+			for v := range ch {
+				update(v)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(10 * time.Second):
+		}
+	}
+}
+
+// VMSource exposes the network counters of vms
+func VMSource(cl zbus.Client) Source {
+	return SourceFunc(func(ctx context.Context, r *Registry) error {
+		metrics, err := stubs.NewVMModuleStub(cl).Metrics(ctx)
+		if err != nil {
+			return errors.Wrap(err, "failed to get vms metrics")
+		}
+
+		vm := newNetFamilies(r, "zos_vm_network", "vm")
+		for name, metric := range metrics {
+			vm.add(metric.Private, "workload", name, "network", "private")
+			vm.add(metric.Public, "workload", name, "network", "public")
+		}
+
+		return nil
+	})
+}
+
+// NetworkSource exposes the network counters of network resources
+func NetworkSource(cl zbus.Client) Source {
+	return SourceFunc(func(ctx context.Context, r *Registry) error {
+		metrics, err := stubs.NewNetworkerStub(cl).Metrics(ctx)
+		if err != nil {
+			return errors.Wrap(err, "failed to get network resources metrics")
+		}
+
+		nr := newNetFamilies(r, "zos_network_resource", "network resource")
+		for name, metric := range metrics {
+			nr.add(metric, "workload", name)
+		}
+
+		return nil
+	})
+}
+
+// GatewaySource exposes the traffic counters of gateway workloads
+func GatewaySource(cl zbus.Client) Source {
+	return SourceFunc(func(ctx context.Context, r *Registry) error {
+		metrics, err := stubs.NewGatewayStub(cl).Metrics(ctx)
+		if err != nil {
+			return errors.Wrap(err, "failed to get gateways metrics")
+		}
+
+		request := r.Counter("zos_gateway_request_bytes", "bytes received by the gateway")
+		for name, value := range metrics.Request {
+			request.Add(value, "workload", name)
+		}
+
+		response := r.Counter("zos_gateway_response_bytes", "bytes sent by the gateway")
+		for name, value := range metrics.Response {
+			response.Add(value, "workload", name)
+		}
+
+		return nil
+	})
+}
+
+type netFamilies struct {
+	rxBytes, rxPackets, txBytes, txPackets *Family
+}
+
+func newNetFamilies(r *Registry, prefix, what string) netFamilies {
+	return netFamilies{
+		rxBytes:   r.Counter(prefix+"_receive_bytes", "bytes received by the "+what),
+		rxPackets: r.Counter(prefix+"_receive_packets", "packets received by the "+what),
+		txBytes:   r.Counter(prefix+"_transmit_bytes", "bytes transmitted by the "+what),
+		txPackets: r.Counter(prefix+"_transmit_packets", "packets transmitted by the "+what),
+	}
+}
+
+func (n *netFamilies) add(m pkg.NetMetric, labels ...string) {
+	n.rxBytes.Add(float64(m.NetRxBytes), labels...)
+	n.rxPackets.Add(float64(m.NetRxPackets), labels...)
+	n.txBytes.Add(float64(m.NetTxBytes), labels...)
+	n.txPackets.Add(float64(m.NetTxPackets), labels...)
+}
+
+// PublicDriftSource exposes the number of public config repairs done by networkd
+func PublicDriftSource(cl zbus.Client) Source {
+	return SourceFunc(func(ctx context.Context, r *Registry) error {
+		status := zosstubs.NewPublicDriftMonitorStub(cl).Status(ctx)
+
+		repairs := r.Counter("zos_public_config_repairs", "number of repaired drifts of the public config")
+		for kind, count := range status.Repairs {
+			repairs.Add(float64(count), "kind", kind)
+		}
+
+		return nil
+	})
+}
+
+// RMBSource exposes the rmb calls served by the api-gateway
+func RMBSource(cl zbus.Client) Source {
+	return SourceFunc(func(ctx context.Context, r *Registry) error {
+		stats := zosstubs.NewRMBTracerStub(cl).Stats(ctx)
+
+		requests := r.Counter("zos_rmb_requests", "rmb requests served by the node")
+		duration := r.Histogram("zos_rmb_request_duration_seconds", "duration of rmb requests served by the node")
+		for _, command := range stats {
+			for result, count := range command.Results {
+				requests.Add(float64(count), "command", command.Command, "result", result)
+			}
+
+			// stats counts are per bucket, openmetrics buckets are cumulative
+			var cumulative uint64
+			for i, bound := range command.Buckets {
+				cumulative += command.Counts[i]
+				duration.Sample("_bucket", float64(cumulative), "command", command.Command, "le", formatValue(bound))
+			}
+			duration.Sample("_bucket", float64(command.Total), "command", command.Command, "le", "+Inf")
+			duration.Sample("_sum", command.Sum, "command", command.Command)
+			duration.Sample("_count", float64(command.Total), "command", command.Command)
+		}
+
+		return nil
+	})
+}
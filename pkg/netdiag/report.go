@@ -0,0 +1,187 @@
+package netdiag
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// ReportPath is where the internet bootstrap writes its report, it's
+	// lost on reboot since /var/run is not persistent
+	ReportPath = "/var/run/network-bootstrap.json"
+
+	// keep is the number of bootstrap attempts kept in the report
+	keep = 10
+)
+
+// Interface is the state of a network interface
+type Interface struct {
+	Name      string   `json:"name"`
+	Type      string   `json:"type"`
+	MAC       string   `json:"mac"`
+	State     string   `json:"state"`
+	Master    string   `json:"master,omitempty"`
+	Addresses []string `json:"addresses"`
+	// Selected is set on the interface attached to the zos bridge
+	Selected bool `json:"selected"`
+}
+
+// Attempt is an attempt to configure the zos bridge
+type Attempt struct {
+	Time time.Time `json:"time"`
+	// Candidates are the interfaces that got an address while probing
+	Candidates []string `json:"candidates"`
+	Selected   string   `json:"selected"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// Route is an entry of the route table
+type Route struct {
+	Dst       string `json:"dst"`
+	Gateway   string `json:"gateway,omitempty"`
+	Interface string `json:"interface"`
+}
+
+// Resolution is the result of resolving a probe target host
+type Resolution struct {
+	Host      string        `json:"host"`
+	Addresses []string      `json:"addresses"`
+	Duration  time.Duration `json:"duration"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// Probe is the result of a tcp or http probe of a target
+type Probe struct {
+	Kind     string        `json:"kind"`
+	Target   string        `json:"target"`
+	Duration time.Duration `json:"duration"`
+	// Status is the http status of http probes
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Report is the network bootstrap diagnostics report
+type Report struct {
+	Started time.Time `json:"started"`
+	Updated time.Time `json:"updated"`
+	// Mode is how the zos bridge is configured (dhcp, static or ipv6)
+	Mode string `json:"mode"`
+	// Proxy is the http proxy the targets are probed through if any
+	Proxy     string `json:"proxy,omitempty"`
+	Connected bool   `json:"connected"`
+	// Checks is the number of connectivity checks
+	Checks     int          `json:"checks"`
+	Attempts   []Attempt    `json:"attempts"`
+	Interfaces []Interface  `json:"interfaces"`
+	Routes     []Route      `json:"routes"`
+	DNS        []Resolution `json:"dns"`
+	Probes     []Probe      `json:"probes"`
+}
+
+// Attempt adds a bootstrap attempt to the report, only the last attempts
+// are kept
+func (r *Report) Attempt(attempt Attempt) {
+	r.Attempts = append(r.Attempts, attempt)
+	if len(r.Attempts) > keep {
+		r.Attempts = r.Attempts[len(r.Attempts)-keep:]
+	}
+}
+
+// Summary is a short description of why the node is not connected, it's
+// empty if the node is connected
+func (r *Report) Summary() []string {
+	if r.Connected {
+		return nil
+	}
+
+	var lines []string
+	if len(r.Attempts) != 0 {
+		last := r.Attempts[len(r.Attempts)-1]
+		if len(last.Error) != 0 {
+			lines = append(lines, fmt.Sprintf("network bootstrap failed (%s): %s", r.Mode, last.Error))
+		}
+	}
+
+	if r.Checks != 0 {
+		lines = append(lines, fmt.Sprintf("no internet connection after %d checks (%s)", r.Checks, r.Mode))
+	}
+
+	var up []string
+	for _, inf := range r.Interfaces {
+		if inf.State == "up" {
+			up = append(up, inf.Name)
+		}
+	}
+
+	if len(up) == 0 && len(r.Interfaces) != 0 {
+		lines = append(lines, "no interface is up, check the cables")
+	}
+
+	hasDefault := false
+	for _, route := range r.Routes {
+		hasDefault = hasDefault || route.Dst == "default"
+	}
+
+	if !hasDefault && r.Checks != 0 {
+		lines = append(lines, "no default route")
+	}
+
+	for _, dns := range r.DNS {
+		if len(dns.Error) != 0 {
+			lines = append(lines, fmt.Sprintf("dns %s: %s", dns.Host, dns.Error))
+		}
+	}
+
+	for _, probe := range r.Probes {
+		if len(probe.Error) != 0 {
+			lines = append(lines, fmt.Sprintf("%s %s: %s", probe.Kind, probe.Target, probe.Error))
+		}
+	}
+
+	for _, inf := range r.Interfaces {
+		addresses := strings.Join(inf.Addresses, ", ")
+		if len(addresses) == 0 {
+			addresses = "no address"
+		}
+
+		lines = append(lines, fmt.Sprintf("%s (%s) %s: %s", inf.Name, inf.Type, inf.State, addresses))
+	}
+
+	return lines
+}
+
+// Save writes the report to path
+func (r *Report) Save(path string) error {
+	r.Updated = time.Now()
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to encode report")
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return errors.Wrap(err, "failed to write report")
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// Load reads the report from path
+func Load(path string) (Report, error) {
+	var report Report
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return report, err
+	}
+
+	if err := json.Unmarshal(data, &report); err != nil {
+		return report, errors.Wrap(err, "failed to decode report")
+	}
+
+	return report, nil
+}
@@ -0,0 +1,56 @@
+package netdiag
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReport(t *testing.T) {
+	var report Report
+	for i := 0; i < keep+5; i++ {
+		report.Attempt(Attempt{Time: time.Now(), Selected: "eth0"})
+	}
+
+	if len(report.Attempts) != keep {
+		t.Fatalf("expected %d attempts, got %d", keep, len(report.Attempts))
+	}
+
+	report.Checks = 3
+	report.Interfaces = []Interface{{Name: "eth0", Type: "device", State: "down"}}
+	report.Probes = []Probe{{Kind: "tcp", Target: "hub.grid.tf:http", Error: "i/o timeout"}}
+
+	summary := report.Summary()
+	expected := []string{
+		"no internet connection after 3 checks ()",
+		"no interface is up, check the cables",
+		"no default route",
+		"tcp hub.grid.tf:http: i/o timeout",
+		"eth0 (device) down: no address",
+	}
+
+	if len(summary) != len(expected) {
+		t.Fatalf("unexpected summary %q", summary)
+	}
+
+	for i := range expected {
+		if summary[i] != expected[i] {
+			t.Fatalf("expected '%s', got '%s'", expected[i], summary[i])
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := report.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded.Connected = true
+	if len(loaded.Attempts) != keep || loaded.Summary() != nil {
+		t.Fatalf("unexpected loaded report %+v", loaded)
+	}
+}
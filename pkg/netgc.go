@@ -0,0 +1,34 @@
+package pkg
+
+import "time"
+
+//go:generate zbusc -module network -version 0.0.1 -name network-gc -package stubs github.com/threefoldtech/zos/pkg+NetworkGC stubs/network_gc_stub.go
+
+// NetworkGCObject is a kernel network object tracked by the garbage collector
+type NetworkGCObject struct {
+	// Kind is one of namespace, bridge, tap or link
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// Since is when the object was first seen unreferenced
+	Since time.Time `json:"since"`
+	// Removed is when the object was removed, zero if it's still pending
+	Removed time.Time `json:"removed"`
+}
+
+// NetworkGCStatus is the status of the network garbage collector
+type NetworkGCStatus struct {
+	// Checked is the time of the last check
+	Checked time.Time `json:"checked"`
+	// Pending are unreferenced objects that are waiting for the grace period
+	Pending []NetworkGCObject `json:"pending"`
+	// Removed are the last removed objects
+	Removed []NetworkGCObject `json:"removed"`
+	// Error of the last check if any
+	Error string `json:"error"`
+}
+
+// NetworkGC interface
+type NetworkGC interface {
+	// Status returns the garbage collector status
+	Status() NetworkGCStatus
+}
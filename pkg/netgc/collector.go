@@ -0,0 +1,361 @@
+package netgc
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/zos/pkg"
+	"github.com/threefoldtech/zosbase/pkg/network/namespace"
+	"github.com/vishvananda/netlink"
+)
+
+// object kinds
+const (
+	KindNamespace = "namespace"
+	KindBridge    = "bridge"
+	KindTap       = "tap"
+	KindLink      = "link"
+)
+
+const (
+	// keep is the number of removed objects kept in the status
+	keep = 100
+	// linkDir is the directory with the workload id symlinks to network files
+	linkDir = "link"
+)
+
+// netObject matches the names of network resource namespaces (n-<netid>)
+// and bridges (b-<netid>), the network id is 13 base58 characters
+var netObject = regexp.MustCompile(`^(n|b)-([1-9A-HJ-NP-Za-km-z]{13})$`)
+
+var _ pkg.NetworkGC = (*Collector)(nil)
+
+// object is a kernel object or a symlink, net is the network id it belongs
+// to if any. The network of a tap is the network of the bridge it's attached
+// to.
+type object struct {
+	kind string
+	name string
+	net  string
+}
+
+func (o object) key() string {
+	return o.kind + ":" + o.name
+}
+
+// Collector removes network resource namespaces, bridges and taps, and
+// workload symlinks that are not referenced by any network known to networkd
+// for longer than the grace period. Taps are only removed if no vm config of
+// vmd references them either.
+type Collector struct {
+	networks string
+	vms      string
+	grace    time.Duration
+
+	m       sync.RWMutex
+	pending map[string]pkg.NetworkGCObject
+	status  pkg.NetworkGCStatus
+}
+
+// NewCollector creates a new collector. networks is the directory where
+// networkd stores its network resources, and vms is the directory where vmd
+// stores the vms configs.
+func NewCollector(networks, vms string, grace time.Duration) *Collector {
+	return &Collector{
+		networks: networks,
+		vms:      vms,
+		grace:    grace,
+		pending:  make(map[string]pkg.NetworkGCObject),
+	}
+}
+
+// Status implements pkg.NetworkGC
+func (c *Collector) Status() pkg.NetworkGCStatus {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	status := c.status
+	status.Pending = append([]pkg.NetworkGCObject(nil), c.status.Pending...)
+	status.Removed = append([]pkg.NetworkGCObject(nil), c.status.Removed...)
+	return status
+}
+
+// Run checks for unreferenced objects every interval until context is
+// cancelled
+func (c *Collector) Run(ctx context.Context, interval time.Duration) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+
+		err := c.collect(time.Now())
+		if err != nil {
+			log.Error().Err(err).Msg("failed to collect orphaned network objects")
+		}
+
+		c.m.Lock()
+		c.status.Checked = time.Now()
+		c.status.Error = ""
+		if err != nil {
+			c.status.Error = err.Error()
+		}
+		c.m.Unlock()
+	}
+}
+
+func (c *Collector) collect(now time.Time) error {
+	known, links, err := c.known()
+	if os.IsNotExist(errors.Cause(err)) {
+		// nothing can be told about kernel objects if networkd didn't
+		// store its networks yet
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// no tap can be told unreferenced if vmd didn't store its configs yet
+	taps, err := c.taps()
+	vmd := !os.IsNotExist(errors.Cause(err))
+	if err != nil && vmd {
+		return err
+	}
+
+	objects, err := liveObjects()
+	if err != nil {
+		return err
+	}
+
+	var live []object
+	for _, obj := range objects {
+		if _, ok := taps[obj.name]; obj.kind == KindTap && (ok || !vmd) {
+			continue
+		}
+		live = append(live, obj)
+	}
+
+	for _, link := range links {
+		if _, ok := known[link.net]; !ok {
+			live = append(live, link)
+		}
+	}
+
+	for _, due := range c.due(now, live, known) {
+		if err := c.remove(due); err != nil {
+			log.Error().Err(err).Str("kind", due.kind).Str("name", due.name).Msg("failed to remove orphaned network object")
+			continue
+		}
+
+		log.Info().Str("kind", due.kind).Str("name", due.name).Msg("removed orphaned network object")
+		c.removed(due, now)
+	}
+
+	return nil
+}
+
+// known returns the ids of the networks stored by networkd, and the workload
+// symlinks with the network they point to
+func (c *Collector) known() (map[string]struct{}, []object, error) {
+	entries, err := os.ReadDir(c.networks)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to list networks")
+	}
+
+	known := make(map[string]struct{})
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			known[entry.Name()] = struct{}{}
+		}
+	}
+
+	dir := filepath.Join(c.networks, linkDir)
+	entries, err = os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, errors.Wrap(err, "failed to list network links")
+	}
+
+	var links []object
+	for _, entry := range entries {
+		target, err := os.Readlink(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+
+		links = append(links, object{kind: KindLink, name: entry.Name(), net: filepath.Base(target)})
+	}
+
+	return known, links, nil
+}
+
+// taps returns the taps referenced by the vms configs
+func (c *Collector) taps() (map[string]struct{}, error) {
+	entries, err := os.ReadDir(c.vms)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list vms configs")
+	}
+
+	taps := make(map[string]struct{})
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(c.vms, entry.Name()))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read vm config '%s'", entry.Name())
+		}
+
+		var config struct {
+			Interfaces []struct {
+				Tap string `json:"tap"`
+			} `json:"interfaces"`
+		}
+
+		if err := json.Unmarshal(data, &config); err != nil {
+			// a config that can't be read may reference any tap
+			return nil, errors.Wrapf(err, "failed to decode vm config '%s'", entry.Name())
+		}
+
+		for _, inf := range config.Interfaces {
+			taps[inf.Tap] = struct{}{}
+		}
+	}
+
+	return taps, nil
+}
+
+// liveObjects lists the network resource namespaces, bridges and taps
+func liveObjects() ([]object, error) {
+	var objects []object
+
+	namespaces, err := namespace.List("n-")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list namespaces")
+	}
+
+	for _, name := range namespaces {
+		if match := netObject.FindStringSubmatch(name); match != nil && match[1] == "n" {
+			objects = append(objects, object{kind: KindNamespace, name: name, net: match[2]})
+		}
+	}
+
+	links, err := netlink.LinkList()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list links")
+	}
+
+	names := make(map[int]string)
+	for _, link := range links {
+		names[link.Attrs().Index] = link.Attrs().Name
+	}
+
+	for _, link := range links {
+		attrs := link.Attrs()
+		if match := netObject.FindStringSubmatch(attrs.Name); match != nil && match[1] == "b" && link.Type() == "bridge" {
+			objects = append(objects, object{kind: KindBridge, name: attrs.Name, net: match[2]})
+			continue
+		}
+
+		// only the workload taps are collected, they are all attached to a
+		// bridge. A tap without a process (vm) attached has no carrier.
+		if link.Type() != "tuntap" || attrs.MasterIndex == 0 || attrs.OperState == netlink.OperUp || attrs.OperState == netlink.OperUnknown {
+			continue
+		}
+
+		tap := object{kind: KindTap, name: attrs.Name}
+		if match := netObject.FindStringSubmatch(names[attrs.MasterIndex]); match != nil && match[1] == "b" {
+			tap.net = match[2]
+		}
+		objects = append(objects, tap)
+	}
+
+	return objects, nil
+}
+
+// due tracks the unreferenced objects and returns the ones that were
+// unreferenced for longer than the grace period. Objects of known networks
+// are referenced. Taps referenced by a vm are not listed, nor the taps with
+// a process attached.
+func (c *Collector) due(now time.Time, live []object, known map[string]struct{}) []object {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	pending := make(map[string]pkg.NetworkGCObject)
+	var due []object
+	for _, obj := range live {
+		if _, ok := known[obj.net]; ok && len(obj.net) != 0 {
+			continue
+		}
+
+		tracked, ok := c.pending[obj.key()]
+		if !ok {
+			tracked = pkg.NetworkGCObject{Kind: obj.kind, Name: obj.name, Since: now}
+		}
+
+		if now.Sub(tracked.Since) >= c.grace {
+			due = append(due, obj)
+		}
+		pending[obj.key()] = tracked
+	}
+
+	c.pending = pending
+	c.status.Pending = c.status.Pending[:0]
+	for _, obj := range pending {
+		c.status.Pending = append(c.status.Pending, obj)
+	}
+	sort.Slice(c.status.Pending, func(i, j int) bool {
+		return c.status.Pending[i].Since.Before(c.status.Pending[j].Since)
+	})
+
+	return due
+}
+
+func (c *Collector) removed(obj object, now time.Time) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	tracked := c.pending[obj.key()]
+	delete(c.pending, obj.key())
+	for i, pending := range c.status.Pending {
+		if pending.Kind == obj.kind && pending.Name == obj.name {
+			c.status.Pending = append(c.status.Pending[:i], c.status.Pending[i+1:]...)
+			break
+		}
+	}
+
+	tracked.Removed = now
+	c.status.Removed = append(c.status.Removed, tracked)
+	if len(c.status.Removed) > keep {
+		c.status.Removed = c.status.Removed[len(c.status.Removed)-keep:]
+	}
+}
+
+func (c *Collector) remove(obj object) error {
+	switch obj.kind {
+	case KindNamespace:
+		netNS, err := namespace.GetByName(obj.name)
+		if err != nil {
+			return err
+		}
+		return namespace.Delete(netNS)
+	case KindBridge, KindTap:
+		link, err := netlink.LinkByName(obj.name)
+		if err != nil {
+			return err
+		}
+		return netlink.LinkDel(link)
+	case KindLink:
+		return os.Remove(filepath.Join(c.networks, linkDir, obj.name))
+	}
+
+	return errors.Errorf("unknown object kind '%s'", obj.kind)
+}
@@ -0,0 +1,134 @@
+package netgc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/zosbase/pkg/gridtypes/zos"
+)
+
+func TestDue(t *testing.T) {
+	c := NewCollector("", "", time.Hour)
+	known := map[string]struct{}{"27xVrq9bva3vJ": {}}
+	live := []object{
+		{kind: KindNamespace, name: "n-27xVrq9bva3vJ", net: "27xVrq9bva3vJ"},
+		{kind: KindNamespace, name: "n-38yWsr1cwb4wK", net: "38yWsr1cwb4wK"},
+		{kind: KindTap, name: "t-vm"},
+		{kind: KindTap, name: "t-known", net: "27xVrq9bva3vJ"},
+	}
+
+	now := time.Now()
+	if due := c.due(now, live, known); len(due) != 0 {
+		t.Fatalf("objects must not be removed before the grace period: %v", due)
+	}
+
+	if pending := c.Status().Pending; len(pending) != 2 {
+		t.Fatalf("expected 2 pending objects got %v", pending)
+	}
+
+	// the tap got a process attached again
+	due := c.due(now.Add(2*time.Hour), append(live[:2:2], live[3]), known)
+	if len(due) != 1 || due[0].name != "n-38yWsr1cwb4wK" {
+		t.Fatalf("expected orphaned namespace to be due, got %v", due)
+	}
+
+	c.removed(due[0], now)
+	status := c.Status()
+	if len(status.Pending) != 0 || len(status.Removed) != 1 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	// a tap seen again starts a new grace period
+	if due := c.due(now.Add(3*time.Hour), live, known); len(due) != 0 {
+		t.Fatalf("expected no due objects got %v", due)
+	}
+}
+
+func TestKnown(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "27xVrq9bva3vJ"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(root, linkDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink("../38yWsr1cwb4wK", filepath.Join(root, linkDir, "1-2-net")); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCollector(root, "", time.Hour)
+	known, links, err := c.known()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := known["27xVrq9bva3vJ"]; !ok || len(known) != 1 {
+		t.Fatalf("unexpected known networks %v", known)
+	}
+
+	if len(links) != 1 || links[0].net != "38yWsr1cwb4wK" {
+		t.Fatalf("unexpected links %v", links)
+	}
+
+	if _, _, err := NewCollector(filepath.Join(root, "missing"), "", time.Hour).known(); !os.IsNotExist(errors.Cause(err)) {
+		t.Fatalf("expected not exist error got %v", err)
+	}
+}
+
+func TestTaps(t *testing.T) {
+	root := t.TempDir()
+	config := `{"name": "vm", "interfaces": [{"id": "eth0", "tap": "t-vm", "mac": "aa:bb:cc:dd:ee:ff"}]}`
+	if err := os.WriteFile(filepath.Join(root, "1-2-vm"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	taps, err := NewCollector("", root, time.Hour).taps()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := taps["t-vm"]; !ok || len(taps) != 1 {
+		t.Fatalf("unexpected taps %v", taps)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "1-3-vm"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewCollector("", root, time.Hour).taps(); err == nil {
+		t.Fatal("expected error for a config that can't be read")
+	}
+}
+
+func TestNetObject(t *testing.T) {
+	id := string(zos.NetworkID(29, "mynetwork"))
+	for _, c := range []struct {
+		name string
+		kind string
+	}{
+		{"n-" + id, "n"},
+		{"b-" + id, "b"},
+		{"br-" + id, ""},
+		{"br-pub", ""},
+		{"br-ndmz", ""},
+		{"b-" + id[:12], ""},
+		{"t-" + id, ""},
+	} {
+		match := netObject.FindStringSubmatch(c.name)
+		if len(c.kind) == 0 {
+			if match != nil {
+				t.Errorf("'%s' must not match a network object", c.name)
+			}
+			continue
+		}
+
+		if match == nil || match[1] != c.kind || match[2] != id {
+			t.Errorf("expected '%s' to match network '%s', got %v", c.name, id, match)
+		}
+	}
+}
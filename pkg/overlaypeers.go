@@ -0,0 +1,39 @@
+package pkg
+
+import "time"
+
+//go:generate zbusc -module network -version 0.0.1 -name overlay-peers -package stubs github.com/threefoldtech/zos/pkg+OverlayPeers stubs/overlay_peers_stub.go
+
+// overlays
+const (
+	OverlayYggdrasil = "yggdrasil"
+	OverlayMycelium  = "mycelium"
+)
+
+// OverlayPeer is a peer of an overlay network daemon
+type OverlayPeer struct {
+	Endpoint string `json:"endpoint"`
+	Up       bool   `json:"up"`
+	Inbound  bool   `json:"inbound"`
+	// Latency is only reported by yggdrasil
+	Latency time.Duration `json:"latency"`
+	RxBytes uint64        `json:"rx_bytes"`
+	TxBytes uint64        `json:"tx_bytes"`
+	// Added is set if the peer was added through the api
+	Added  bool `json:"added"`
+	Pinned bool `json:"pinned"`
+}
+
+// OverlayPeers interface to manage the peers of the overlay networks
+// daemons. Changes are persisted and applied again on restart.
+type OverlayPeers interface {
+	// Peers lists the current peers of the overlay
+	Peers(overlay string) ([]OverlayPeer, error)
+	// AddPeer adds a peer to the overlay
+	AddPeer(overlay, endpoint string) error
+	// RemovePeer removes a peer from the overlay, pinned peers can't be removed
+	RemovePeer(overlay, endpoint string) error
+	// PinPeer pins or unpins a peer. Pinned peers are added back if they
+	// are dropped by the daemon.
+	PinPeer(overlay, endpoint string, pinned bool) error
+}
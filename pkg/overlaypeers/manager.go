@@ -0,0 +1,404 @@
+package overlaypeers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/zos/pkg"
+)
+
+// callTimeout is the timeout of a single call to an overlay daemon
+const callTimeout = 10 * time.Second
+
+var (
+	_ pkg.OverlayPeers = (*Manager)(nil)
+
+	// schemes are the supported peer endpoint schemes per overlay
+	schemes = map[string][]string{
+		pkg.OverlayYggdrasil: {"tcp", "tls", "quic", "ws", "wss"},
+		pkg.OverlayMycelium:  {"tcp", "quic"},
+	}
+)
+
+type daemon interface {
+	peers(ctx context.Context) ([]pkg.OverlayPeer, error)
+	add(ctx context.Context, endpoint string) error
+	remove(ctx context.Context, endpoint string) error
+}
+
+// overlayState is the persisted peers changes of an overlay
+type overlayState struct {
+	// Added are peers added through the api
+	Added []string `json:"added"`
+	// Removed are peers removed through the api, they are removed again if
+	// the daemon config has them
+	Removed []string `json:"removed"`
+	// Pinned are added peers that can't be removed
+	Pinned []string `json:"pinned"`
+}
+
+// Manager manages the peers of the yggdrasil and mycelium daemons
+type Manager struct {
+	path    string
+	daemons map[string]daemon
+
+	m     sync.Mutex
+	state map[string]*overlayState
+}
+
+// NewManager creates a new peers manager that persists its state in path.
+// mycelium runs in namespace myceliumNS. Only the peers of the given
+// overlays are managed.
+func NewManager(path, myceliumNS string, overlays ...string) (*Manager, error) {
+	m := &Manager{
+		path:    path,
+		daemons: make(map[string]daemon),
+		state:   make(map[string]*overlayState),
+	}
+
+	for _, overlay := range overlays {
+		switch overlay {
+		case pkg.OverlayYggdrasil:
+			m.daemons[overlay] = &yggdrasil{socket: yggdrasilSocket}
+		case pkg.OverlayMycelium:
+			m.daemons[overlay] = newMycelium(myceliumNS)
+		default:
+			return nil, fmt.Errorf("unknown overlay '%s'", overlay)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "failed to read overlay peers")
+	} else if err == nil {
+		if err := json.Unmarshal(data, &m.state); err != nil {
+			return nil, errors.Wrap(err, "failed to decode overlay peers")
+		}
+	}
+
+	for overlay := range schemes {
+		if _, ok := m.state[overlay]; !ok {
+			m.state[overlay] = &overlayState{}
+		}
+	}
+
+	return m, nil
+}
+
+// normalize validates the endpoint and returns it as scheme://host:port with
+// the query if any
+func normalize(overlay, endpoint string) (string, error) {
+	allowed, ok := schemes[overlay]
+	if !ok {
+		return "", fmt.Errorf("unknown overlay '%s'", overlay)
+	}
+
+	u, err := url.Parse(strings.TrimSpace(endpoint))
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid endpoint '%s'", endpoint)
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	supported := false
+	for _, s := range allowed {
+		supported = supported || s == scheme
+	}
+
+	if !supported {
+		return "", fmt.Errorf("%s doesn't support '%s' endpoints", overlay, u.Scheme)
+	}
+
+	if _, _, err := net.SplitHostPort(u.Host); err != nil {
+		return "", errors.Wrapf(err, "invalid endpoint '%s'", endpoint)
+	}
+
+	normalized := fmt.Sprintf("%s://%s", scheme, strings.ToLower(u.Host))
+	if len(u.RawQuery) != 0 {
+		normalized += "?" + u.RawQuery
+	}
+
+	return normalized, nil
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func with(list []string, value string) []string {
+	if contains(list, value) {
+		return list
+	}
+
+	list = append(list, value)
+	sort.Strings(list)
+	return list
+}
+
+func without(list []string, value string) []string {
+	result := list[:0]
+	for _, v := range list {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
+
+// save persists the state, must be called with m.m held
+func (m *Manager) save() error {
+	data, err := json.Marshal(m.state)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode overlay peers")
+	}
+
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return errors.Wrap(err, "failed to write overlay peers")
+	}
+
+	return os.Rename(tmp, m.path)
+}
+
+// daemon returns the daemon of the overlay, it fails if the overlay is
+// unknown or not running on this node
+func (m *Manager) daemon(overlay string) (daemon, error) {
+	if _, ok := schemes[overlay]; !ok {
+		return nil, fmt.Errorf("unknown overlay '%s'", overlay)
+	}
+
+	d, ok := m.daemons[overlay]
+	if !ok {
+		return nil, fmt.Errorf("overlay '%s' is not running", overlay)
+	}
+
+	return d, nil
+}
+
+// Peers implements pkg.OverlayPeers
+func (m *Manager) Peers(overlay string) ([]pkg.OverlayPeer, error) {
+	d, err := m.daemon(overlay)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+
+	peers, err := d.peers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	state := m.state[overlay]
+	for i := range peers {
+		endpoint, err := normalize(overlay, peers[i].Endpoint)
+		if err != nil {
+			continue
+		}
+
+		peers[i].Added = contains(state.Added, endpoint)
+		peers[i].Pinned = contains(state.Pinned, endpoint)
+	}
+
+	return peers, nil
+}
+
+// AddPeer implements pkg.OverlayPeers
+func (m *Manager) AddPeer(overlay, endpoint string) error {
+	endpoint, err := normalize(overlay, endpoint)
+	if err != nil {
+		return err
+	}
+
+	d, err := m.daemon(overlay)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	current, err := m.current(ctx, overlay)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := current[endpoint]; !ok {
+		if err := d.add(ctx, endpoint); err != nil {
+			return errors.Wrapf(err, "failed to add %s peer '%s'", overlay, endpoint)
+		}
+	}
+
+	state := m.state[overlay]
+	state.Added = with(state.Added, endpoint)
+	state.Removed = without(state.Removed, endpoint)
+	return m.save()
+}
+
+// RemovePeer implements pkg.OverlayPeers
+func (m *Manager) RemovePeer(overlay, endpoint string) error {
+	endpoint, err := normalize(overlay, endpoint)
+	if err != nil {
+		return err
+	}
+
+	d, err := m.daemon(overlay)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	state := m.state[overlay]
+	if contains(state.Pinned, endpoint) {
+		return fmt.Errorf("%s peer '%s' is pinned", overlay, endpoint)
+	}
+
+	current, err := m.current(ctx, overlay)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := current[endpoint]; ok {
+		if err := d.remove(ctx, endpoint); err != nil {
+			return errors.Wrapf(err, "failed to remove %s peer '%s'", overlay, endpoint)
+		}
+	}
+
+	state.Added = without(state.Added, endpoint)
+	state.Removed = with(state.Removed, endpoint)
+	return m.save()
+}
+
+// PinPeer implements pkg.OverlayPeers
+func (m *Manager) PinPeer(overlay, endpoint string, pinned bool) error {
+	endpoint, err := normalize(overlay, endpoint)
+	if err != nil {
+		return err
+	}
+
+	if pinned {
+		// a pinned peer is always added
+		if err := m.AddPeer(overlay, endpoint); err != nil {
+			return err
+		}
+	}
+
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	state := m.state[overlay]
+	if pinned {
+		state.Pinned = with(state.Pinned, endpoint)
+	} else {
+		state.Pinned = without(state.Pinned, endpoint)
+	}
+
+	return m.save()
+}
+
+// Run applies the persisted changes to the daemons every interval until the
+// context is cancelled. This also covers daemons restarted with their
+// packaged config.
+func (m *Manager) Run(ctx context.Context, interval time.Duration) {
+	for {
+		for overlay := range m.daemons {
+			if err := m.reconcile(ctx, overlay); err != nil {
+				log.Error().Err(err).Str("overlay", overlay).Msg("failed to reconcile overlay peers")
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// current returns the outbound peers of the overlay daemon
+func (m *Manager) current(ctx context.Context, overlay string) (map[string]struct{}, error) {
+	peers, err := m.daemons[overlay].peers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[string]struct{})
+	for _, peer := range peers {
+		if peer.Inbound {
+			continue
+		}
+
+		if endpoint, err := normalize(overlay, peer.Endpoint); err == nil {
+			current[endpoint] = struct{}{}
+		}
+	}
+
+	return current, nil
+}
+
+func (m *Manager) reconcile(ctx context.Context, overlay string) error {
+	ctx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	current, err := m.current(ctx, overlay)
+	if err != nil {
+		return err
+	}
+
+	d := m.daemons[overlay]
+	state := m.state[overlay]
+	for _, endpoint := range state.Added {
+		if _, ok := current[endpoint]; ok {
+			continue
+		}
+
+		log.Info().Str("overlay", overlay).Str("peer", endpoint).Msg("adding overlay peer")
+		if err := d.add(ctx, endpoint); err != nil {
+			log.Error().Err(err).Str("overlay", overlay).Str("peer", endpoint).Msg("failed to add overlay peer")
+		}
+	}
+
+	for _, endpoint := range state.Removed {
+		if _, ok := current[endpoint]; !ok {
+			continue
+		}
+
+		log.Info().Str("overlay", overlay).Str("peer", endpoint).Msg("removing overlay peer")
+		if err := d.remove(ctx, endpoint); err != nil {
+			log.Error().Err(err).Str("overlay", overlay).Str("peer", endpoint).Msg("failed to remove overlay peer")
+		}
+	}
+
+	return nil
+}
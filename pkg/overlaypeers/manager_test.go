@@ -0,0 +1,112 @@
+package overlaypeers
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/threefoldtech/zos/pkg"
+)
+
+type testDaemon struct {
+	endpoints map[string]bool
+}
+
+func (d *testDaemon) peers(ctx context.Context) ([]pkg.OverlayPeer, error) {
+	var peers []pkg.OverlayPeer
+	for endpoint := range d.endpoints {
+		peers = append(peers, pkg.OverlayPeer{Endpoint: endpoint, Up: true})
+	}
+	return peers, nil
+}
+
+func (d *testDaemon) add(ctx context.Context, endpoint string) error {
+	d.endpoints[endpoint] = true
+	return nil
+}
+
+func (d *testDaemon) remove(ctx context.Context, endpoint string) error {
+	delete(d.endpoints, endpoint)
+	return nil
+}
+
+func testManager(t *testing.T, path string, d daemon) *Manager {
+	m, err := NewManager(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.daemons = map[string]daemon{pkg.OverlayMycelium: d}
+	return m
+}
+
+func TestNormalize(t *testing.T) {
+	endpoint, err := normalize(pkg.OverlayMycelium, "TCP://1.2.3.4:9651")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if endpoint != "tcp://1.2.3.4:9651" {
+		t.Fatalf("unexpected endpoint '%s'", endpoint)
+	}
+
+	for _, invalid := range []string{"tls://1.2.3.4:9651", "tcp://1.2.3.4", "1.2.3.4:9651"} {
+		if _, err := normalize(pkg.OverlayMycelium, invalid); err == nil {
+			t.Fatalf("expected '%s' to be invalid", invalid)
+		}
+	}
+
+	if _, err := normalize("zerotier", "tcp://1.2.3.4:9651"); err == nil {
+		t.Fatal("expected unknown overlay error")
+	}
+}
+
+func TestManager(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.json")
+	d := &testDaemon{endpoints: map[string]bool{"tcp://10.0.0.1:9651": true}}
+	m := testManager(t, path, d)
+
+	if err := m.PinPeer(pkg.OverlayMycelium, "tcp://10.0.0.2:9651", true); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.RemovePeer(pkg.OverlayMycelium, "tcp://10.0.0.2:9651"); err == nil {
+		t.Fatal("pinned peer must not be removed")
+	}
+
+	if err := m.RemovePeer(pkg.OverlayMycelium, "tcp://10.0.0.1:9651"); err != nil {
+		t.Fatal(err)
+	}
+
+	// daemon restarted with its packaged config
+	d.endpoints = map[string]bool{"tcp://10.0.0.1:9651": true}
+	m = testManager(t, path, d)
+	if err := m.reconcile(context.Background(), pkg.OverlayMycelium); err != nil {
+		t.Fatal(err)
+	}
+
+	if d.endpoints["tcp://10.0.0.1:9651"] || !d.endpoints["tcp://10.0.0.2:9651"] {
+		t.Fatalf("persisted changes are not applied: %v", d.endpoints)
+	}
+
+	peers, err := m.Peers(pkg.OverlayMycelium)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(peers) != 1 || !peers[0].Added || !peers[0].Pinned {
+		t.Fatalf("unexpected peers %+v", peers)
+	}
+}
+
+func TestNotRunning(t *testing.T) {
+	m := testManager(t, filepath.Join(t.TempDir(), "peers.json"), &testDaemon{endpoints: map[string]bool{}})
+
+	if _, err := m.Peers(pkg.OverlayYggdrasil); err == nil {
+		t.Fatal("peers of an overlay that is not running must fail")
+	}
+
+	if err := m.AddPeer(pkg.OverlayYggdrasil, "tcp://10.0.0.1:9651"); err == nil {
+		t.Fatal("adding a peer to an overlay that is not running must fail")
+	}
+}
@@ -0,0 +1,119 @@
+package overlaypeers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/zos/pkg"
+	"github.com/threefoldtech/zosbase/pkg/network/namespace"
+)
+
+// myceliumAPI is the address of the mycelium http api inside its namespace
+const myceliumAPI = "127.0.0.1:8989"
+
+// mycelium talks to the mycelium http api. The api only listens on the
+// loopback of the namespace mycelium runs in.
+type mycelium struct {
+	client *http.Client
+}
+
+func newMycelium(netns string) *mycelium {
+	dial := func(ctx context.Context, network, addr string) (conn net.Conn, err error) {
+		netNS, err := namespace.GetByName(netns)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get namespace '%s'", netns)
+		}
+		defer netNS.Close()
+
+		// the socket stays in the namespace it was created in
+		err = netNS.Do(func(_ ns.NetNS) error {
+			var dialer net.Dialer
+			conn, err = dialer.DialContext(ctx, network, addr)
+			return err
+		})
+
+		return conn, err
+	}
+
+	return &mycelium{
+		client: &http.Client{
+			Transport: &http.Transport{DialContext: dial, DisableKeepAlives: true},
+		},
+	}
+}
+
+func (m *mycelium) do(ctx context.Context, method, path string, body interface{}, response interface{}) error {
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("http://%s/api/v1/admin/%s", myceliumAPI, path), &payload)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	res, err := m.client.Do(request)
+	if err != nil {
+		return errors.Wrap(err, "failed to call mycelium api")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("mycelium api %s %s failed: %s", method, path, res.Status)
+	}
+
+	if response == nil {
+		return nil
+	}
+
+	return json.NewDecoder(res.Body).Decode(response)
+}
+
+func (m *mycelium) peers(ctx context.Context) ([]pkg.OverlayPeer, error) {
+	var response []struct {
+		Endpoint struct {
+			Proto      string `json:"proto"`
+			SocketAddr string `json:"socketAddr"`
+		} `json:"endpoint"`
+		Type            string `json:"type"`
+		ConnectionState string `json:"connectionState"`
+		TxBytes         uint64 `json:"txBytes"`
+		RxBytes         uint64 `json:"rxBytes"`
+	}
+
+	if err := m.do(ctx, http.MethodGet, "peers", nil, &response); err != nil {
+		return nil, err
+	}
+
+	peers := make([]pkg.OverlayPeer, 0, len(response))
+	for _, peer := range response {
+		peers = append(peers, pkg.OverlayPeer{
+			Endpoint: fmt.Sprintf("%s://%s", peer.Endpoint.Proto, peer.Endpoint.SocketAddr),
+			Up:       peer.ConnectionState == "connected",
+			Inbound:  peer.Type == "inbound",
+			RxBytes:  peer.RxBytes,
+			TxBytes:  peer.TxBytes,
+		})
+	}
+
+	return peers, nil
+}
+
+func (m *mycelium) add(ctx context.Context, endpoint string) error {
+	return m.do(ctx, http.MethodPost, "peers", map[string]string{"endpoint": endpoint}, nil)
+}
+
+func (m *mycelium) remove(ctx context.Context, endpoint string) error {
+	return m.do(ctx, http.MethodDelete, "peers/"+url.PathEscape(endpoint), nil, nil)
+}
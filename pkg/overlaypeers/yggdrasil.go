@@ -0,0 +1,99 @@
+package overlaypeers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/zos/pkg"
+)
+
+// yggdrasilSocket is the admin socket of yggdrasil
+const yggdrasilSocket = "/var/run/yggdrasil.sock"
+
+// yggdrasil talks to the yggdrasil admin socket
+type yggdrasil struct {
+	socket string
+}
+
+func (y *yggdrasil) call(ctx context.Context, request string, args interface{}, response interface{}) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", y.socket)
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to yggdrasil admin socket")
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if err := json.NewEncoder(conn).Encode(map[string]interface{}{
+		"request":   request,
+		"arguments": args,
+	}); err != nil {
+		return errors.Wrapf(err, "failed to send yggdrasil '%s' request", request)
+	}
+
+	var result struct {
+		Status   string          `json:"status"`
+		Error    string          `json:"error"`
+		Response json.RawMessage `json:"response"`
+	}
+
+	if err := json.NewDecoder(conn).Decode(&result); err != nil {
+		return errors.Wrapf(err, "failed to read yggdrasil '%s' response", request)
+	}
+
+	if result.Status != "success" {
+		return fmt.Errorf("yggdrasil '%s' failed: %s", request, result.Error)
+	}
+
+	if response == nil {
+		return nil
+	}
+
+	return json.Unmarshal(result.Response, response)
+}
+
+func (y *yggdrasil) peers(ctx context.Context) ([]pkg.OverlayPeer, error) {
+	var response struct {
+		Peers []struct {
+			Remote  string        `json:"remote"`
+			Up      bool          `json:"up"`
+			Inbound bool          `json:"inbound"`
+			RxBytes uint64        `json:"bytes_recvd"`
+			TxBytes uint64        `json:"bytes_sent"`
+			Latency time.Duration `json:"latency"`
+		} `json:"peers"`
+	}
+
+	if err := y.call(ctx, "getpeers", struct{}{}, &response); err != nil {
+		return nil, err
+	}
+
+	peers := make([]pkg.OverlayPeer, 0, len(response.Peers))
+	for _, peer := range response.Peers {
+		peers = append(peers, pkg.OverlayPeer{
+			Endpoint: peer.Remote,
+			Up:       peer.Up,
+			Inbound:  peer.Inbound,
+			Latency:  peer.Latency,
+			RxBytes:  peer.RxBytes,
+			TxBytes:  peer.TxBytes,
+		})
+	}
+
+	return peers, nil
+}
+
+func (y *yggdrasil) add(ctx context.Context, endpoint string) error {
+	return y.call(ctx, "addpeer", map[string]string{"uri": endpoint}, nil)
+}
+
+func (y *yggdrasil) remove(ctx context.Context, endpoint string) error {
+	return y.call(ctx, "removepeer", map[string]string{"uri": endpoint}, nil)
+}
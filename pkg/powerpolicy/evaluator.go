@@ -0,0 +1,71 @@
+package powerpolicy
+
+import "time"
+
+// Action is what the evaluator asks the node to do
+type Action int
+
+const (
+	// None nothing to do
+	None Action = iota
+	// Shutdown powers down this node
+	Shutdown
+	// WakePeers wakes the other nodes of the farm
+	WakePeers
+)
+
+func (a Action) String() string {
+	switch a {
+	case Shutdown:
+		return "shutdown"
+	case WakePeers:
+		return "wake-peers"
+	}
+
+	return "none"
+}
+
+// Signals are the local idle signals of the node
+type Signals struct {
+	// Workloads is the number of active workloads
+	Workloads int
+	// CPU is the cpu usage percent
+	CPU float64
+}
+
+// Evaluator decides the power action of a node from the policy and its idle
+// signals. It must be called periodically since it tracks for how long the
+// node is idle and when sleep windows end.
+type Evaluator struct {
+	idleSince time.Time
+	sleeping  bool
+}
+
+// Evaluate returns the action of the node at now. keeper is set if the node
+// is one of the nodes kept awake.
+func (e *Evaluator) Evaluate(policy Policy, now time.Time, keeper bool, signals Signals) Action {
+	sleeping := policy.Enabled && policy.Sleeping(now)
+	ended := e.sleeping && !sleeping
+	e.sleeping = sleeping
+
+	idle := signals.Workloads == 0 && signals.CPU < policy.idleCPU()
+	if !idle {
+		e.idleSince = time.Time{}
+	} else if e.idleSince.IsZero() {
+		e.idleSince = now
+	}
+
+	if keeper {
+		if ended {
+			return WakePeers
+		}
+
+		return None
+	}
+
+	if sleeping && idle && now.Sub(e.idleSince) >= policy.idleFor() {
+		return Shutdown
+	}
+
+	return None
+}
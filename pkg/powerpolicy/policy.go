@@ -0,0 +1,209 @@
+package powerpolicy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/zos/pkg/zosconfig"
+)
+
+const (
+	defaultIdleCPU     = 10
+	defaultIdleMinutes = 30
+)
+
+var days = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Window is a daily time window in UTC. From and To are HH:MM, the window
+// spans midnight if To is before From. Days are the days the window starts
+// on (sun, mon, ...), all days if empty.
+type Window struct {
+	Days []string `json:"days"`
+	From string   `json:"from"`
+	To   string   `json:"to"`
+}
+
+func minutes(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time '%s', expecting HH:MM", value)
+	}
+
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Valid checks the window
+func (w *Window) Valid() error {
+	for _, day := range w.Days {
+		if _, ok := days[strings.ToLower(day)]; !ok {
+			return fmt.Errorf("invalid day '%s'", day)
+		}
+	}
+
+	from, err := minutes(w.From)
+	if err != nil {
+		return err
+	}
+
+	to, err := minutes(w.To)
+	if err != nil {
+		return err
+	}
+
+	if from == to {
+		return fmt.Errorf("empty window %s-%s", w.From, w.To)
+	}
+
+	return nil
+}
+
+func (w *Window) startsOn(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+
+	for _, d := range w.Days {
+		if days[strings.ToLower(d)] == day {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Contains checks if t is in the window, the window must be valid
+func (w *Window) Contains(t time.Time) bool {
+	t = t.UTC()
+	from, _ := minutes(w.From)
+	to, _ := minutes(w.To)
+	now := t.Hour()*60 + t.Minute()
+
+	if from < to {
+		return w.startsOn(t.Weekday()) && now >= from && now < to
+	}
+
+	// the window spans midnight
+	if now >= from {
+		return w.startsOn(t.Weekday())
+	}
+
+	return now < to && w.startsOn(t.AddDate(0, 0, -1).Weekday())
+}
+
+// Policy is the power policy of a farm
+type Policy struct {
+	Enabled bool `json:"enabled"`
+	// Sleep are the windows idle nodes are powered down in
+	Sleep []Window `json:"sleep"`
+	// KeepAwake is the number of nodes of the farm that are never powered
+	// down by the policy, they wake the other nodes when a window ends
+	KeepAwake int `json:"keep_awake"`
+	// IdleCPU is the cpu usage percent under which a node is idle
+	IdleCPU float64 `json:"idle_cpu"`
+	// IdleMinutes is how long a node must be idle to be powered down
+	IdleMinutes int `json:"idle_minutes"`
+}
+
+// Valid checks the policy
+func (p *Policy) Valid() error {
+	for i := range p.Sleep {
+		if err := p.Sleep[i].Valid(); err != nil {
+			return errors.Wrapf(err, "invalid sleep window %d", i)
+		}
+	}
+
+	if p.KeepAwake < 0 || p.IdleCPU < 0 || p.IdleCPU > 100 || p.IdleMinutes < 0 {
+		return fmt.Errorf("keep_awake, idle_cpu and idle_minutes must be positive, idle_cpu is a percent")
+	}
+
+	// without an awake node nothing can wake the farm again
+	powersDown := len(p.Sleep) != 0 || p.IdleCPU != 0 || p.IdleMinutes != 0
+	if powersDown && p.KeepAwake < 1 {
+		return fmt.Errorf("keep_awake must be at least 1 with sleep windows or idle shutdown")
+	}
+
+	return nil
+}
+
+// Sleeping checks if t is in any of the sleep windows
+func (p *Policy) Sleeping(t time.Time) bool {
+	for i := range p.Sleep {
+		if p.Sleep[i].Contains(t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *Policy) idleCPU() float64 {
+	if p.IdleCPU == 0 {
+		return defaultIdleCPU
+	}
+
+	return p.IdleCPU
+}
+
+func (p *Policy) idleFor() time.Duration {
+	if p.IdleMinutes == 0 {
+		return defaultIdleMinutes * time.Minute
+	}
+
+	return time.Duration(p.IdleMinutes) * time.Minute
+}
+
+// Keepers are the nodes that are kept awake, the n nodes with the lowest ids
+// so all nodes of the farm agree on them. nodes must be the farm nodes that
+// are up, a node that is down can't be kept awake.
+func Keepers(nodes []uint32, n int) map[uint32]struct{} {
+	sorted := append([]uint32{}, nodes...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	if n > len(sorted) {
+		n = len(sorted)
+	}
+
+	keepers := make(map[uint32]struct{})
+	for _, node := range sorted[:n] {
+		keepers[node] = struct{}{}
+	}
+
+	return keepers
+}
+
+// Load gets the power policy of the farm from the "power_policy" section of
+// the zos-config of the running mode. The policy is disabled if the farm has
+// none.
+//
+// zos-config is the global config of the grid maintained by the zos-config
+// repository owners, farmers can't edit it. A farmer gets a policy for their
+// farm by requesting it to be added to power_policy.farms in that repository.
+func Load(farm uint32) (Policy, error) {
+	var config struct {
+		Power struct {
+			Farms map[string]Policy `json:"farms"`
+		} `json:"power_policy"`
+	}
+
+	if err := zosconfig.GetConfig(&config); err != nil {
+		return Policy{}, err
+	}
+
+	policy := config.Power.Farms[fmt.Sprint(farm)]
+	if err := policy.Valid(); err != nil {
+		return Policy{}, errors.Wrap(err, "invalid power policy")
+	}
+
+	return policy, nil
+}
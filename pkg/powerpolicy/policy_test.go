@@ -0,0 +1,127 @@
+package powerpolicy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindow(t *testing.T) {
+	// saturday 23:00 to sunday 06:00
+	window := Window{Days: []string{"sat"}, From: "23:00", To: "06:00"}
+	if err := window.Valid(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		at       string
+		expected bool
+	}{
+		{"2026-10-17T23:30:00Z", true},  // saturday
+		{"2026-10-18T05:59:00Z", true},  // sunday morning
+		{"2026-10-18T06:00:00Z", false}, // sunday
+		{"2026-10-18T23:30:00Z", false}, // sunday night
+		{"2026-10-17T22:59:00Z", false},
+	} {
+		at, _ := time.Parse(time.RFC3339, c.at)
+		if window.Contains(at) != c.expected {
+			t.Errorf("expected contains(%s) to be %v", c.at, c.expected)
+		}
+	}
+
+	for _, invalid := range []Window{
+		{From: "25:00", To: "06:00"},
+		{From: "06:00", To: "06:00"},
+		{Days: []string{"someday"}, From: "01:00", To: "06:00"},
+	} {
+		if err := invalid.Valid(); err == nil {
+			t.Errorf("expected %+v to be invalid", invalid)
+		}
+	}
+}
+
+func TestKeepers(t *testing.T) {
+	keepers := Keepers([]uint32{30, 10, 20}, 2)
+	if len(keepers) != 2 {
+		t.Fatalf("expected 2 keepers, got %v", keepers)
+	}
+
+	for _, node := range []uint32{10, 20} {
+		if _, ok := keepers[node]; !ok {
+			t.Errorf("expected node %d to be kept awake", node)
+		}
+	}
+
+	if len(Keepers([]uint32{1}, 5)) != 1 {
+		t.Fatal("expected all nodes to be kept awake")
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	policy := Policy{
+		Enabled:     true,
+		Sleep:       []Window{{From: "22:00", To: "06:00"}},
+		IdleMinutes: 30,
+	}
+
+	start, _ := time.Parse(time.RFC3339, "2026-10-18T21:50:00Z")
+	idle := Signals{CPU: 2}
+
+	var node, keeper Evaluator
+	var down, woken string
+	for at := start; at.Before(start.Add(9 * time.Hour)); at = at.Add(10 * time.Minute) {
+		signals := idle
+		if at.Hour() == 22 && at.Minute() == 10 {
+			// busy for a moment
+			signals.CPU = 50
+		}
+
+		if len(down) == 0 {
+			if action := node.Evaluate(policy, at, false, signals); action == Shutdown {
+				down = at.Format("15:04")
+			} else if action != None {
+				t.Fatalf("unexpected %s at %s", action, at.Format("15:04"))
+			}
+		}
+
+		if action := keeper.Evaluate(policy, at, true, signals); action == WakePeers {
+			woken = at.Format("15:04")
+		} else if action != None {
+			t.Fatalf("unexpected keeper %s at %s", action, at.Format("15:04"))
+		}
+	}
+
+	if down != "22:50" || woken != "06:00" {
+		t.Fatalf("expected shutdown at 22:50 and wake at 06:00, got '%s' and '%s'", down, woken)
+	}
+
+	var busy Evaluator
+	at, _ := time.Parse(time.RFC3339, "2026-10-18T23:00:00Z")
+	for i := 0; i < 10; i++ {
+		if busy.Evaluate(policy, at, false, Signals{Workloads: 1}) != None {
+			t.Fatal("node with workloads must not shutdown")
+		}
+		at = at.Add(10 * time.Minute)
+	}
+}
+
+func TestPolicyKeepAwake(t *testing.T) {
+	window := Window{From: "01:00", To: "06:00"}
+	for _, invalid := range []Policy{
+		{Enabled: true, Sleep: []Window{window}},
+		{Enabled: true, IdleMinutes: 10},
+	} {
+		if err := invalid.Valid(); err == nil {
+			t.Errorf("expected %+v to be invalid without keep_awake", invalid)
+		}
+	}
+
+	policy := Policy{Enabled: true, Sleep: []Window{window}, KeepAwake: 1}
+	if err := policy.Valid(); err != nil {
+		t.Fatal(err)
+	}
+
+	// an empty policy doesn't power nodes down
+	if err := (&Policy{}).Valid(); err != nil {
+		t.Fatal(err)
+	}
+}
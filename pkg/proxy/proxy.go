@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/threefoldtech/zosbase/pkg/kernel"
+)
+
+const (
+	// kernel param with the http(s) proxy url, like http://proxy:3128
+	paramProxy = "zos.proxy"
+	// kernel param with a comma separated list of hosts or domains that are
+	// reached without the proxy
+	paramNoProxy = "zos.noproxy"
+)
+
+// noProxy are always reached without the proxy
+var noProxy = []string{"localhost", "127.0.0.1", "::1"}
+
+// Config is the proxy config
+type Config struct {
+	URL     *url.URL
+	NoProxy []string
+}
+
+// FromKernel loads the proxy config from kernel params, it returns nil if no
+// proxy is set
+func FromKernel(params kernel.Params) (*Config, error) {
+	value, ok := params.GetOne(paramProxy)
+	if !ok {
+		return nil, nil
+	}
+
+	u, err := url.Parse(value)
+	if err != nil || len(u.Host) == 0 {
+		return nil, fmt.Errorf("invalid %s '%s'", paramProxy, value)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported proxy scheme '%s'", u.Scheme)
+	}
+
+	cfg := Config{URL: u, NoProxy: append([]string{}, noProxy...)}
+	exclude, _ := params.GetOne(paramNoProxy)
+	for _, host := range strings.Split(exclude, ",") {
+		host = strings.TrimSpace(host)
+		if len(host) != 0 {
+			cfg.NoProxy = append(cfg.NoProxy, host)
+		}
+	}
+
+	return &cfg, nil
+}
+
+// Env returns the proxy environment variables
+func (c *Config) Env() map[string]string {
+	env := make(map[string]string)
+	for _, key := range []string{"HTTP_PROXY", "HTTPS_PROXY"} {
+		env[key] = c.URL.String()
+		env[strings.ToLower(key)] = c.URL.String()
+	}
+
+	env["NO_PROXY"] = strings.Join(c.NoProxy, ",")
+	env["no_proxy"] = env["NO_PROXY"]
+	return env
+}
+
+// Setup sets the proxy environment variables if a proxy is set in the kernel
+// params. The go http clients and the processes started by the daemon use
+// them, so it must be called before any http request is made.
+func Setup() error {
+	cfg, err := FromKernel(kernel.GetParams())
+	if err != nil || cfg == nil {
+		return err
+	}
+
+	for key, value := range cfg.Env() {
+		if err := os.Setenv(key, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
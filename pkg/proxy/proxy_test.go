@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/threefoldtech/zosbase/pkg/kernel"
+)
+
+func TestFromKernel(t *testing.T) {
+	cfg, err := FromKernel(kernel.Params{})
+	if err != nil || cfg != nil {
+		t.Fatalf("expected no proxy, got %+v (%v)", cfg, err)
+	}
+
+	cfg, err = FromKernel(kernel.Params{
+		paramProxy:   {"http://proxy.lan:3128"},
+		paramNoProxy: {"10.0.0.0/8, .lan"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := cfg.Env()
+	if env["HTTPS_PROXY"] != "http://proxy.lan:3128" || env["https_proxy"] != env["HTTPS_PROXY"] {
+		t.Fatalf("unexpected proxy env %v", env)
+	}
+
+	if env["NO_PROXY"] != "localhost,127.0.0.1,::1,10.0.0.0/8,.lan" {
+		t.Fatalf("unexpected no proxy '%s'", env["NO_PROXY"])
+	}
+
+	for _, value := range []string{"proxy.lan:3128", "socks5://proxy.lan:1080", "http://"} {
+		if _, err := FromKernel(kernel.Params{paramProxy: {value}}); err == nil {
+			t.Errorf("expected an error for '%s'", value)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package pkg
+
+import "time"
+
+//go:generate zbusc -module network -version 0.0.1 -name public-drift -package stubs github.com/threefoldtech/zos/pkg+PublicDriftMonitor stubs/public_drift_stub.go
+
+// PublicDriftStatus is the status of the public config drift monitor
+type PublicDriftStatus struct {
+	// Checked is the time of the last check
+	Checked time.Time `json:"checked"`
+	// Repairs is the number of repairs done since start per kind of drift
+	Repairs map[string]uint64 `json:"repairs"`
+	// Last are the repairs done by the last check
+	Last []string `json:"last"`
+	// Error of the last check if any
+	Error string `json:"error"`
+}
+
+// PublicDriftMonitor interface
+type PublicDriftMonitor interface {
+	// Status returns the drift monitor status
+	Status() PublicDriftStatus
+}
@@ -0,0 +1,141 @@
+package publicdrift
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/zbus"
+	"github.com/threefoldtech/zos/pkg"
+	"github.com/threefoldtech/zosbase/pkg/network/public"
+	"github.com/threefoldtech/zosbase/pkg/stubs"
+)
+
+const (
+	// zuiLabel is the label used to push repairs to zui
+	zuiLabel = "public-config"
+
+	// confirmDelay is the time to wait before confirming a detected drift. This
+	// avoids fighting with a public config that is being applied right now.
+	confirmDelay = 10 * time.Second
+)
+
+var _ pkg.PublicDriftMonitor = (*Monitor)(nil)
+
+// Monitor periodically compares the public namespace setup with the
+// stored public config and repairs any drift
+type Monitor struct {
+	cl       zbus.Client
+	interval time.Duration
+
+	m      sync.RWMutex
+	status pkg.PublicDriftStatus
+}
+
+// NewMonitor creates a new public config drift monitor
+func NewMonitor(cl zbus.Client, interval time.Duration) *Monitor {
+	return &Monitor{
+		cl:       cl,
+		interval: interval,
+		status: pkg.PublicDriftStatus{
+			Repairs: make(map[string]uint64),
+		},
+	}
+}
+
+// Status implements pkg.PublicDriftMonitor
+func (m *Monitor) Status() pkg.PublicDriftStatus {
+	m.m.RLock()
+	defer m.m.RUnlock()
+
+	status := m.status
+	status.Repairs = make(map[string]uint64, len(m.status.Repairs))
+	for kind, count := range m.status.Repairs {
+		status.Repairs[kind] = count
+	}
+
+	return status
+}
+
+// Run runs the monitor until context is cancelled
+func (m *Monitor) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(m.interval):
+		}
+
+		drifts, err := m.check(ctx)
+		m.update(drifts, err)
+
+		var messages []string
+		if err != nil {
+			log.Error().Err(err).Msg("failed to check public config drift")
+			messages = append(messages, err.Error())
+		}
+
+		for _, drift := range drifts {
+			log.Warn().Str("kind", drift.Kind).Msgf("repaired public config drift: %s", drift.Message)
+			messages = append(messages, "repaired "+drift.String())
+		}
+
+		// this also clears the errors if nothing was repaired
+		zui := stubs.NewZUIStub(m.cl)
+		if err := zui.PushErrors(ctx, zuiLabel, messages); err != nil {
+			log.Error().Err(err).Msg("failed to push public config repairs to zui")
+		}
+	}
+}
+
+func (m *Monitor) check(ctx context.Context) ([]Drift, error) {
+	if !public.HasPublicSetup() {
+		return nil, nil
+	}
+
+	cfg, err := public.LoadPublicConfig()
+	if err == public.ErrNoPublicConfig {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	drifts, err := reconcile(*cfg, false)
+	if err != nil || len(drifts) == 0 {
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, nil
+	case <-time.After(confirmDelay):
+	}
+
+	// the config is loaded again in case it was changed meanwhile
+	cfg, err = public.LoadPublicConfig()
+	if err == public.ErrNoPublicConfig {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return reconcile(*cfg, true)
+}
+
+func (m *Monitor) update(drifts []Drift, err error) {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	m.status.Checked = time.Now()
+	m.status.Error = ""
+	if err != nil {
+		m.status.Error = err.Error()
+	}
+
+	m.status.Last = nil
+	for _, drift := range drifts {
+		m.status.Repairs[drift.Kind]++
+		m.status.Last = append(m.status.Last, drift.String())
+	}
+}
@@ -0,0 +1,208 @@
+package publicdrift
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/zosbase/pkg"
+	"github.com/threefoldtech/zosbase/pkg/network/namespace"
+	"github.com/threefoldtech/zosbase/pkg/network/public"
+	"github.com/vishvananda/netlink"
+)
+
+// publicIface is the name of the public interface inside the public namespace
+const publicIface = "public"
+
+// drift kinds
+const (
+	KindLink    = "link"
+	KindAddress = "address"
+	KindRoute   = "route"
+)
+
+// Drift is a difference between the live public namespace setup
+// and the stored public config
+type Drift struct {
+	Kind    string
+	Message string
+}
+
+func (d Drift) String() string {
+	return fmt.Sprintf("%s: %s", d.Kind, d.Message)
+}
+
+// reconcile compares the public namespace setup with cfg and returns the
+// differences. If fix is true the differences are also repaired.
+func reconcile(cfg pkg.PublicConfig, fix bool) ([]Drift, error) {
+	netNS, err := namespace.GetByName(public.PublicNamespace)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get public namespace")
+	}
+	defer netNS.Close()
+
+	var drifts []Drift
+	err = netNS.Do(func(_ ns.NetNS) error {
+		link, err := netlink.LinkByName(publicIface)
+		if err != nil {
+			return errors.Wrap(err, "failed to get public interface")
+		}
+
+		r := reconciler{link: link, fix: fix}
+		if err := r.up(); err != nil {
+			return err
+		}
+
+		if err := r.address(netlink.FAMILY_V4, cfg.IPv4.IPNet, true); err != nil {
+			return err
+		}
+		// ipv6 can also be configured with slaac so we never
+		// remove extra addresses
+		if err := r.address(netlink.FAMILY_V6, cfg.IPv6.IPNet, false); err != nil {
+			return err
+		}
+
+		if err := r.route(netlink.FAMILY_V4, cfg.GW4); err != nil {
+			return err
+		}
+		if err := r.route(netlink.FAMILY_V6, cfg.GW6); err != nil {
+			return err
+		}
+
+		drifts = r.drifts
+		return nil
+	})
+
+	return drifts, err
+}
+
+type reconciler struct {
+	link   netlink.Link
+	fix    bool
+	drifts []Drift
+}
+
+func (r *reconciler) drift(kind, msg string, args ...interface{}) {
+	r.drifts = append(r.drifts, Drift{Kind: kind, Message: fmt.Sprintf(msg, args...)})
+}
+
+func (r *reconciler) up() error {
+	if r.link.Attrs().Flags&net.FlagUp != 0 {
+		return nil
+	}
+
+	r.drift(KindLink, "public interface is down")
+	if !r.fix {
+		return nil
+	}
+
+	return errors.Wrap(netlink.LinkSetUp(r.link), "failed to set public interface up")
+}
+
+// address makes sure expected address is set on the public interface. If exclusive
+// other global addresses of the same family are removed
+func (r *reconciler) address(family int, expected net.IPNet, exclusive bool) error {
+	if expected.IP == nil {
+		return nil
+	}
+
+	addrs, err := netlink.AddrList(r.link, family)
+	if err != nil {
+		return errors.Wrap(err, "failed to list public interface addresses")
+	}
+
+	unexpected, missing := classifyAddresses(addrs, expected, exclusive)
+	for _, addr := range unexpected {
+		r.drift(KindAddress, "unexpected address '%s'", addr.IPNet)
+		if r.fix {
+			if err := netlink.AddrDel(r.link, &addr); err != nil {
+				return errors.Wrapf(err, "failed to remove address '%s'", addr.IPNet)
+			}
+		}
+	}
+
+	if !missing {
+		return nil
+	}
+
+	r.drift(KindAddress, "missing address '%s'", expected.String())
+	if !r.fix {
+		return nil
+	}
+
+	return errors.Wrapf(
+		netlink.AddrAdd(r.link, &netlink.Addr{IPNet: &expected}),
+		"failed to add address '%s'", expected.String(),
+	)
+}
+
+// route makes sure the default route of family goes through gw
+func (r *reconciler) route(family int, gw net.IP) error {
+	if gw == nil {
+		return nil
+	}
+
+	routes, err := netlink.RouteList(r.link, family)
+	if err != nil {
+		return errors.Wrap(err, "failed to list public interface routes")
+	}
+
+	current := defaultGateway(routes)
+	if current.Equal(gw) {
+		return nil
+	}
+
+	if current == nil {
+		r.drift(KindRoute, "missing default route via '%s'", gw)
+	} else {
+		r.drift(KindRoute, "default route via '%s' instead of '%s'", current, gw)
+	}
+
+	if !r.fix {
+		return nil
+	}
+
+	return errors.Wrapf(
+		netlink.RouteReplace(&netlink.Route{LinkIndex: r.link.Attrs().Index, Gw: gw}),
+		"failed to set default route via '%s'", gw,
+	)
+}
+
+// classifyAddresses returns the global addresses other than expected if
+// exclusive, and whether expected is missing from addrs
+func classifyAddresses(addrs []netlink.Addr, expected net.IPNet, exclusive bool) (unexpected []netlink.Addr, missing bool) {
+	missing = true
+	for _, addr := range addrs {
+		if addr.IP.Equal(expected.IP) && addr.Mask.String() == expected.Mask.String() {
+			missing = false
+			continue
+		}
+
+		if exclusive && addr.IP.IsGlobalUnicast() {
+			unexpected = append(unexpected, addr)
+		}
+	}
+
+	return unexpected, missing
+}
+
+// defaultGateway returns the gateway of the default route, nil if there is none
+func defaultGateway(routes []netlink.Route) net.IP {
+	for _, route := range routes {
+		if isDefault(route) {
+			return route.Gw
+		}
+	}
+
+	return nil
+}
+
+func isDefault(route netlink.Route) bool {
+	if route.Dst == nil {
+		return true
+	}
+
+	ones, _ := route.Dst.Mask.Size()
+	return ones == 0
+}
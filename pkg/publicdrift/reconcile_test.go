@@ -0,0 +1,126 @@
+package publicdrift
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func addr(t *testing.T, value string) netlink.Addr {
+	ip, ipNet, err := net.ParseCIDR(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ipNet.IP = ip
+
+	return netlink.Addr{IPNet: ipNet}
+}
+
+func TestClassifyAddresses(t *testing.T) {
+	expected := *addr(t, "185.1.1.10/24").IPNet
+
+	cases := []struct {
+		name       string
+		addrs      []string
+		exclusive  bool
+		unexpected []string
+		missing    bool
+	}{
+		{
+			name:    "empty",
+			missing: true,
+		},
+		{
+			name:  "matching",
+			addrs: []string{"185.1.1.10/24"},
+		},
+		{
+			name:    "wrong mask",
+			addrs:   []string{"185.1.1.10/16"},
+			missing: true,
+		},
+		{
+			name:       "extra exclusive",
+			addrs:      []string{"185.1.1.10/24", "185.1.1.11/24"},
+			exclusive:  true,
+			unexpected: []string{"185.1.1.11/24"},
+		},
+		{
+			name:  "extra not exclusive",
+			addrs: []string{"185.1.1.10/24", "185.1.1.11/24"},
+		},
+		{
+			name:      "link local ignored",
+			addrs:     []string{"169.254.1.1/16", "185.1.1.10/24"},
+			exclusive: true,
+		},
+		{
+			name:       "replaced",
+			addrs:      []string{"185.1.1.12/24"},
+			exclusive:  true,
+			unexpected: []string{"185.1.1.12/24"},
+			missing:    true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var addrs []netlink.Addr
+			for _, value := range c.addrs {
+				addrs = append(addrs, addr(t, value))
+			}
+
+			unexpected, missing := classifyAddresses(addrs, expected, c.exclusive)
+			var got []string
+			for _, a := range unexpected {
+				got = append(got, a.IPNet.String())
+			}
+
+			if !reflect.DeepEqual(got, c.unexpected) || missing != c.missing {
+				t.Fatalf("expected %v missing=%v got %v missing=%v", c.unexpected, c.missing, got, missing)
+			}
+		})
+	}
+}
+
+func TestDefaultGateway(t *testing.T) {
+	_, local, _ := net.ParseCIDR("185.1.1.0/24")
+	_, all, _ := net.ParseCIDR("0.0.0.0/0")
+	gw := net.ParseIP("185.1.1.1")
+
+	cases := []struct {
+		name     string
+		routes   []netlink.Route
+		expected net.IP
+	}{
+		{name: "none", routes: []netlink.Route{{Dst: local}}},
+		{name: "no dst", routes: []netlink.Route{{Dst: local}, {Gw: gw}}, expected: gw},
+		{name: "zero mask", routes: []netlink.Route{{Dst: all, Gw: gw}}, expected: gw},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := defaultGateway(c.routes); !got.Equal(c.expected) {
+				t.Fatalf("expected %s got %s", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	m := NewMonitor(nil, 0)
+	m.update([]Drift{{Kind: KindAddress, Message: "missing address"}, {Kind: KindRoute, Message: "missing route"}}, nil)
+	m.update([]Drift{{Kind: KindAddress, Message: "missing address"}}, fmt.Errorf("failed"))
+
+	status := m.Status()
+	if status.Repairs[KindAddress] != 2 || status.Repairs[KindRoute] != 1 {
+		t.Fatalf("unexpected repairs %v", status.Repairs)
+	}
+
+	if !reflect.DeepEqual(status.Last, []string{"address: missing address"}) || status.Error != "failed" {
+		t.Fatalf("unexpected status %+v", status)
+	}
+}
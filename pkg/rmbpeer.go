@@ -0,0 +1,29 @@
+package pkg
+
+import "time"
+
+//go:generate zbusc -module api-gateway -version 0.0.1 -name rmb-peer -package stubs github.com/threefoldtech/zos/pkg+RMBPeer stubs/rmb_peer_stub.go
+
+// RMBPeerStatus is the status of the node rmb peer
+type RMBPeerStatus struct {
+	Relays    []string  `json:"relays"`
+	Substrate []string  `json:"substrate"`
+	Started   time.Time `json:"started"`
+	Reloads   uint64    `json:"reloads"`
+	// Reloading is set while a new peer is connecting
+	Reloading bool `json:"reloading"`
+	// Draining is the number of replaced peers that are still
+	// sending responses to requests they received
+	Draining  int    `json:"draining"`
+	LastError string `json:"last_error"`
+}
+
+// RMBPeer interface
+type RMBPeer interface {
+	// Reload reloads the relay and substrate urls from zos-config and
+	// replaces the peer if they changed, or if force is set. The old peer
+	// is closed once it has answered all its pending requests. It returns
+	// right away, the new peer is connected in the background.
+	Reload(force bool) error
+	Status() RMBPeerStatus
+}
@@ -0,0 +1,29 @@
+package rmbpolicy
+
+import (
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/zos/pkg/zosconfig"
+)
+
+// Load gets the rmb policy from the zos-config of the running mode. The
+// policy is in the "rmb_policy" section, if it's missing DefaultPolicy
+// is returned.
+func Load() (Policy, error) {
+	var config struct {
+		Policy *Policy `json:"rmb_policy"`
+	}
+
+	if err := zosconfig.GetConfig(&config); err != nil {
+		return Policy{}, err
+	}
+
+	if config.Policy == nil {
+		return DefaultPolicy(), nil
+	}
+
+	if err := config.Policy.Valid(); err != nil {
+		return Policy{}, errors.Wrap(err, "invalid rmb policy")
+	}
+
+	return *config.Policy, nil
+}
@@ -0,0 +1,194 @@
+package rmbpolicy
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/tfgrid-sdk-go/rmb-sdk-go/peer"
+)
+
+var (
+	// ErrDenied is returned if the caller is not allowed to call the command
+	ErrDenied = fmt.Errorf("permission denied")
+	// ErrRateLimited is returned if the caller made too many calls
+	ErrRateLimited = fmt.Errorf("rate limit exceeded")
+)
+
+// Engine authorizes rmb requests against the policy
+type Engine struct {
+	resolve func() (Callers, error)
+
+	m       sync.RWMutex
+	policy  Policy
+	callers *Callers
+	limiter *limiter
+
+	// denied logs are sampled so a misbehaving twin can't flood the logs
+	denied zerolog.Logger
+}
+
+// NewEngine creates a new policy engine. resolve must return the twins
+// of the node roles, it's called in the background by Watch so requests
+// never wait for the chain.
+func NewEngine(policy Policy, resolve func() (Callers, error)) *Engine {
+	return &Engine{
+		resolve: resolve,
+		policy:  policy,
+		limiter: newLimiter(time.Minute),
+		denied:  log.Sample(&zerolog.BurstSampler{Burst: 20, Period: time.Minute}),
+	}
+}
+
+// Update sets the engine policy
+func (e *Engine) Update(policy Policy) {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.policy = policy
+}
+
+// roles returns the last resolved twins of the node roles, or nil if they
+// are not resolved yet
+func (e *Engine) roles() *Callers {
+	e.m.RLock()
+	defer e.m.RUnlock()
+
+	return e.callers
+}
+
+// resolveRoles resolves the twins of the node roles again, the known twins
+// are kept if they can't be resolved. It returns false if they can't be
+// resolved.
+func (e *Engine) resolveRoles() bool {
+	resolved, err := e.resolve()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to resolve twins of the node roles")
+		return false
+	}
+
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.callers = &resolved
+	return true
+}
+
+// Authorize checks if twin can call command
+func (e *Engine) Authorize(twin uint32, command string) error {
+	e.m.RLock()
+	policy := e.policy
+	e.m.RUnlock()
+
+	index, rule := policy.match(command)
+	if rule != nil && (len(rule.Deny) > 0 || len(rule.Allow) > 0) {
+		callers := e.roles()
+		if callers.match(rule.Deny, twin) {
+			return ErrDenied
+		}
+
+		if len(rule.Allow) > 0 && !callers.match(rule.Allow, twin) {
+			return ErrDenied
+		}
+	}
+
+	if policy.RateLimit > 0 && !e.limiter.allow(fmt.Sprint(twin), policy.RateLimit) {
+		return ErrRateLimited
+	}
+
+	if rule != nil && rule.RateLimit > 0 && !e.limiter.allow(fmt.Sprintf("%d:%d", twin, index), rule.RateLimit) {
+		return ErrRateLimited
+	}
+
+	return nil
+}
+
+// Watch loads the policy from zos-config and resolves the twins of the node
+// roles every 10 minutes until context is cancelled, so a new farm owner or
+// renter is picked up. The current policy is kept if it can't be loaded.
+// Roles that can't be resolved are retried every 30 seconds, the commands
+// restricted to roles are denied until they are resolved.
+func (e *Engine) Watch(ctx context.Context) {
+	go e.watchRoles(ctx)
+
+	for {
+		policy, err := Load()
+		if err != nil {
+			log.Error().Err(err).Msg("failed to load rmb policy")
+		} else {
+			e.Update(policy)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(10 * time.Minute):
+		}
+	}
+}
+
+// watchRoles resolves the twins of the node roles until context is cancelled
+func (e *Engine) watchRoles(ctx context.Context) {
+	for {
+		delay := 10 * time.Minute
+		if !e.resolveRoles() {
+			delay = 30 * time.Second
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Middleware is an rmb router middleware that rejects requests that are
+// not allowed by the policy
+func (e *Engine) Middleware(ctx context.Context, _ []byte) (context.Context, error) {
+	twin := peer.GetTwinID(ctx)
+	command := peer.GetEnvelope(ctx).GetRequest().GetCommand()
+
+	if err := e.Authorize(twin, command); err != nil {
+		e.denied.Warn().Err(err).Uint32("twin", twin).Str("command", command).Msg("rmb request denied")
+		return ctx, err
+	}
+
+	return ctx, nil
+}
+
+// limiter counts calls per key in fixed windows
+type limiter struct {
+	window time.Duration
+
+	m      sync.Mutex
+	start  time.Time
+	counts map[string]uint
+}
+
+func newLimiter(window time.Duration) *limiter {
+	return &limiter{window: window, counts: make(map[string]uint)}
+}
+
+// allow counts a call for key, and checks if it's within limit
+func (l *limiter) allow(key string, limit uint) bool {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.start) >= l.window {
+		// new window, this also drops keys that are not used anymore
+		l.start = now
+		l.counts = make(map[string]uint)
+	}
+
+	if l.counts[key] >= limit {
+		return false
+	}
+
+	l.counts[key]++
+	return true
+}
@@ -0,0 +1,162 @@
+package rmbpolicy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// CallerAny matches any twin
+	CallerAny = "*"
+	// CallerFarmer matches the twin of the farm owner
+	CallerFarmer = "farmer"
+	// CallerOwner matches the twin that rents the node, or the farm owner
+	// if the node is not rented
+	CallerOwner = "owner"
+	// CallerNode matches the twin of the node itself, not its owner
+	CallerNode = "node"
+)
+
+// Rule decides who can call a set of commands
+type Rule struct {
+	// Commands are the commands the rule applies to. A command ending
+	// with ".*" matches all commands under that prefix, and "*" matches
+	// all commands.
+	Commands []string `json:"commands"`
+	// Allow are the callers allowed to call the commands. A caller is a
+	// twin id, CallerAny, CallerFarmer, CallerOwner or CallerNode. If
+	// empty all callers are allowed.
+	Allow []string `json:"allow"`
+	// Deny are the callers that are denied, it's checked before Allow
+	Deny []string `json:"deny"`
+	// RateLimit is the max number of calls per minute a twin can make
+	// to the commands, 0 means no limit
+	RateLimit uint `json:"rate_limit"`
+}
+
+// Policy is the rmb authorization policy of the node
+type Policy struct {
+	// Rules are checked in order, the first rule that matches the
+	// command decides. Commands that match no rule are allowed.
+	Rules []Rule `json:"rules"`
+	// RateLimit is the max number of calls per minute a twin can make
+	// to all commands, 0 means no limit
+	RateLimit uint `json:"rate_limit"`
+}
+
+// DefaultPolicy is used if zos-config has no rmb policy. Admin commands
+// are only allowed for the farmer.
+func DefaultPolicy() Policy {
+	return Policy{
+		Rules: []Rule{
+			{Commands: []string{"zos.admin.*"}, Allow: []string{CallerFarmer}},
+		},
+	}
+}
+
+// Valid checks the policy
+func (p *Policy) Valid() error {
+	for i, rule := range p.Rules {
+		if len(rule.Commands) == 0 {
+			return fmt.Errorf("rule %d has no commands", i)
+		}
+
+		for _, command := range rule.Commands {
+			if strings.TrimSpace(command) == "" {
+				return fmt.Errorf("rule %d has an empty command", i)
+			}
+		}
+
+		for _, caller := range append(rule.Allow, rule.Deny...) {
+			if err := validCaller(caller); err != nil {
+				return fmt.Errorf("rule %d: %w", i, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func validCaller(caller string) error {
+	switch caller {
+	case CallerAny, CallerFarmer, CallerOwner, CallerNode:
+		return nil
+	}
+
+	if _, err := strconv.ParseUint(caller, 10, 32); err != nil {
+		return fmt.Errorf("invalid caller '%s'", caller)
+	}
+
+	return nil
+}
+
+// match returns the first rule that matches command
+func (p *Policy) match(command string) (int, *Rule) {
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		for _, pattern := range rule.Commands {
+			if matchCommand(pattern, command) {
+				return i, rule
+			}
+		}
+	}
+
+	return -1, nil
+}
+
+func matchCommand(pattern, command string) bool {
+	if pattern == "*" {
+		return true
+	}
+
+	if prefix, ok := strings.CutSuffix(pattern, ".*"); ok {
+		return strings.HasPrefix(command, prefix+".")
+	}
+
+	return pattern == command
+}
+
+// Callers are the twins of the node roles
+type Callers struct {
+	Node   uint32
+	Farmer uint32
+	// Renter is the twin of the rent contract, zero if the node is not rented
+	Renter uint32
+}
+
+// owner returns the twin of the node owner
+func (c *Callers) owner() uint32 {
+	if c.Renter != 0 {
+		return c.Renter
+	}
+
+	return c.Farmer
+}
+
+func (c *Callers) match(callers []string, twin uint32) bool {
+	for _, caller := range callers {
+		switch caller {
+		case CallerAny:
+			return true
+		case CallerFarmer:
+			if c != nil && c.Farmer == twin {
+				return true
+			}
+		case CallerOwner:
+			if c != nil && c.owner() == twin {
+				return true
+			}
+		case CallerNode:
+			if c != nil && c.Node == twin {
+				return true
+			}
+		default:
+			if id, err := strconv.ParseUint(caller, 10, 32); err == nil && uint32(id) == twin {
+				return true
+			}
+		}
+	}
+
+	return false
+}
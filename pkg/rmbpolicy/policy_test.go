@@ -0,0 +1,123 @@
+package rmbpolicy
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAuthorize(t *testing.T) {
+	policy := Policy{
+		Rules: []Rule{
+			{Commands: []string{"zos.admin.*"}, Allow: []string{CallerFarmer, CallerNode}},
+			{Commands: []string{"zos.deployment.deploy"}, Deny: []string{"13"}},
+			{Commands: []string{"zos.system.*"}, Allow: []string{"14"}},
+		},
+	}
+
+	if err := policy.Valid(); err != nil {
+		t.Fatal(err)
+	}
+
+	engine := NewEngine(policy, func() (Callers, error) {
+		return Callers{Node: 10, Farmer: 11}, nil
+	})
+
+	if !engine.resolveRoles() {
+		t.Fatal("failed to resolve roles")
+	}
+
+	cases := []struct {
+		twin    uint32
+		command string
+		err     error
+	}{
+		{11, "zos.admin.interfaces", nil},
+		{10, "zos.admin.interfaces", nil},
+		{12, "zos.admin.interfaces", ErrDenied},
+		{12, "zos.adminx", nil},
+		{13, "zos.deployment.deploy", ErrDenied},
+		{12, "zos.deployment.deploy", nil},
+		{14, "zos.system.version", nil},
+		{11, "zos.system.version", ErrDenied},
+		{13, "zos.statistics.get", nil},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("%d-%s", c.twin, c.command), func(t *testing.T) {
+			if err := engine.Authorize(c.twin, c.command); err != c.err {
+				t.Fatalf("expected '%v' got '%v'", c.err, err)
+			}
+		})
+	}
+}
+
+func TestAuthorizeUnresolved(t *testing.T) {
+	engine := NewEngine(DefaultPolicy(), func() (Callers, error) {
+		return Callers{}, fmt.Errorf("chain is not reachable")
+	})
+
+	// farmer only commands are denied if the farmer is not known
+	if engine.resolveRoles() {
+		t.Fatal("expected roles to be unresolved")
+	}
+
+	if err := engine.Authorize(0, "zos.admin.interfaces"); err != ErrDenied {
+		t.Fatalf("expected denied, got '%v'", err)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	engine := NewEngine(Policy{
+		RateLimit: 2,
+		Rules: []Rule{
+			{Commands: []string{"zos.deployment.*"}, RateLimit: 1},
+		},
+	}, func() (Callers, error) { return Callers{}, nil })
+
+	if err := engine.Authorize(1, "zos.deployment.deploy"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := engine.Authorize(1, "zos.deployment.update"); err != ErrRateLimited {
+		t.Fatalf("expected rule rate limit, got '%v'", err)
+	}
+
+	if err := engine.Authorize(1, "zos.system.version"); err != ErrRateLimited {
+		t.Fatalf("expected twin rate limit, got '%v'", err)
+	}
+
+	if err := engine.Authorize(2, "zos.deployment.deploy"); err != nil {
+		t.Fatalf("rate limit is per twin: %v", err)
+	}
+}
+
+func TestPolicyValid(t *testing.T) {
+	policy := Policy{Rules: []Rule{{Commands: []string{"zos.admin.*"}, Allow: []string{"admin"}}}}
+	if err := policy.Valid(); err == nil {
+		t.Fatal("expected invalid caller error")
+	}
+
+	policy = Policy{Rules: []Rule{{Allow: []string{CallerAny}}}}
+	if err := policy.Valid(); err == nil {
+		t.Fatal("expected missing commands error")
+	}
+}
+
+func TestCallersOwner(t *testing.T) {
+	cases := []struct {
+		callers Callers
+		twin    uint32
+		owner   bool
+	}{
+		{Callers{Node: 10, Farmer: 11}, 11, true},
+		{Callers{Node: 10, Farmer: 11}, 10, false},
+		{Callers{Node: 10, Farmer: 11, Renter: 12}, 12, true},
+		{Callers{Node: 10, Farmer: 11, Renter: 12}, 11, false},
+	}
+
+	for _, c := range cases {
+		if owner := c.callers.match([]string{CallerOwner}, c.twin); owner != c.owner {
+			t.Errorf("%+v: expected twin %d owner %t", c.callers, c.twin, c.owner)
+		}
+	}
+}
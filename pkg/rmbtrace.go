@@ -0,0 +1,43 @@
+package pkg
+
+import "time"
+
+//go:generate zbusc -module api-gateway -version 0.0.1 -name rmb-tracer -package stubs github.com/threefoldtech/zos/pkg+RMBTracer stubs/rmb_tracer_stub.go
+
+// RMBCall is a single rmb request served by the node
+type RMBCall struct {
+	Command  string        `json:"command"`
+	Twin     uint32        `json:"twin"`
+	Received time.Time     `json:"received"`
+	Duration time.Duration `json:"duration"`
+	// Result is the outcome of the call, see rmbtrace for possible values
+	Result string `json:"result"`
+	Error  string `json:"error"`
+}
+
+// RMBCommandStats are the stats of a single rmb command since the api-gateway
+// was started
+type RMBCommandStats struct {
+	// Command is the rmb command, the calls of all commands the node doesn't
+	// serve are counted in a single unknown entry
+	Command string `json:"command"`
+	// Results is the number of calls per result
+	Results map[string]uint64 `json:"results"`
+	// Buckets are the upper bounds in seconds of the latency histogram,
+	// Counts[i] is the number of calls that took at most Buckets[i] and
+	// more than Buckets[i-1]
+	Buckets []float64 `json:"buckets"`
+	Counts  []uint64  `json:"counts"`
+	// Sum is the total duration of all calls in seconds. Dispatched calls
+	// have no known duration, they are only counted in Results.
+	Sum   float64 `json:"sum"`
+	Total uint64  `json:"total"`
+}
+
+// RMBTracer interface
+type RMBTracer interface {
+	// Recent returns the last served rmb calls, most recent first
+	Recent() []RMBCall
+	// Stats returns the stats of all commands served by the node
+	Stats() []RMBCommandStats
+}
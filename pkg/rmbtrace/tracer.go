@@ -0,0 +1,319 @@
+package rmbtrace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/threefoldtech/tfgrid-sdk-go/rmb-sdk-go/peer"
+	"github.com/threefoldtech/tfgrid-sdk-go/rmb-sdk-go/peer/types"
+	zos "github.com/threefoldtech/zos/pkg"
+	"github.com/threefoldtech/zos/pkg/rmbpolicy"
+)
+
+const (
+	// ResultOK is a call that returned a response
+	ResultOK = "ok"
+	// ResultEmpty is a call that returned no response and no error
+	ResultEmpty = "empty"
+	// ResultFailed is a call whose handler returned an error
+	ResultFailed = "failed"
+	// ResultDenied is a call rejected by the rmb policy
+	ResultDenied = "denied"
+	// ResultRateLimited is a call rejected by the rmb policy rate limits
+	ResultRateLimited = "rate_limited"
+	// ResultError is a call rejected by a middleware for any other reason
+	ResultError = "error"
+	// ResultDispatched is a call handed to a handler that is not traced, its
+	// result is not known
+	ResultDispatched = "dispatched"
+	// ResultUnknown is a call to a command that is not registered
+	ResultUnknown = "unknown"
+	// ResultDropped is a call whose handler didn't return within dropAfter
+	ResultDropped = "dropped"
+)
+
+// unknownCommand is the stats entry of all commands that are not registered,
+// so callers can't grow the stats with made up commands
+const unknownCommand = "unknown"
+
+// dropAfter is how long a call can be in flight before it's counted as dropped
+const dropAfter = 10 * time.Minute
+
+var (
+	_ zos.RMBTracer = (*Tracer)(nil)
+
+	// buckets are the latency histogram upper bounds in seconds
+	buckets = []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30}
+)
+
+type call struct {
+	zos.RMBCall
+}
+
+// callKey is where the call is stored in the request context
+type callKey struct{}
+
+// Tracer records the rmb calls served by the node. It keeps the last calls
+// in a ring buffer, and per command counters and latency histograms.
+//
+// The router doesn't expose when a call is done or what its handler returned.
+// So calls are started by a wrapper around the peer handler, which carries the
+// call in the request context, and finished by a wrapper around each route
+// handler, or by the tracer middleware if the call is rejected or its handler
+// is not traced.
+type Tracer struct {
+	mw []peer.Middleware
+
+	m sync.Mutex
+	// routes are the registered commands, set if their handler is traced
+	routes   map[string]bool
+	inflight map[*call]struct{}
+	ring     []zos.RMBCall
+	next     int
+	stats    map[string]*zos.RMBCommandStats
+}
+
+// New creates a new tracer that keeps the last size calls
+func New(size int) *Tracer {
+	return &Tracer{
+		routes:   make(map[string]bool),
+		inflight: make(map[*call]struct{}),
+		ring:     make([]zos.RMBCall, 0, size),
+		stats:    make(map[string]*zos.RMBCommandStats),
+	}
+}
+
+// Use adds a middleware that runs inside the trace, so calls it rejects
+// are recorded with the reason
+func (t *Tracer) Use(mw peer.Middleware) {
+	t.mw = append(t.mw, mw)
+}
+
+// Trace wraps the peer handler so a trace is started for each request
+func (t *Tracer) Trace(inner peer.Handler) peer.Handler {
+	return func(ctx context.Context, p *peer.Peer, env *types.Envelope, err error) {
+		if err == nil && env.GetRequest() != nil {
+			ctx = context.WithValue(ctx, callKey{}, t.start(env))
+		}
+
+		inner(ctx, p, env, err)
+	}
+}
+
+func (t *Tracer) start(env *types.Envelope) *call {
+	c := &call{
+		RMBCall: zos.RMBCall{
+			Command:  env.GetRequest().GetCommand(),
+			Received: time.Now(),
+		},
+	}
+	if env.Source != nil {
+		c.Twin = env.Source.Twin
+	}
+
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	t.inflight[c] = struct{}{}
+	return c
+}
+
+// Middleware runs the middlewares added with Use, and records the calls they
+// reject. Calls to commands that are not registered or whose handler is not
+// traced are finished here too. It must be the only middleware of the root
+// router.
+func (t *Tracer) Middleware(ctx context.Context, payload []byte) (context.Context, error) {
+	c, _ := ctx.Value(callKey{}).(*call)
+
+	for _, mw := range t.mw {
+		var err error
+		ctx, err = mw(ctx, payload)
+		if err != nil {
+			t.finish(c, rejected(err), err)
+			return ctx, err
+		}
+	}
+
+	if c == nil {
+		return ctx, nil
+	}
+
+	t.m.Lock()
+	traced, ok := t.routes[c.Command]
+	t.m.Unlock()
+
+	switch {
+	case !ok:
+		t.finish(c, ResultUnknown, nil)
+	case !traced:
+		t.finish(c, ResultDispatched, nil)
+	}
+
+	return ctx, nil
+}
+
+func rejected(err error) string {
+	switch {
+	case errors.Is(err, rmbpolicy.ErrDenied):
+		return ResultDenied
+	case errors.Is(err, rmbpolicy.ErrRateLimited):
+		return ResultRateLimited
+	default:
+		return ResultError
+	}
+}
+
+// Handler registers command and wraps its handler so the result of each call
+// is recorded
+func (t *Tracer) Handler(command string, handler peer.HandlerFunc) peer.HandlerFunc {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	t.routes[command] = true
+	return t.wrap(handler)
+}
+
+// Route registers commands whose handlers can't be wrapped, like the ones
+// of the zos api. Their calls are recorded as dispatched once they pass the
+// middlewares.
+func (t *Tracer) Route(commands ...string) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	for _, command := range commands {
+		if _, ok := t.routes[command]; !ok {
+			t.routes[command] = false
+		}
+	}
+}
+
+// wrap finishes the call of the request with the result of handler
+func (t *Tracer) wrap(handler peer.HandlerFunc) peer.HandlerFunc {
+	return func(ctx context.Context, payload []byte) (response interface{}, err error) {
+		c, _ := ctx.Value(callKey{}).(*call)
+		defer func() {
+			if rec := recover(); rec != nil {
+				t.finish(c, ResultFailed, fmt.Errorf("handler panicked with: %v", rec))
+				panic(rec)
+			}
+
+			switch {
+			case err != nil:
+				t.finish(c, ResultFailed, err)
+			case response != nil:
+				t.finish(c, ResultOK, nil)
+			default:
+				t.finish(c, ResultEmpty, nil)
+			}
+		}()
+
+		return handler(ctx, payload)
+	}
+}
+
+// finish ends call c with result
+func (t *Tracer) finish(c *call, result string, err error) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	if _, ok := t.inflight[c]; ok {
+		delete(t.inflight, c)
+
+		c.Result = result
+		if err != nil {
+			c.Error = err.Error()
+		}
+		c.Duration = time.Since(c.Received)
+		t.record(c.RMBCall)
+	}
+
+	for c := range t.inflight {
+		if time.Since(c.Received) > dropAfter {
+			delete(t.inflight, c)
+			c.Result = ResultDropped
+			c.Duration = time.Since(c.Received)
+			t.record(c.RMBCall)
+		}
+	}
+}
+
+// record adds a finished call, must be called with t.m held
+func (t *Tracer) record(c zos.RMBCall) {
+	if len(t.ring) < cap(t.ring) {
+		t.ring = append(t.ring, c)
+	} else if cap(t.ring) > 0 {
+		t.ring[t.next] = c
+		t.next = (t.next + 1) % cap(t.ring)
+	}
+
+	command := c.Command
+	if _, ok := t.routes[command]; !ok {
+		command = unknownCommand
+	}
+
+	stats, ok := t.stats[command]
+	if !ok {
+		stats = &zos.RMBCommandStats{
+			Command: command,
+			Results: make(map[string]uint64),
+			Buckets: buckets,
+			Counts:  make([]uint64, len(buckets)),
+		}
+		t.stats[command] = stats
+	}
+
+	stats.Results[c.Result]++
+	if c.Result == ResultDispatched {
+		// the handler of the call is not traced, so it has no latency
+		return
+	}
+
+	stats.Total++
+	stats.Sum += c.Duration.Seconds()
+	for i, bound := range buckets {
+		if c.Duration.Seconds() <= bound {
+			stats.Counts[i]++
+			break
+		}
+	}
+}
+
+// Recent implements zos.RMBTracer
+func (t *Tracer) Recent() []zos.RMBCall {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	calls := make([]zos.RMBCall, 0, len(t.ring))
+	for i := len(t.ring) - 1; i >= 0; i-- {
+		calls = append(calls, t.ring[(t.next+i)%len(t.ring)])
+	}
+
+	return calls
+}
+
+// Stats implements zos.RMBTracer
+func (t *Tracer) Stats() []zos.RMBCommandStats {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	result := make([]zos.RMBCommandStats, 0, len(t.stats))
+	for _, stats := range t.stats {
+		copied := *stats
+		copied.Results = make(map[string]uint64, len(stats.Results))
+		for k, v := range stats.Results {
+			copied.Results[k] = v
+		}
+		copied.Counts = append([]uint64(nil), stats.Counts...)
+		result = append(result, copied)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Command < result[j].Command
+	})
+
+	return result
+}
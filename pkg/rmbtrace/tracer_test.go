@@ -0,0 +1,128 @@
+package rmbtrace
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/threefoldtech/tfgrid-sdk-go/rmb-sdk-go/peer"
+	"github.com/threefoldtech/tfgrid-sdk-go/rmb-sdk-go/peer/types"
+	zos "github.com/threefoldtech/zos/pkg"
+	"github.com/threefoldtech/zos/pkg/rmbpolicy"
+)
+
+func TestRecent(t *testing.T) {
+	tracer := New(2)
+	for _, command := range []string{"a", "b", "c"} {
+		tracer.m.Lock()
+		tracer.record(zos.RMBCall{Command: command, Result: ResultOK})
+		tracer.m.Unlock()
+	}
+
+	recent := tracer.Recent()
+	if len(recent) != 2 {
+		t.Fatalf("expected 2 calls got %d", len(recent))
+	}
+
+	if recent[0].Command != "c" || recent[1].Command != "b" {
+		t.Fatalf("unexpected order: %+v", recent)
+	}
+}
+
+func request(command string) *types.Envelope {
+	return &types.Envelope{
+		Source:  &types.Address{Twin: 1},
+		Message: &types.Envelope_Request{Request: &types.Request{Command: command}},
+	}
+}
+
+func TestFinish(t *testing.T) {
+	tracer := New(10)
+	tracer.Route("zos.system.version", "zos.admin.interfaces")
+
+	ok := tracer.start(request("zos.system.version"))
+	dropped := tracer.start(request("zos.system.version"))
+	dropped.Received = time.Now().Add(-dropAfter - time.Second)
+	denied := tracer.start(request("zos.admin.interfaces"))
+
+	tracer.finish(ok, ResultOK, nil)
+	tracer.finish(denied, ResultDenied, rmbpolicy.ErrDenied)
+
+	stats := tracer.Stats()
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 commands got %d", len(stats))
+	}
+
+	admin, system := stats[0], stats[1]
+	if admin.Results[ResultDenied] != 1 || admin.Total != 1 {
+		t.Fatalf("unexpected admin stats: %+v", admin)
+	}
+
+	if system.Results[ResultOK] != 1 || system.Results[ResultDropped] != 1 || system.Total != 2 {
+		t.Fatalf("unexpected system stats: %+v", system)
+	}
+
+	// the ok call is in the first bucket, the dropped one exceeds all buckets
+	if system.Counts[0] != 1 {
+		t.Fatalf("unexpected histogram: %+v", system.Counts)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	tracer := New(10)
+
+	handlers := map[string]peer.HandlerFunc{
+		"version": tracer.Handler("zos.system.version", func(ctx context.Context, payload []byte) (interface{}, error) {
+			return "1.0", nil
+		}),
+		"reboot": tracer.Handler("zos.system.reboot", func(ctx context.Context, payload []byte) (interface{}, error) {
+			return nil, fmt.Errorf("not allowed")
+		}),
+	}
+
+	for _, command := range []string{"version", "reboot"} {
+		c := tracer.start(request("zos.system." + command))
+		ctx := context.WithValue(context.Background(), callKey{}, c)
+		if _, err := tracer.Middleware(ctx, nil); err != nil {
+			t.Fatal(err)
+		}
+		_, _ = handlers[command](ctx, nil)
+	}
+
+	recent := tracer.Recent()
+	if len(recent) != 2 {
+		t.Fatalf("expected 2 calls got %d", len(recent))
+	}
+
+	if recent[0].Result != ResultFailed || recent[0].Error != "not allowed" || recent[1].Result != ResultOK {
+		t.Fatalf("unexpected calls: %+v", recent)
+	}
+}
+
+func TestUnknown(t *testing.T) {
+	tracer := New(10)
+	tracer.Route("zos.system.version")
+
+	for _, command := range []string{"zos.system.version", "zos.made.up", "zos.made.up2"} {
+		c := tracer.start(request(command))
+		ctx := context.WithValue(context.Background(), callKey{}, c)
+		if _, err := tracer.Middleware(ctx, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := tracer.Stats()
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 commands got %+v", stats)
+	}
+
+	unknown, version := stats[0], stats[1]
+	if unknown.Command != unknownCommand || unknown.Results[ResultUnknown] != 2 {
+		t.Fatalf("unexpected unknown stats: %+v", unknown)
+	}
+
+	if version.Results[ResultDispatched] != 1 || version.Total != 0 {
+		t.Fatalf("unexpected version stats: %+v", version)
+	}
+}
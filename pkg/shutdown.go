@@ -0,0 +1,33 @@
+package pkg
+
+import "time"
+
+//go:generate zbusc -module provision -version 0.0.1 -name quiescer -package stubs github.com/threefoldtech/zos/pkg+Quiescer stubs/quiescer_stub.go
+//go:generate zbusc -module power -version 0.0.1 -name shutdown -package stubs github.com/threefoldtech/zos/pkg+NodeShutdown stubs/node_shutdown_stub.go
+//go:generate zbusc -module vmd -version 0.0.1 -name shutdown -package stubs github.com/threefoldtech/zos/pkg+VMShutdown stubs/vm_shutdown_stub.go
+
+// Quiescer prepares a module for the node power off
+type Quiescer interface {
+	// Quiesce pauses the module work and flushes its state, it returns
+	// once the work in flight is done. The module keeps running until the
+	// node halts.
+	Quiesce() error
+	// Resume resumes the module work if the power off is aborted
+	Resume() error
+}
+
+// NodeShutdown powers the node off gracefully
+type NodeShutdown interface {
+	// PowerOff flushes the modules state, reports the final uptime and
+	// marks the node down before it stops the vms and containers and halts
+	// the node. It fails if deployments are active or a step fails unless
+	// forced.
+	PowerOff(force bool) error
+}
+
+// VMShutdown stops vms gracefully
+type VMShutdown interface {
+	// Shutdown presses the vm power button and waits for the guest to power
+	// off. The vm is deleted once it's off, or forced off after the timeout.
+	Shutdown(name string, timeout time.Duration) error
+}
@@ -0,0 +1,45 @@
+// GENERATED CODE
+// --------------
+// please do not edit manually instead use the "zbusc" to regenerate
+
+package stubs
+
+import (
+	"context"
+	tfchainclientgo "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	zbus "github.com/threefoldtech/zbus"
+)
+
+type ChainReaderStub struct {
+	client zbus.Client
+	module string
+	object zbus.ObjectID
+}
+
+func NewChainReaderStub(client zbus.Client) *ChainReaderStub {
+	return &ChainReaderStub{
+		client: client,
+		module: "api-gateway",
+		object: zbus.ObjectID{
+			Name:    "chain-reader",
+			Version: "0.0.1",
+		},
+	}
+}
+
+func (s *ChainReaderStub) GetNodePowerTarget(ctx context.Context, arg0 uint32) (ret0 tfchainclientgo.NodePower, ret1 error) {
+	args := []interface{}{arg0}
+	result, err := s.client.RequestContext(ctx, s.module, s.object, "GetNodePowerTarget", args...)
+	if err != nil {
+		panic(err)
+	}
+	result.PanicOnError()
+	ret1 = result.CallError()
+	loader := zbus.Loader{
+		&ret0,
+	}
+	if err := result.Unmarshal(&loader); err != nil {
+		panic(err)
+	}
+	return
+}
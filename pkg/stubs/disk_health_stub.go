@@ -0,0 +1,44 @@
+// GENERATED CODE
+// --------------
+// please do not edit manually instead use the "zbusc" to regenerate
+
+package stubs
+
+import (
+	"context"
+	zbus "github.com/threefoldtech/zbus"
+	pkg "github.com/threefoldtech/zos/pkg"
+)
+
+type DiskHealthMonitorStub struct {
+	client zbus.Client
+	module string
+	object zbus.ObjectID
+}
+
+func NewDiskHealthMonitorStub(client zbus.Client) *DiskHealthMonitorStub {
+	return &DiskHealthMonitorStub{
+		client: client,
+		module: "node",
+		object: zbus.ObjectID{
+			Name:    "disk-health",
+			Version: "0.0.1",
+		},
+	}
+}
+
+func (s *DiskHealthMonitorStub) Health(ctx context.Context) (ret0 []pkg.DiskHealth) {
+	args := []interface{}{}
+	result, err := s.client.RequestContext(ctx, s.module, s.object, "Health", args...)
+	if err != nil {
+		panic(err)
+	}
+	result.PanicOnError()
+	loader := zbus.Loader{
+		&ret0,
+	}
+	if err := result.Unmarshal(&loader); err != nil {
+		panic(err)
+	}
+	return
+}
@@ -0,0 +1,130 @@
+// GENERATED CODE
+// --------------
+// please do not edit manually instead use the "zbusc" to regenerate
+
+package stubs
+
+import (
+	"context"
+	tfchainclientgo "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	zbus "github.com/threefoldtech/zbus"
+	pkg "github.com/threefoldtech/zos/pkg"
+)
+
+type ExtrinsicQueueStub struct {
+	client zbus.Client
+	module string
+	object zbus.ObjectID
+}
+
+func NewExtrinsicQueueStub(client zbus.Client) *ExtrinsicQueueStub {
+	return &ExtrinsicQueueStub{
+		client: client,
+		module: "api-gateway",
+		object: zbus.ObjectID{
+			Name:    "extrinsics",
+			Version: "0.0.1",
+		},
+	}
+}
+
+func (s *ExtrinsicQueueStub) Pending(ctx context.Context) (ret0 []pkg.ExtrinsicStatus) {
+	args := []interface{}{}
+	result, err := s.client.RequestContext(ctx, s.module, s.object, "Pending", args...)
+	if err != nil {
+		panic(err)
+	}
+	result.PanicOnError()
+	loader := zbus.Loader{
+		&ret0,
+	}
+	if err := result.Unmarshal(&loader); err != nil {
+		panic(err)
+	}
+	return
+}
+
+func (s *ExtrinsicQueueStub) Status(ctx context.Context, arg0 uint64) (ret0 pkg.ExtrinsicStatus, ret1 error) {
+	args := []interface{}{arg0}
+	result, err := s.client.RequestContext(ctx, s.module, s.object, "Status", args...)
+	if err != nil {
+		panic(err)
+	}
+	result.PanicOnError()
+	ret1 = result.CallError()
+	loader := zbus.Loader{
+		&ret0,
+	}
+	if err := result.Unmarshal(&loader); err != nil {
+		panic(err)
+	}
+	return
+}
+
+func (s *ExtrinsicQueueStub) SubmitContractConsumption(ctx context.Context, arg0 []tfchainclientgo.ContractResources) (ret0 uint64, ret1 error) {
+	args := []interface{}{arg0}
+	result, err := s.client.RequestContext(ctx, s.module, s.object, "SubmitContractConsumption", args...)
+	if err != nil {
+		panic(err)
+	}
+	result.PanicOnError()
+	ret1 = result.CallError()
+	loader := zbus.Loader{
+		&ret0,
+	}
+	if err := result.Unmarshal(&loader); err != nil {
+		panic(err)
+	}
+	return
+}
+
+func (s *ExtrinsicQueueStub) SubmitPowerState(ctx context.Context, arg0 bool) (ret0 uint64, ret1 error) {
+	args := []interface{}{arg0}
+	result, err := s.client.RequestContext(ctx, s.module, s.object, "SubmitPowerState", args...)
+	if err != nil {
+		panic(err)
+	}
+	result.PanicOnError()
+	ret1 = result.CallError()
+	loader := zbus.Loader{
+		&ret0,
+	}
+	if err := result.Unmarshal(&loader); err != nil {
+		panic(err)
+	}
+	return
+}
+
+func (s *ExtrinsicQueueStub) SubmitReport(ctx context.Context, arg0 []tfchainclientgo.NruConsumption) (ret0 uint64, ret1 error) {
+	args := []interface{}{arg0}
+	result, err := s.client.RequestContext(ctx, s.module, s.object, "SubmitReport", args...)
+	if err != nil {
+		panic(err)
+	}
+	result.PanicOnError()
+	ret1 = result.CallError()
+	loader := zbus.Loader{
+		&ret0,
+	}
+	if err := result.Unmarshal(&loader); err != nil {
+		panic(err)
+	}
+	return
+}
+
+func (s *ExtrinsicQueueStub) SubmitUptime(ctx context.Context, arg0 uint64, arg1 uint64) (ret0 uint64, ret1 error) {
+	args := []interface{}{arg0, arg1}
+	result, err := s.client.RequestContext(ctx, s.module, s.object, "SubmitUptime", args...)
+	if err != nil {
+		panic(err)
+	}
+	result.PanicOnError()
+	ret1 = result.CallError()
+	loader := zbus.Loader{
+		&ret0,
+	}
+	if err := result.Unmarshal(&loader); err != nil {
+		panic(err)
+	}
+	return
+}
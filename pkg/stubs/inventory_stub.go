@@ -0,0 +1,45 @@
+// GENERATED CODE
+// --------------
+// please do not edit manually instead use the "zbusc" to regenerate
+
+package stubs
+
+import (
+	"context"
+	zbus "github.com/threefoldtech/zbus"
+	pkg "github.com/threefoldtech/zos/pkg"
+)
+
+type HardwareInventoryStub struct {
+	client zbus.Client
+	module string
+	object zbus.ObjectID
+}
+
+func NewHardwareInventoryStub(client zbus.Client) *HardwareInventoryStub {
+	return &HardwareInventoryStub{
+		client: client,
+		module: "node",
+		object: zbus.ObjectID{
+			Name:    "inventory",
+			Version: "0.0.1",
+		},
+	}
+}
+
+func (s *HardwareInventoryStub) Get(ctx context.Context) (ret0 pkg.Inventory, ret1 error) {
+	args := []interface{}{}
+	result, err := s.client.RequestContext(ctx, s.module, s.object, "Get", args...)
+	if err != nil {
+		panic(err)
+	}
+	result.PanicOnError()
+	ret1 = result.CallError()
+	loader := zbus.Loader{
+		&ret0,
+	}
+	if err := result.Unmarshal(&loader); err != nil {
+		panic(err)
+	}
+	return
+}
@@ -0,0 +1,44 @@
+// GENERATED CODE
+// --------------
+// please do not edit manually instead use the "zbusc" to regenerate
+
+package stubs
+
+import (
+	"context"
+	zbus "github.com/threefoldtech/zbus"
+	pkg "github.com/threefoldtech/zos/pkg"
+)
+
+type NetworkGCStub struct {
+	client zbus.Client
+	module string
+	object zbus.ObjectID
+}
+
+func NewNetworkGCStub(client zbus.Client) *NetworkGCStub {
+	return &NetworkGCStub{
+		client: client,
+		module: "network",
+		object: zbus.ObjectID{
+			Name:    "network-gc",
+			Version: "0.0.1",
+		},
+	}
+}
+
+func (s *NetworkGCStub) Status(ctx context.Context) (ret0 pkg.NetworkGCStatus) {
+	args := []interface{}{}
+	result, err := s.client.RequestContext(ctx, s.module, s.object, "Status", args...)
+	if err != nil {
+		panic(err)
+	}
+	result.PanicOnError()
+	loader := zbus.Loader{
+		&ret0,
+	}
+	if err := result.Unmarshal(&loader); err != nil {
+		panic(err)
+	}
+	return
+}
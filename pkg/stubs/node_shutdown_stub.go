@@ -0,0 +1,42 @@
+// GENERATED CODE
+// --------------
+// please do not edit manually instead use the "zbusc" to regenerate
+
+package stubs
+
+import (
+	"context"
+	zbus "github.com/threefoldtech/zbus"
+)
+
+type NodeShutdownStub struct {
+	client zbus.Client
+	module string
+	object zbus.ObjectID
+}
+
+func NewNodeShutdownStub(client zbus.Client) *NodeShutdownStub {
+	return &NodeShutdownStub{
+		client: client,
+		module: "power",
+		object: zbus.ObjectID{
+			Name:    "shutdown",
+			Version: "0.0.1",
+		},
+	}
+}
+
+func (s *NodeShutdownStub) PowerOff(ctx context.Context, arg0 bool) (ret0 error) {
+	args := []interface{}{arg0}
+	result, err := s.client.RequestContext(ctx, s.module, s.object, "PowerOff", args...)
+	if err != nil {
+		panic(err)
+	}
+	result.PanicOnError()
+	ret0 = result.CallError()
+	loader := zbus.Loader{}
+	if err := result.Unmarshal(&loader); err != nil {
+		panic(err)
+	}
+	return
+}
@@ -0,0 +1,44 @@
+// GENERATED CODE
+// --------------
+// please do not edit manually instead use the "zbusc" to regenerate
+
+package stubs
+
+import (
+	"context"
+	zbus "github.com/threefoldtech/zbus"
+	pkg "github.com/threefoldtech/zos/pkg"
+)
+
+type PublicDriftMonitorStub struct {
+	client zbus.Client
+	module string
+	object zbus.ObjectID
+}
+
+func NewPublicDriftMonitorStub(client zbus.Client) *PublicDriftMonitorStub {
+	return &PublicDriftMonitorStub{
+		client: client,
+		module: "network",
+		object: zbus.ObjectID{
+			Name:    "public-drift",
+			Version: "0.0.1",
+		},
+	}
+}
+
+func (s *PublicDriftMonitorStub) Status(ctx context.Context) (ret0 pkg.PublicDriftStatus) {
+	args := []interface{}{}
+	result, err := s.client.RequestContext(ctx, s.module, s.object, "Status", args...)
+	if err != nil {
+		panic(err)
+	}
+	result.PanicOnError()
+	loader := zbus.Loader{
+		&ret0,
+	}
+	if err := result.Unmarshal(&loader); err != nil {
+		panic(err)
+	}
+	return
+}
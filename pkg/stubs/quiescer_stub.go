@@ -0,0 +1,57 @@
+// GENERATED CODE
+// --------------
+// please do not edit manually instead use the "zbusc" to regenerate
+
+package stubs
+
+import (
+	"context"
+	zbus "github.com/threefoldtech/zbus"
+)
+
+type QuiescerStub struct {
+	client zbus.Client
+	module string
+	object zbus.ObjectID
+}
+
+func NewQuiescerStub(client zbus.Client) *QuiescerStub {
+	return &QuiescerStub{
+		client: client,
+		module: "provision",
+		object: zbus.ObjectID{
+			Name:    "quiescer",
+			Version: "0.0.1",
+		},
+	}
+}
+
+func (s *QuiescerStub) Quiesce(ctx context.Context) (ret0 error) {
+	args := []interface{}{}
+	result, err := s.client.RequestContext(ctx, s.module, s.object, "Quiesce", args...)
+	if err != nil {
+		panic(err)
+	}
+	result.PanicOnError()
+	ret0 = result.CallError()
+	loader := zbus.Loader{}
+	if err := result.Unmarshal(&loader); err != nil {
+		panic(err)
+	}
+	return
+}
+
+func (s *QuiescerStub) Resume(ctx context.Context) (ret0 error) {
+	args := []interface{}{}
+	result, err := s.client.RequestContext(ctx, s.module, s.object, "Resume", args...)
+	if err != nil {
+		panic(err)
+	}
+	result.PanicOnError()
+	ret0 = result.CallError()
+	loader := zbus.Loader{}
+	if err := result.Unmarshal(&loader); err != nil {
+		panic(err)
+	}
+	return
+}
@@ -0,0 +1,59 @@
+// GENERATED CODE
+// --------------
+// please do not edit manually instead use the "zbusc" to regenerate
+
+package stubs
+
+import (
+	"context"
+	zbus "github.com/threefoldtech/zbus"
+	pkg "github.com/threefoldtech/zos/pkg"
+)
+
+type RMBPeerStub struct {
+	client zbus.Client
+	module string
+	object zbus.ObjectID
+}
+
+func NewRMBPeerStub(client zbus.Client) *RMBPeerStub {
+	return &RMBPeerStub{
+		client: client,
+		module: "api-gateway",
+		object: zbus.ObjectID{
+			Name:    "rmb-peer",
+			Version: "0.0.1",
+		},
+	}
+}
+
+func (s *RMBPeerStub) Reload(ctx context.Context, arg0 bool) (ret0 error) {
+	args := []interface{}{arg0}
+	result, err := s.client.RequestContext(ctx, s.module, s.object, "Reload", args...)
+	if err != nil {
+		panic(err)
+	}
+	result.PanicOnError()
+	ret0 = result.CallError()
+	loader := zbus.Loader{}
+	if err := result.Unmarshal(&loader); err != nil {
+		panic(err)
+	}
+	return
+}
+
+func (s *RMBPeerStub) Status(ctx context.Context) (ret0 pkg.RMBPeerStatus) {
+	args := []interface{}{}
+	result, err := s.client.RequestContext(ctx, s.module, s.object, "Status", args...)
+	if err != nil {
+		panic(err)
+	}
+	result.PanicOnError()
+	loader := zbus.Loader{
+		&ret0,
+	}
+	if err := result.Unmarshal(&loader); err != nil {
+		panic(err)
+	}
+	return
+}
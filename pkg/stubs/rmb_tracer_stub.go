@@ -0,0 +1,60 @@
+// GENERATED CODE
+// --------------
+// please do not edit manually instead use the "zbusc" to regenerate
+
+package stubs
+
+import (
+	"context"
+	zbus "github.com/threefoldtech/zbus"
+	pkg "github.com/threefoldtech/zos/pkg"
+)
+
+type RMBTracerStub struct {
+	client zbus.Client
+	module string
+	object zbus.ObjectID
+}
+
+func NewRMBTracerStub(client zbus.Client) *RMBTracerStub {
+	return &RMBTracerStub{
+		client: client,
+		module: "api-gateway",
+		object: zbus.ObjectID{
+			Name:    "rmb-tracer",
+			Version: "0.0.1",
+		},
+	}
+}
+
+func (s *RMBTracerStub) Recent(ctx context.Context) (ret0 []pkg.RMBCall) {
+	args := []interface{}{}
+	result, err := s.client.RequestContext(ctx, s.module, s.object, "Recent", args...)
+	if err != nil {
+		panic(err)
+	}
+	result.PanicOnError()
+	loader := zbus.Loader{
+		&ret0,
+	}
+	if err := result.Unmarshal(&loader); err != nil {
+		panic(err)
+	}
+	return
+}
+
+func (s *RMBTracerStub) Stats(ctx context.Context) (ret0 []pkg.RMBCommandStats) {
+	args := []interface{}{}
+	result, err := s.client.RequestContext(ctx, s.module, s.object, "Stats", args...)
+	if err != nil {
+		panic(err)
+	}
+	result.PanicOnError()
+	loader := zbus.Loader{
+		&ret0,
+	}
+	if err := result.Unmarshal(&loader); err != nil {
+		panic(err)
+	}
+	return
+}
@@ -0,0 +1,44 @@
+// GENERATED CODE
+// --------------
+// please do not edit manually instead use the "zbusc" to regenerate
+
+package stubs
+
+import (
+	"context"
+	zbus "github.com/threefoldtech/zbus"
+	pkg "github.com/threefoldtech/zos/pkg"
+)
+
+type SubstrateHealthStub struct {
+	client zbus.Client
+	module string
+	object zbus.ObjectID
+}
+
+func NewSubstrateHealthStub(client zbus.Client) *SubstrateHealthStub {
+	return &SubstrateHealthStub{
+		client: client,
+		module: "api-gateway",
+		object: zbus.ObjectID{
+			Name:    "substrate-health",
+			Version: "0.0.1",
+		},
+	}
+}
+
+func (s *SubstrateHealthStub) Endpoints(ctx context.Context) (ret0 []pkg.SubstrateEndpoint) {
+	args := []interface{}{}
+	result, err := s.client.RequestContext(ctx, s.module, s.object, "Endpoints", args...)
+	if err != nil {
+		panic(err)
+	}
+	result.PanicOnError()
+	loader := zbus.Loader{
+		&ret0,
+	}
+	if err := result.Unmarshal(&loader); err != nil {
+		panic(err)
+	}
+	return
+}
@@ -0,0 +1,60 @@
+// GENERATED CODE
+// --------------
+// please do not edit manually instead use the "zbusc" to regenerate
+
+package stubs
+
+import (
+	"context"
+	zbus "github.com/threefoldtech/zbus"
+	pkg "github.com/threefoldtech/zos/pkg"
+)
+
+type UptimeHistoryStub struct {
+	client zbus.Client
+	module string
+	object zbus.ObjectID
+}
+
+func NewUptimeHistoryStub(client zbus.Client) *UptimeHistoryStub {
+	return &UptimeHistoryStub{
+		client: client,
+		module: "power",
+		object: zbus.ObjectID{
+			Name:    "uptime",
+			Version: "0.0.1",
+		},
+	}
+}
+
+func (s *UptimeHistoryStub) Pending(ctx context.Context) (ret0 pkg.UptimePending) {
+	args := []interface{}{}
+	result, err := s.client.RequestContext(ctx, s.module, s.object, "Pending", args...)
+	if err != nil {
+		panic(err)
+	}
+	result.PanicOnError()
+	loader := zbus.Loader{
+		&ret0,
+	}
+	if err := result.Unmarshal(&loader); err != nil {
+		panic(err)
+	}
+	return
+}
+
+func (s *UptimeHistoryStub) Reports(ctx context.Context) (ret0 []pkg.UptimeReport) {
+	args := []interface{}{}
+	result, err := s.client.RequestContext(ctx, s.module, s.object, "Reports", args...)
+	if err != nil {
+		panic(err)
+	}
+	result.PanicOnError()
+	loader := zbus.Loader{
+		&ret0,
+	}
+	if err := result.Unmarshal(&loader); err != nil {
+		panic(err)
+	}
+	return
+}
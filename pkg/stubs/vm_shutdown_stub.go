@@ -0,0 +1,43 @@
+// GENERATED CODE
+// --------------
+// please do not edit manually instead use the "zbusc" to regenerate
+
+package stubs
+
+import (
+	"context"
+	zbus "github.com/threefoldtech/zbus"
+	"time"
+)
+
+type VMShutdownStub struct {
+	client zbus.Client
+	module string
+	object zbus.ObjectID
+}
+
+func NewVMShutdownStub(client zbus.Client) *VMShutdownStub {
+	return &VMShutdownStub{
+		client: client,
+		module: "vmd",
+		object: zbus.ObjectID{
+			Name:    "shutdown",
+			Version: "0.0.1",
+		},
+	}
+}
+
+func (s *VMShutdownStub) Shutdown(ctx context.Context, arg0 string, arg1 time.Duration) (ret0 error) {
+	args := []interface{}{arg0, arg1}
+	result, err := s.client.RequestContext(ctx, s.module, s.object, "Shutdown", args...)
+	if err != nil {
+		panic(err)
+	}
+	result.PanicOnError()
+	ret0 = result.CallError()
+	loader := zbus.Loader{}
+	if err := result.Unmarshal(&loader); err != nil {
+		panic(err)
+	}
+	return
+}
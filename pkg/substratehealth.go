@@ -0,0 +1,29 @@
+package pkg
+
+import "time"
+
+//go:generate zbusc -module api-gateway -version 0.0.1 -name substrate-health -package stubs github.com/threefoldtech/zos/pkg+SubstrateHealth stubs/substrate_health_stub.go
+
+// SubstrateEndpoint is the health of a single substrate endpoint
+type SubstrateEndpoint struct {
+	URL string `json:"url"`
+	// Score is the endpoint health score between 0 (unusable) and 1 (perfect),
+	// calls are routed to the endpoint with the highest score
+	Score float64 `json:"score"`
+	// Latency is the moving average of the endpoint response time
+	Latency time.Duration `json:"latency"`
+	// ErrorRate is the moving average of failed calls between 0 and 1
+	ErrorRate float64 `json:"error_rate"`
+	// Height is the last seen block height of the endpoint
+	Height uint32 `json:"height"`
+	// Lag is the number of blocks the endpoint is behind the highest known height
+	Lag       uint32    `json:"lag"`
+	LastError string    `json:"last_error"`
+	Checked   time.Time `json:"checked"`
+}
+
+// SubstrateHealth interface
+type SubstrateHealth interface {
+	// Endpoints returns the health of all substrate endpoints, sorted by score
+	Endpoints() []SubstrateEndpoint
+}
@@ -0,0 +1,246 @@
+package substratepool
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/rs/zerolog/log"
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	"github.com/threefoldtech/zosbase/pkg"
+	"github.com/threefoldtech/zosbase/pkg/events"
+)
+
+const (
+	// cacheTTL is how long a cached object is used before it's fetched again
+	cacheTTL = 5 * time.Minute
+	// cacheMaxStale is how long an expired object can still be served if
+	// the chain can't be reached, objects older than that are evicted
+	cacheMaxStale = time.Hour
+)
+
+var _ pkg.SubstrateGateway = (*Cache)(nil)
+
+type cacheEntry struct {
+	value   interface{}
+	fetched time.Time
+}
+
+// Cache is a read-through cache over a substrate gateway. Cached objects
+// are invalidated by the chain events streamed by the node, or when they
+// expire. Expired objects are still served for a while if the chain can't
+// be reached. Calls that are not cached go directly to the gateway.
+//
+// Contracts are always fetched while the chain can be reached, since the
+// node doesn't stream contract updates and deployment updates are validated
+// against the contract hash. The cached contract is only served when the
+// chain can't be reached, and it's invalidated if the contract is canceled
+// or locked.
+type Cache struct {
+	pkg.SubstrateGateway
+
+	m       sync.Mutex
+	entries map[string]cacheEntry
+	swept   time.Time
+}
+
+// NewCache creates a new cache over gw
+func NewCache(gw pkg.SubstrateGateway) *Cache {
+	return &Cache{
+		SubstrateGateway: gw,
+		entries:          make(map[string]cacheEntry),
+		swept:            time.Now(),
+	}
+}
+
+// Listen invalidates cached objects on chain events until context is cancelled
+func (c *Cache) Listen(ctx context.Context, consumer *events.RedisConsumer) error {
+	public, err := consumer.PublicConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	power, err := consumer.PowerTargetChange(ctx)
+	if err != nil {
+		return err
+	}
+
+	canceled, err := consumer.ContractCancelled(ctx)
+	if err != nil {
+		return err
+	}
+
+	locked, err := consumer.ContractLocked(ctx)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-public:
+			// the event is for this node, but we don't know our own
+			// node id so all nodes are invalidated
+			c.invalidatePrefix(nodePrefix)
+		case event := <-power:
+			c.invalidate(nodeKey(event.NodeID))
+		case event := <-canceled:
+			c.invalidate(contractKey(event.Contract))
+		case event := <-locked:
+			c.invalidate(contractKey(event.Contract))
+		}
+	}
+}
+
+const (
+	nodePrefix = "node:"
+)
+
+func nodeKey(id uint32) string { return fmt.Sprintf("%s%d", nodePrefix, id) }
+
+func contractKey(id uint64) string { return fmt.Sprintf("contract:%d", id) }
+
+func (c *Cache) invalidate(key string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	log.Debug().Str("key", key).Msg("invalidating cached chain object")
+	delete(c.entries, key)
+}
+
+func (c *Cache) invalidatePrefix(prefix string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	for key := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// sweep evicts the objects that are too old to be served even stale, it
+// runs at most once per cacheTTL. Must be called with the lock held.
+func (c *Cache) sweep() {
+	if time.Since(c.swept) < cacheTTL {
+		return
+	}
+
+	c.swept = time.Now()
+	for key, entry := range c.entries {
+		if time.Since(entry.fetched) >= cacheMaxStale {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// cached returns the object at key from the cache, or calls fetch to get it
+func cached[T any](c *Cache, key string, fetch func() (T, error)) (T, error) {
+	return cachedTTL(c, key, cacheTTL, fetch)
+}
+
+// cachedTTL is like cached, the object is fetched again once it's older
+// than ttl
+func cachedTTL[T any](c *Cache, key string, ttl time.Duration, fetch func() (T, error)) (T, error) {
+	c.m.Lock()
+	entry, ok := c.entries[key]
+	c.m.Unlock()
+
+	if ok && time.Since(entry.fetched) < ttl {
+		return entry.value.(T), nil
+	}
+
+	value, err := fetch()
+	if err == nil {
+		c.m.Lock()
+		c.entries[key] = cacheEntry{value: value, fetched: time.Now()}
+		c.sweep()
+		c.m.Unlock()
+		return value, nil
+	}
+
+	if ok && isEndpointError(err) && time.Since(entry.fetched) < cacheMaxStale {
+		log.Warn().Err(err).Str("key", key).Msg("chain is not reachable, using stale cached object")
+		return entry.value.(T), nil
+	}
+
+	return value, err
+}
+
+// cachedSubstrateError is like cached for calls that return a pkg.SubstrateError
+func cachedSubstrateError[T any](c *Cache, key string, ttl time.Duration, fetch func() (T, pkg.SubstrateError)) (T, pkg.SubstrateError) {
+	var serr pkg.SubstrateError
+	value, err := cachedTTL(c, key, ttl, func() (T, error) {
+		var value T
+		value, serr = fetch()
+		if serr.IsError() {
+			return value, serr.Err
+		}
+		return value, nil
+	})
+
+	if err == nil {
+		return value, pkg.SubstrateError{Code: pkg.CodeNoError}
+	}
+
+	return value, serr
+}
+
+// GetNode implements pkg.SubstrateGateway
+func (c *Cache) GetNode(id uint32) (substrate.Node, error) {
+	return cached(c, nodeKey(id), func() (substrate.Node, error) {
+		return c.SubstrateGateway.GetNode(id)
+	})
+}
+
+// GetNodeByTwinID implements pkg.SubstrateGateway
+func (c *Cache) GetNodeByTwinID(twin uint32) (uint32, pkg.SubstrateError) {
+	return cachedSubstrateError(c, fmt.Sprintf("node-by-twin:%d", twin), cacheTTL, func() (uint32, pkg.SubstrateError) {
+		return c.SubstrateGateway.GetNodeByTwinID(twin)
+	})
+}
+
+// GetTwin implements pkg.SubstrateGateway
+func (c *Cache) GetTwin(id uint32) (substrate.Twin, error) {
+	return cached(c, fmt.Sprintf("twin:%d", id), func() (substrate.Twin, error) {
+		return c.SubstrateGateway.GetTwin(id)
+	})
+}
+
+// GetTwinByPubKey implements pkg.SubstrateGateway
+func (c *Cache) GetTwinByPubKey(pk []byte) (uint32, pkg.SubstrateError) {
+	return cachedSubstrateError(c, fmt.Sprintf("twin-by-pk:%x", pk), cacheTTL, func() (uint32, pkg.SubstrateError) {
+		return c.SubstrateGateway.GetTwinByPubKey(pk)
+	})
+}
+
+// GetFarm implements pkg.SubstrateGateway
+func (c *Cache) GetFarm(id uint32) (substrate.Farm, error) {
+	return cached(c, fmt.Sprintf("farm:%d", id), func() (substrate.Farm, error) {
+		return c.SubstrateGateway.GetFarm(id)
+	})
+}
+
+// GetContract implements pkg.SubstrateGateway, the cached contract is only
+// served if the chain can't be reached
+func (c *Cache) GetContract(id uint64) (substrate.Contract, pkg.SubstrateError) {
+	return cachedSubstrateError(c, contractKey(id), 0, func() (substrate.Contract, pkg.SubstrateError) {
+		return c.SubstrateGateway.GetContract(id)
+	})
+}
+
+// UpdateNode implements pkg.SubstrateGateway
+func (c *Cache) UpdateNode(node substrate.Node) (uint32, error) {
+	defer c.invalidate(nodeKey(uint32(node.ID)))
+	return c.SubstrateGateway.UpdateNode(node)
+}
+
+// SetNodePowerState implements pkg.SubstrateGateway
+func (c *Cache) SetNodePowerState(up bool) (hash types.Hash, err error) {
+	defer c.invalidatePrefix(nodePrefix)
+	return c.SubstrateGateway.SetNodePowerState(up)
+}
@@ -0,0 +1,134 @@
+package substratepool
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/pkg/errors"
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	"github.com/threefoldtech/zosbase/pkg"
+)
+
+func TestCached(t *testing.T) {
+	c := NewCache(nil)
+
+	calls := 0
+	fetch := func() (int, error) {
+		calls++
+		return calls, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		value, err := cached(c, "key", fetch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != 1 || calls != 1 {
+			t.Fatalf("expected cached value 1 and a single fetch, got value %d after %d fetches", value, calls)
+		}
+	}
+
+	c.invalidate("key")
+	if value, _ := cached(c, "key", fetch); value != 2 {
+		t.Errorf("expected value to be fetched after invalidation, got %d", value)
+	}
+}
+
+func TestCachedStale(t *testing.T) {
+	c := NewCache(nil)
+	c.entries["key"] = cacheEntry{value: 1, fetched: time.Now().Add(-2 * cacheTTL)}
+
+	value, err := cached(c, "key", func() (int, error) {
+		return 0, fmt.Errorf("connection refused")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != 1 {
+		t.Errorf("expected stale value 1, got %d", value)
+	}
+
+	// not found is not hidden by stale objects
+	_, err = cached(c, "key", func() (int, error) {
+		return 0, errors.Wrap(substrate.ErrNotFound, "no object")
+	})
+	if err == nil {
+		t.Error("expected not found error")
+	}
+}
+
+func TestCacheSweep(t *testing.T) {
+	c := NewCache(nil)
+	c.entries["old"] = cacheEntry{value: 1, fetched: time.Now().Add(-2 * cacheMaxStale)}
+	c.entries["stale"] = cacheEntry{value: 1, fetched: time.Now().Add(-2 * cacheTTL)}
+
+	// sweeping runs at most once per ttl
+	if _, err := cached(c, "new", func() (int, error) { return 1, nil }); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.entries["old"]; !ok {
+		t.Fatal("expected no sweep right after creation")
+	}
+
+	c.swept = time.Now().Add(-cacheTTL)
+	if _, err := cached(c, "other", func() (int, error) { return 1, nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := c.entries["old"]; ok {
+		t.Error("expected old object to be evicted")
+	}
+
+	if _, ok := c.entries["stale"]; !ok {
+		t.Error("expected stale object to be kept")
+	}
+}
+
+// contractChain is a fake gateway that only returns contracts
+type contractChain struct {
+	pkg.SubstrateGateway
+
+	calls int
+	down  bool
+}
+
+func (c *contractChain) GetContract(id uint64) (substrate.Contract, pkg.SubstrateError) {
+	c.calls++
+	if c.down {
+		return substrate.Contract{}, pkg.SubstrateError{Err: fmt.Errorf("connection refused"), Code: pkg.CodeGenericError}
+	}
+
+	return substrate.Contract{ContractID: types.U64(id)}, pkg.SubstrateError{Code: pkg.CodeNoError}
+}
+
+func TestCacheContract(t *testing.T) {
+	chain := &contractChain{}
+	c := NewCache(chain)
+
+	for i := 0; i < 2; i++ {
+		if _, serr := c.GetContract(1); serr.IsError() {
+			t.Fatal(serr.Err)
+		}
+	}
+
+	if chain.calls != 2 {
+		t.Fatalf("contracts must be fetched while the chain is reachable, got %d fetches", chain.calls)
+	}
+
+	chain.down = true
+	contract, serr := c.GetContract(1)
+	if serr.IsError() {
+		t.Fatal(serr.Err)
+	}
+	if contract.ContractID != 1 {
+		t.Fatalf("expected stale contract 1, got %d", contract.ContractID)
+	}
+
+	// canceled contracts are not served stale
+	c.invalidate(contractKey(1))
+	if _, serr := c.GetContract(1); !serr.IsError() {
+		t.Fatal("expected error for invalidated contract")
+	}
+}
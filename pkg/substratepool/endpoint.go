@@ -0,0 +1,292 @@
+package substratepool
+
+import (
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/pkg/errors"
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	zos "github.com/threefoldtech/zos/pkg"
+	"github.com/threefoldtech/zosbase/pkg"
+	substrategw "github.com/threefoldtech/zosbase/pkg/substrate_gateway"
+)
+
+// alpha is the weight of a new sample in the endpoint moving averages
+const alpha = 0.2
+
+// endpoint is a single substrate endpoint and its health
+type endpoint struct {
+	url      string
+	identity substrate.Identity
+	manager  substrate.Manager
+
+	m         sync.Mutex
+	gw        pkg.SubstrateGateway
+	sub       *substrate.Substrate
+	latency   time.Duration
+	errorRate float64
+	height    uint32
+	lastError string
+	checked   time.Time
+}
+
+func newEndpoint(url string, identity substrate.Identity) *endpoint {
+	return &endpoint{
+		url:      url,
+		identity: identity,
+		manager:  substrate.NewManager(url),
+	}
+}
+
+// gateway returns the substrate gateway of this endpoint, the gateway
+// is created on first use
+func (e *endpoint) gateway() (pkg.SubstrateGateway, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	if e.gw != nil {
+		return e.gw, nil
+	}
+
+	gw, err := substrategw.NewSubstrateGateway(e.manager, e.identity)
+	if err != nil {
+		return nil, err
+	}
+
+	e.gw = gw
+	return gw, nil
+}
+
+// probe measures the endpoint latency and block height
+func (e *endpoint) probe() {
+	start := time.Now()
+	height, err := e.currentHeight()
+	e.record(time.Since(start), err)
+	if err != nil {
+		return
+	}
+
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.height = height
+}
+
+func (e *endpoint) currentHeight() (uint32, error) {
+	sub, err := e.substrate()
+	if err != nil {
+		return 0, err
+	}
+
+	return sub.GetCurrentHeight()
+}
+
+// accountNonce returns the nonce of the endpoint identity account
+func (e *endpoint) accountNonce() (uint64, error) {
+	sub, err := e.substrate()
+	if err != nil {
+		return 0, err
+	}
+
+	info, err := sub.GetAccount(e.identity)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint64(info.Nonce), nil
+}
+
+// powerTarget returns the power state and target of node
+func (e *endpoint) powerTarget(node uint32) (substrate.NodePower, error) {
+	sub, err := e.substrate()
+	if err != nil {
+		return substrate.NodePower{}, err
+	}
+
+	return sub.GetPowerTarget(node)
+}
+
+// included looks for the extrinsic signed by the endpoint identity with nonce
+// in the blocks after from. It returns ErrNotIncluded if the nonce was used by
+// another call or if the extrinsic is not found within inclusionWindow blocks.
+func (e *endpoint) included(call string, nonce uint64, from uint32) (Inclusion, error) {
+	sub, err := e.substrate()
+	if err != nil {
+		return Inclusion{}, err
+	}
+
+	cl, meta, err := sub.GetClient()
+	if err != nil {
+		return Inclusion{}, err
+	}
+
+	index, err := meta.FindCallIndex(call)
+	if err != nil {
+		return Inclusion{}, errors.Wrapf(err, "failed to find call '%s'", call)
+	}
+
+	account, err := types.NewAccountID(e.identity.PublicKey())
+	if err != nil {
+		return Inclusion{}, err
+	}
+
+	best, err := sub.GetCurrentHeight()
+	if err != nil {
+		return Inclusion{}, err
+	}
+
+	for height := from; height <= min(best, from+inclusionWindow); height++ {
+		hash, err := cl.RPC.Chain.GetBlockHash(uint64(height))
+		if err != nil {
+			return Inclusion{}, errors.Wrapf(err, "failed to get hash of block %d", height)
+		}
+
+		block, err := cl.RPC.Chain.GetBlock(hash)
+		if err != nil {
+			return Inclusion{}, errors.Wrapf(err, "failed to get block %d", height)
+		}
+
+		for i, ext := range block.Block.Extrinsics {
+			signature := ext.Signature
+			if !ext.IsSigned() || !signature.Signer.IsID || signature.Signer.AsID != *account {
+				continue
+			}
+
+			if n := big.Int(signature.Nonce); n.Uint64() != nonce {
+				continue
+			}
+
+			if ext.Method.CallIndex != index {
+				// the nonce was used by another extrinsic
+				return Inclusion{}, ErrNotIncluded
+			}
+
+			events, err := sub.GetEventsForBlock(height)
+			if err != nil {
+				return Inclusion{}, errors.Wrapf(err, "failed to get events of block %d", height)
+			}
+
+			inclusion := Inclusion{Block: hash}
+			for _, event := range events.System_ExtrinsicFailed {
+				if event.Phase.IsApplyExtrinsic && event.Phase.AsApplyExtrinsic == uint32(i) {
+					inclusion.Failed = true
+				}
+			}
+
+			return inclusion, nil
+		}
+	}
+
+	return Inclusion{}, ErrNotIncluded
+}
+
+// substrate returns the probe connection of the endpoint. The connection
+// is kept open, the client takes care of reconnecting if it's broken
+func (e *endpoint) substrate() (*substrate.Substrate, error) {
+	e.m.Lock()
+	sub := e.sub
+	e.m.Unlock()
+
+	if sub != nil {
+		return sub, nil
+	}
+
+	sub, err := e.manager.Substrate()
+	if err != nil {
+		return nil, err
+	}
+
+	e.m.Lock()
+	defer e.m.Unlock()
+	if e.sub != nil {
+		// another call connected in the meantime
+		sub.Close()
+		return e.sub, nil
+	}
+
+	e.sub = sub
+	return sub, nil
+}
+
+// record adds a call sample to the endpoint moving averages. err is
+// the endpoint error if any
+func (e *endpoint) record(latency time.Duration, err error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	failed := 0.0
+	if err != nil {
+		failed = 1
+		e.lastError = err.Error()
+	} else if e.latency == 0 {
+		e.latency = latency
+	} else {
+		e.latency = time.Duration(alpha*float64(latency) + (1-alpha)*float64(e.latency))
+	}
+
+	e.errorRate = alpha*failed + (1-alpha)*e.errorRate
+	e.checked = time.Now()
+}
+
+// status returns the endpoint health given the highest known block height
+func (e *endpoint) status(best uint32) zos.SubstrateEndpoint {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	var lag uint32
+	if best > e.height {
+		lag = best - e.height
+	}
+
+	return zos.SubstrateEndpoint{
+		URL:       e.url,
+		Score:     score(e.latency, e.errorRate, lag),
+		Latency:   e.latency,
+		ErrorRate: e.errorRate,
+		Height:    e.height,
+		Lag:       lag,
+		LastError: e.lastError,
+		Checked:   e.checked,
+	}
+}
+
+func (e *endpoint) close() {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	if e.sub != nil {
+		e.sub.Close()
+		e.sub = nil
+	}
+}
+
+// score computes the endpoint health score between 0 and 1. The score goes
+// down with the latency (halved at 1 second), the error rate and the number of
+// blocks the endpoint is behind.
+func score(latency time.Duration, errorRate float64, lag uint32) float64 {
+	return (1 - errorRate) / (1 + latency.Seconds()) / (1 + float64(lag))
+}
+
+// isEndpointError checks if err is caused by the endpoint and not
+// a normal result of the call like a not found object.
+func isEndpointError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	for _, expected := range []error{
+		substrate.ErrNotFound,
+		substrate.ErrAccountNotFound,
+		substrate.ErrIsUsurped,
+		substrate.ErrInvalidVersion,
+		substrate.ErrUnknownVersion,
+		ErrNotIncluded,
+	} {
+		if errors.Is(err, expected) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,57 @@
+package substratepool
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+)
+
+func TestScore(t *testing.T) {
+	healthy := score(100*time.Millisecond, 0, 0)
+	slow := score(2*time.Second, 0, 0)
+	failing := score(100*time.Millisecond, 0.5, 0)
+	behind := score(100*time.Millisecond, 0, 3)
+
+	for name, s := range map[string]float64{"slow": slow, "failing": failing, "behind": behind} {
+		if s >= healthy {
+			t.Errorf("expected %s endpoint score (%f) to be lower than healthy (%f)", name, s, healthy)
+		}
+	}
+
+	if s := score(0, 1, 0); s != 0 {
+		t.Errorf("expected score of always failing endpoint to be 0, got %f", s)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	e := endpoint{}
+	e.record(time.Second, nil)
+	if e.latency != time.Second || e.errorRate != 0 {
+		t.Fatalf("unexpected stats after first sample: %s, %f", e.latency, e.errorRate)
+	}
+
+	e.record(0, fmt.Errorf("connection refused"))
+	if e.latency != time.Second {
+		t.Errorf("failed calls must not change latency, got %s", e.latency)
+	}
+	if e.errorRate != alpha {
+		t.Errorf("expected error rate %f, got %f", alpha, e.errorRate)
+	}
+}
+
+func TestIsEndpointError(t *testing.T) {
+	if isEndpointError(nil) {
+		t.Error("nil is not an endpoint error")
+	}
+
+	if isEndpointError(errors.Wrap(substrate.ErrNotFound, "failed to get node")) {
+		t.Error("not found is not an endpoint error")
+	}
+
+	if !isEndpointError(fmt.Errorf("connection refused")) {
+		t.Error("expected endpoint error")
+	}
+}
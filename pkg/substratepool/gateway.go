@@ -0,0 +1,196 @@
+package substratepool
+
+import (
+	"time"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	"github.com/threefoldtech/zosbase/pkg"
+)
+
+// CreateNode implements pkg.SubstrateGateway
+func (p *Pool) CreateNode(node substrate.Node) (id uint32, err error) {
+	err = p.write("CreateNode", func(gw pkg.SubstrateGateway) (err error) {
+		id, err = gw.CreateNode(node)
+		return err
+	})
+	return
+}
+
+// CreateTwin implements pkg.SubstrateGateway
+func (p *Pool) CreateTwin(relay string, pk []byte) (id uint32, err error) {
+	err = p.write("CreateTwin", func(gw pkg.SubstrateGateway) (err error) {
+		id, err = gw.CreateTwin(relay, pk)
+		return err
+	})
+	return
+}
+
+// EnsureAccount implements pkg.SubstrateGateway
+func (p *Pool) EnsureAccount(activationURL []string, termsAndConditionsLink string, termsAndConditionsHash string) (info substrate.AccountInfo, err error) {
+	err = p.write("EnsureAccount", func(gw pkg.SubstrateGateway) (err error) {
+		info, err = gw.EnsureAccount(activationURL, termsAndConditionsLink, termsAndConditionsHash)
+		return err
+	})
+	return
+}
+
+// GetContract implements pkg.SubstrateGateway
+func (p *Pool) GetContract(id uint64) (contract substrate.Contract, serr pkg.SubstrateError) {
+	serr = p.readSubstrateError("GetContract", func(gw pkg.SubstrateGateway) (serr pkg.SubstrateError) {
+		contract, serr = gw.GetContract(id)
+		return serr
+	})
+	return
+}
+
+// GetContractIDByNameRegistration implements pkg.SubstrateGateway
+func (p *Pool) GetContractIDByNameRegistration(name string) (id uint64, serr pkg.SubstrateError) {
+	serr = p.readSubstrateError("GetContractIDByNameRegistration", func(gw pkg.SubstrateGateway) (serr pkg.SubstrateError) {
+		id, serr = gw.GetContractIDByNameRegistration(name)
+		return serr
+	})
+	return
+}
+
+// GetFarm implements pkg.SubstrateGateway
+func (p *Pool) GetFarm(id uint32) (farm substrate.Farm, err error) {
+	err = p.read("GetFarm", func(gw pkg.SubstrateGateway) (err error) {
+		farm, err = gw.GetFarm(id)
+		return err
+	})
+	return
+}
+
+// GetNode implements pkg.SubstrateGateway
+func (p *Pool) GetNode(id uint32) (node substrate.Node, err error) {
+	err = p.read("GetNode", func(gw pkg.SubstrateGateway) (err error) {
+		node, err = gw.GetNode(id)
+		return err
+	})
+	return
+}
+
+// GetNodeByTwinID implements pkg.SubstrateGateway
+func (p *Pool) GetNodeByTwinID(twin uint32) (id uint32, serr pkg.SubstrateError) {
+	serr = p.readSubstrateError("GetNodeByTwinID", func(gw pkg.SubstrateGateway) (serr pkg.SubstrateError) {
+		id, serr = gw.GetNodeByTwinID(twin)
+		return serr
+	})
+	return
+}
+
+// GetNodeContracts implements pkg.SubstrateGateway
+func (p *Pool) GetNodeContracts(node uint32) (contracts []types.U64, err error) {
+	err = p.read("GetNodeContracts", func(gw pkg.SubstrateGateway) (err error) {
+		contracts, err = gw.GetNodeContracts(node)
+		return err
+	})
+	return
+}
+
+// GetNodeRentContract implements pkg.SubstrateGateway
+func (p *Pool) GetNodeRentContract(node uint32) (id uint64, serr pkg.SubstrateError) {
+	serr = p.readSubstrateError("GetNodeRentContract", func(gw pkg.SubstrateGateway) (serr pkg.SubstrateError) {
+		id, serr = gw.GetNodeRentContract(node)
+		return serr
+	})
+	return
+}
+
+// GetNodes implements pkg.SubstrateGateway
+func (p *Pool) GetNodes(farmID uint32) (nodes []uint32, err error) {
+	err = p.read("GetNodes", func(gw pkg.SubstrateGateway) (err error) {
+		nodes, err = gw.GetNodes(farmID)
+		return err
+	})
+	return
+}
+
+// GetPowerTarget implements pkg.SubstrateGateway
+func (p *Pool) GetPowerTarget() (power substrate.NodePower, err error) {
+	err = p.read("GetPowerTarget", func(gw pkg.SubstrateGateway) (err error) {
+		power, err = gw.GetPowerTarget()
+		return err
+	})
+	return
+}
+
+// GetTwin implements pkg.SubstrateGateway
+func (p *Pool) GetTwin(id uint32) (twin substrate.Twin, err error) {
+	err = p.read("GetTwin", func(gw pkg.SubstrateGateway) (err error) {
+		twin, err = gw.GetTwin(id)
+		return err
+	})
+	return
+}
+
+// GetTwinByPubKey implements pkg.SubstrateGateway
+func (p *Pool) GetTwinByPubKey(pk []byte) (id uint32, serr pkg.SubstrateError) {
+	serr = p.readSubstrateError("GetTwinByPubKey", func(gw pkg.SubstrateGateway) (serr pkg.SubstrateError) {
+		id, serr = gw.GetTwinByPubKey(pk)
+		return serr
+	})
+	return
+}
+
+// Report implements pkg.SubstrateGateway
+func (p *Pool) Report(consumptions []substrate.NruConsumption) (hash types.Hash, err error) {
+	err = p.write("Report", func(gw pkg.SubstrateGateway) (err error) {
+		hash, err = gw.Report(consumptions)
+		return err
+	})
+	return
+}
+
+// SetContractConsumption implements pkg.SubstrateGateway
+func (p *Pool) SetContractConsumption(resources ...substrate.ContractResources) error {
+	return p.write("SetContractConsumption", func(gw pkg.SubstrateGateway) error {
+		return gw.SetContractConsumption(resources...)
+	})
+}
+
+// SetNodePowerState implements pkg.SubstrateGateway
+func (p *Pool) SetNodePowerState(up bool) (hash types.Hash, err error) {
+	err = p.write("SetNodePowerState", func(gw pkg.SubstrateGateway) (err error) {
+		hash, err = gw.SetNodePowerState(up)
+		return err
+	})
+	return
+}
+
+// UpdateNode implements pkg.SubstrateGateway
+func (p *Pool) UpdateNode(node substrate.Node) (id uint32, err error) {
+	err = p.write("UpdateNode", func(gw pkg.SubstrateGateway) (err error) {
+		id, err = gw.UpdateNode(node)
+		return err
+	})
+	return
+}
+
+// UpdateNodeUptimeV2 implements pkg.SubstrateGateway
+func (p *Pool) UpdateNodeUptimeV2(uptime uint64, timestampHint uint64) (hash types.Hash, err error) {
+	err = p.write("UpdateNodeUptimeV2", func(gw pkg.SubstrateGateway) (err error) {
+		hash, err = gw.UpdateNodeUptimeV2(uptime, timestampHint)
+		return err
+	})
+	return
+}
+
+// GetTime implements pkg.SubstrateGateway
+func (p *Pool) GetTime() (t time.Time, err error) {
+	err = p.read("GetTime", func(gw pkg.SubstrateGateway) (err error) {
+		t, err = gw.GetTime()
+		return err
+	})
+	return
+}
+
+// GetZosVersion implements pkg.SubstrateGateway
+func (p *Pool) GetZosVersion() (version string, err error) {
+	err = p.read("GetZosVersion", func(gw pkg.SubstrateGateway) (err error) {
+		version, err = gw.GetZosVersion()
+		return err
+	})
+	return
+}
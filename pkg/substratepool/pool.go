@@ -0,0 +1,264 @@
+package substratepool
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	zos "github.com/threefoldtech/zos/pkg"
+	"github.com/threefoldtech/zosbase/pkg"
+)
+
+// probeInterval is how often all endpoints are probed
+const probeInterval = 30 * time.Second
+
+var (
+	_ pkg.SubstrateGateway = (*Pool)(nil)
+	_ zos.SubstrateHealth  = (*Pool)(nil)
+	_ zos.ChainReader      = (*Pool)(nil)
+)
+
+// Pool is a substrate gateway over multiple substrate endpoints. It keeps track
+// of the health of each endpoint and routes calls to the healthiest one. Read
+// calls fail over to the next endpoint on error, while write calls are never
+// retried on another endpoint to avoid submitting the same extrinsic twice.
+type Pool struct {
+	identity substrate.Identity
+
+	m         sync.RWMutex
+	endpoints []*endpoint
+}
+
+// New creates a new substrate pool over urls
+func New(identity substrate.Identity, urls ...string) *Pool {
+	p := &Pool{identity: identity}
+	p.Update(urls)
+	return p
+}
+
+// Update sets the pool endpoints. The health of endpoints that are
+// still in urls is kept
+func (p *Pool) Update(urls []string) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	current := make(map[string]*endpoint)
+	for _, e := range p.endpoints {
+		current[e.url] = e
+	}
+
+	endpoints := make([]*endpoint, 0, len(urls))
+	for _, url := range urls {
+		if e, ok := current[url]; ok {
+			endpoints = append(endpoints, e)
+			delete(current, url)
+			continue
+		}
+
+		endpoints = append(endpoints, newEndpoint(url, p.identity))
+	}
+
+	for _, e := range current {
+		e.close()
+	}
+
+	p.endpoints = endpoints
+}
+
+// Run probes the endpoints periodically until context is cancelled
+func (p *Pool) Run(ctx context.Context) {
+	for {
+		p.m.RLock()
+		endpoints := p.endpoints
+		p.m.RUnlock()
+
+		var wg sync.WaitGroup
+		for _, e := range endpoints {
+			wg.Add(1)
+			go func(e *endpoint) {
+				defer wg.Done()
+				e.probe()
+			}(e)
+		}
+		wg.Wait()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(probeInterval):
+		}
+	}
+}
+
+// Endpoints implements zos.SubstrateHealth
+func (p *Pool) Endpoints() []zos.SubstrateEndpoint {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	var best uint32
+	for _, e := range p.endpoints {
+		e.m.Lock()
+		best = max(best, e.height)
+		e.m.Unlock()
+	}
+
+	result := make([]zos.SubstrateEndpoint, 0, len(p.endpoints))
+	for _, e := range p.endpoints {
+		result = append(result, e.status(best))
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Score > result[j].Score
+	})
+
+	return result
+}
+
+// ranked returns the endpoints sorted by score, healthiest first
+func (p *Pool) ranked() []*endpoint {
+	statuses := p.Endpoints()
+
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	index := make(map[string]*endpoint, len(p.endpoints))
+	for _, e := range p.endpoints {
+		index[e.url] = e
+	}
+
+	endpoints := make([]*endpoint, 0, len(statuses))
+	for _, status := range statuses {
+		if e, ok := index[status.URL]; ok {
+			endpoints = append(endpoints, e)
+		}
+	}
+
+	return endpoints
+}
+
+// call runs fn against the healthiest endpoint. If failover is true, fn is
+// retried on the next endpoint as long as it fails with an endpoint error.
+func (p *Pool) call(method string, failover bool, fn func(gw pkg.SubstrateGateway) error) error {
+	endpoints := p.ranked()
+	if len(endpoints) == 0 {
+		return fmt.Errorf("no substrate endpoints configured")
+	}
+
+	var err error
+	for _, e := range endpoints {
+		var gw pkg.SubstrateGateway
+		start := time.Now()
+		gw, err = e.gateway()
+		if err == nil {
+			err = fn(gw)
+		}
+
+		if !isEndpointError(err) {
+			e.record(time.Since(start), nil)
+			return err
+		}
+
+		e.record(time.Since(start), err)
+		if !failover {
+			return err
+		}
+
+		log.Warn().Err(err).Str("url", e.url).Str("method", method).Msg("substrate call failed, trying next endpoint")
+	}
+
+	return err
+}
+
+// read runs a read call with failover
+func (p *Pool) read(method string, fn func(gw pkg.SubstrateGateway) error) error {
+	return p.call(method, true, fn)
+}
+
+// write runs a write call on the healthiest endpoint only
+func (p *Pool) write(method string, fn func(gw pkg.SubstrateGateway) error) error {
+	return p.call(method, false, fn)
+}
+
+// follow runs fn against the endpoints in rank order until one of them
+// answers. It's used by the calls that read the chain directly, they never
+// submit anything so they are safe to fail over
+func (p *Pool) follow(method string, fn func(e *endpoint) error) error {
+	endpoints := p.ranked()
+	if len(endpoints) == 0 {
+		return fmt.Errorf("no substrate endpoints configured")
+	}
+
+	var err error
+	for _, e := range endpoints {
+		start := time.Now()
+		err = fn(e)
+		if !isEndpointError(err) {
+			e.record(time.Since(start), nil)
+			return err
+		}
+
+		e.record(time.Since(start), err)
+		log.Warn().Err(err).Str("url", e.url).Str("method", method).Msg("substrate call failed, trying next endpoint")
+	}
+
+	return err
+}
+
+// Nonce returns the account nonce of the pool identity
+func (p *Pool) Nonce() (nonce uint64, err error) {
+	err = p.follow("Nonce", func(e *endpoint) error {
+		nonce, err = e.accountNonce()
+		return err
+	})
+	return
+}
+
+// Height returns the current block height
+func (p *Pool) Height() (height uint32, err error) {
+	err = p.follow("Height", func(e *endpoint) error {
+		height, err = e.currentHeight()
+		return err
+	})
+	return
+}
+
+// Included implements Account
+func (p *Pool) Included(call string, nonce uint64, from uint32) (inclusion Inclusion, err error) {
+	err = p.follow("Included", func(e *endpoint) error {
+		inclusion, err = e.included(call, nonce, from)
+		return err
+	})
+	return
+}
+
+// GetNodePowerTarget implements zos.ChainReader
+func (p *Pool) GetNodePowerTarget(node uint32) (power substrate.NodePower, err error) {
+	err = p.follow("GetNodePowerTarget", func(e *endpoint) error {
+		power, err = e.powerTarget(node)
+		return err
+	})
+	return
+}
+
+// readSubstrateError is like read for calls that return a pkg.SubstrateError
+func (p *Pool) readSubstrateError(method string, fn func(gw pkg.SubstrateGateway) pkg.SubstrateError) pkg.SubstrateError {
+	var serr pkg.SubstrateError
+	err := p.read(method, func(gw pkg.SubstrateGateway) error {
+		serr = fn(gw)
+		if serr.IsError() {
+			return serr.Err
+		}
+		return nil
+	})
+
+	if err != nil && err != serr.Err {
+		// failed before the call was made
+		return pkg.SubstrateError{Err: err, Code: pkg.CodeGenericError}
+	}
+
+	return serr
+}
@@ -0,0 +1,758 @@
+package substratepool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	zos "github.com/threefoldtech/zos/pkg"
+	"github.com/threefoldtech/zosbase/pkg"
+)
+
+const (
+	// syncTimeout is how long an extrinsic submitted with a blocking call
+	// can wait in the queue before it's dropped
+	syncTimeout = 5 * time.Minute
+	// waitTimeout is how long a blocking call waits for its extrinsic. The
+	// extrinsic stays queued until its deadline after that, the call returns
+	// so blocked writes don't hold the gateway workers that serve reads
+	waitTimeout = time.Minute
+	// keepFinished is how long the status of a finished extrinsic is kept
+	keepFinished = time.Hour
+	// maxRejected is how many times an extrinsic is submitted while the chain
+	// is reachable before it's failed. Consumption reports are never failed,
+	// they are submitted again every rejectedDelay so no billing data is lost
+	maxRejected = 5
+	// rejectedDelay is the delay between two submissions of a consumption
+	// report that was rejected more than maxRejected times
+	rejectedDelay = 30 * time.Minute
+	// retryMax is the max delay between two submissions of the same extrinsic
+	retryMax = 2 * time.Minute
+	// lagWait is how long to wait for the chain to catch up with the local nonce,
+	// it's about one block
+	lagWait = 6 * time.Second
+	// lagRetries is how many times to wait for the chain to catch up before
+	// the local nonce is reset to the chain nonce
+	lagRetries = 5
+	// inclusionWindow is how many blocks after a submission are searched for
+	// the extrinsic when its result was lost
+	inclusionWindow = 600
+)
+
+const (
+	callReport              = "report"
+	callContractConsumption = "contract-consumption"
+	callUptime              = "uptime"
+	callPowerState          = "power-state"
+)
+
+var (
+	_ pkg.SubstrateGateway = (*Queue)(nil)
+	_ zos.ExtrinsicQueue   = (*Queue)(nil)
+	_ Account              = (*Pool)(nil)
+
+	// classes in submission order
+	classes = []zos.ExtrinsicClass{zos.ExtrinsicOperational, zos.ExtrinsicNormal, zos.ExtrinsicBulk}
+
+	// extrinsics maps queued calls to the chain calls they submit
+	extrinsics = map[string]string{
+		callReport:              "SmartContractModule.add_nru_reports",
+		callContractConsumption: "SmartContractModule.report_contract_resources",
+		callUptime:              "TfgridModule.report_uptime_v2",
+		callPowerState:          "TfgridModule.change_power_state",
+	}
+
+	// ErrNotIncluded is returned by Account.Included if the extrinsic is
+	// not in the chain
+	ErrNotIncluded = fmt.Errorf("extrinsic not included")
+)
+
+// Inclusion is where a submitted extrinsic was found on chain
+type Inclusion struct {
+	// Block is the hash of the block that includes the extrinsic
+	Block types.Hash
+	// Failed is set if the extrinsic was dispatched with an error
+	Failed bool
+}
+
+// Account follows the account of the gateway identity on chain
+type Account interface {
+	// Nonce returns the current account nonce
+	Nonce() (uint64, error)
+	// Height returns the current block height
+	Height() (uint32, error)
+	// Included looks for the extrinsic call signed by the account with nonce
+	// in the blocks after from, it returns ErrNotIncluded if the nonce was
+	// used by another extrinsic or the extrinsic can't be found
+	Included(call string, nonce uint64, from uint32) (Inclusion, error)
+}
+
+// job is a queued extrinsic as persisted on disk
+type job struct {
+	Ticket uint64             `json:"ticket"`
+	Call   string             `json:"call"`
+	Class  zos.ExtrinsicClass `json:"class"`
+	Queued time.Time          `json:"queued"`
+	// Deadline is set for extrinsics submitted with a blocking call, the
+	// extrinsic is dropped if it can't be submitted before the deadline
+	Deadline time.Time `json:"deadline"`
+
+	// Submitted is set once the extrinsic was sent to the chain with Nonce
+	// at Height, until it's known whether it was included
+	Submitted bool   `json:"submitted"`
+	Nonce     uint64 `json:"nonce"`
+	Height    uint32 `json:"height"`
+	Attempts  uint   `json:"attempts"`
+	// Rejected is how many submissions failed while the chain was reachable
+	Rejected  uint   `json:"rejected"`
+	LastError string `json:"last_error"`
+
+	Consumptions  []substrate.NruConsumption    `json:"consumptions,omitempty"`
+	Resources     []substrate.ContractResources `json:"resources,omitempty"`
+	Uptime        uint64                        `json:"uptime,omitempty"`
+	TimestampHint uint64                        `json:"timestamp_hint,omitempty"`
+	Up            bool                          `json:"up,omitempty"`
+}
+
+type ticket struct {
+	job     job
+	state   zos.ExtrinsicState
+	hash    types.Hash
+	updated time.Time
+	// retry is when a rejected extrinsic can be submitted again
+	retry time.Time
+	done  chan struct{}
+}
+
+func (t *ticket) status() zos.ExtrinsicStatus {
+	status := zos.ExtrinsicStatus{
+		Ticket:   t.job.Ticket,
+		Call:     t.job.Call,
+		Class:    t.job.Class,
+		State:    t.state,
+		Nonce:    t.job.Nonce,
+		Attempts: t.job.Attempts,
+		Error:    t.job.LastError,
+		Queued:   t.job.Queued,
+		Updated:  t.updated,
+	}
+
+	if t.state == zos.ExtrinsicDone {
+		status.Hash = t.hash.Hex()
+	}
+
+	return status
+}
+
+// Queue is the outbound extrinsic queue of the node. Extrinsics are persisted
+// and submitted one at a time through the gateway, by class and then in the
+// order they were queued.
+//
+// The queue keeps track of the account nonce locally. The chain client signs
+// each extrinsic with the account nonce it reads from the chain, so before each
+// submission the queue waits until the chain nonce catches up with the local
+// one. If the result of a submission is lost and the nonce moved, the blocks
+// after the submission are searched for the extrinsic to find out if it was
+// included, in which case it's not submitted again.
+//
+// Classes only set the local submission order, extrinsics are always signed
+// without a tip so they don't change the fee or the priority in the chain pool.
+//
+// Write calls of the gateway go through the queue too, so they are never
+// submitted at the same time as a queued extrinsic.
+type Queue struct {
+	pkg.SubstrateGateway
+
+	root    string
+	account Account
+
+	// submit serializes all calls that sign with the node identity
+	submit sync.Mutex
+	// expected is the nonce of the next extrinsic, only valid if synced
+	expected uint64
+	synced   bool
+
+	m       sync.Mutex
+	next    uint64
+	tickets map[uint64]*ticket
+	notify  chan struct{}
+}
+
+// NewQueue creates a new extrinsic queue over gw persisted under root. account
+// must follow the account of the gateway identity
+func NewQueue(root string, gw pkg.SubstrateGateway, account Account) (*Queue, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, errors.Wrap(err, "failed to create extrinsic queue directory")
+	}
+
+	q := &Queue{
+		SubstrateGateway: gw,
+		root:             root,
+		account:          account,
+		next:             uint64(time.Now().UnixNano()),
+		tickets:          make(map[uint64]*ticket),
+		notify:           make(chan struct{}, 1),
+	}
+
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+func (q *Queue) load() error {
+	files, err := filepath.Glob(filepath.Join(q.root, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read queued extrinsic '%s'", file)
+		}
+
+		var j job
+		if err := json.Unmarshal(data, &j); err != nil {
+			log.Error().Err(err).Str("file", file).Msg("dropping corrupted queued extrinsic")
+			_ = os.Remove(file)
+			continue
+		}
+
+		q.tickets[j.Ticket] = &ticket{
+			job:     j,
+			state:   zos.ExtrinsicQueued,
+			updated: j.Queued,
+			done:    make(chan struct{}),
+		}
+
+		if j.Ticket >= q.next {
+			q.next = j.Ticket + 1
+		}
+	}
+
+	log.Info().Int("count", len(q.tickets)).Msg("loaded queued extrinsics")
+	return nil
+}
+
+func (q *Queue) path(id uint64) string {
+	return filepath.Join(q.root, fmt.Sprintf("%d.json", id))
+}
+
+// persist writes the job to disk, must be called with q.m held
+func (q *Queue) persist(j *job) error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+
+	path := q.path(j.Ticket)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func (q *Queue) enqueue(j job) (*ticket, error) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	j.Ticket = q.next
+	j.Queued = time.Now()
+	if err := q.persist(&j); err != nil {
+		return nil, errors.Wrap(err, "failed to persist extrinsic")
+	}
+
+	q.next++
+	t := &ticket{
+		job:     j,
+		state:   zos.ExtrinsicQueued,
+		updated: j.Queued,
+		done:    make(chan struct{}),
+	}
+	q.tickets[j.Ticket] = t
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+
+	log.Debug().Uint64("ticket", j.Ticket).Str("call", j.Call).Str("class", string(j.Class)).Msg("extrinsic queued")
+	return t, nil
+}
+
+// head returns the next queued extrinsic to submit. If none is due it returns
+// how long to wait for the next one, or zero if the queue is empty
+func (q *Queue) head() (*ticket, time.Duration) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	pending := q.pending()
+	// an extrinsic that may still be in the chain pool goes first, any
+	// other extrinsic would be signed with the same nonce
+	for _, t := range pending {
+		if t.job.Submitted {
+			return t, 0
+		}
+	}
+
+	var wait time.Duration
+	now := time.Now()
+	for _, t := range pending {
+		if due := t.retry.Sub(now); due > 0 {
+			if wait == 0 || due < wait {
+				wait = due
+			}
+			continue
+		}
+
+		return t, 0
+	}
+
+	return nil, wait
+}
+
+// park delays the next submission of t
+func (q *Queue) park(t *ticket, delay time.Duration) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	t.retry = time.Now().Add(delay)
+}
+
+// pending returns the queued tickets in submission order, must be called
+// with q.m held
+func (q *Queue) pending() []*ticket {
+	var pending []*ticket
+	for _, t := range q.tickets {
+		if t.state == zos.ExtrinsicQueued {
+			pending = append(pending, t)
+		}
+	}
+
+	rank := func(class zos.ExtrinsicClass) int {
+		for i, c := range classes {
+			if c == class {
+				return i
+			}
+		}
+		return len(classes)
+	}
+
+	sort.Slice(pending, func(i, j int) bool {
+		a, b := pending[i].job, pending[j].job
+		if rank(a.Class) != rank(b.Class) {
+			return rank(a.Class) < rank(b.Class)
+		}
+		return a.Ticket < b.Ticket
+	})
+
+	return pending
+}
+
+// update applies fn to the job of t and persists it
+func (q *Queue) update(t *ticket, fn func(j *job)) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	fn(&t.job)
+	t.updated = time.Now()
+	if err := q.persist(&t.job); err != nil {
+		log.Error().Err(err).Uint64("ticket", t.job.Ticket).Msg("failed to persist extrinsic")
+	}
+}
+
+// finish marks t as done, or failed if err is not nil
+func (q *Queue) finish(t *ticket, hash types.Hash, err error) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	t.state = zos.ExtrinsicDone
+	t.hash = hash
+	if err != nil {
+		t.state = zos.ExtrinsicFailed
+		t.job.LastError = err.Error()
+	}
+	t.updated = time.Now()
+	close(t.done)
+
+	if err := os.Remove(q.path(t.job.Ticket)); err != nil && !os.IsNotExist(err) {
+		log.Error().Err(err).Uint64("ticket", t.job.Ticket).Msg("failed to remove finished extrinsic")
+	}
+
+	log.Info().
+		Uint64("ticket", t.job.Ticket).
+		Str("call", t.job.Call).
+		Str("state", string(t.state)).
+		Uint64("nonce", t.job.Nonce).
+		Str("error", t.job.LastError).
+		Msg("extrinsic finished")
+
+	for id, t := range q.tickets {
+		if t.state != zos.ExtrinsicQueued && time.Since(t.updated) > keepFinished {
+			delete(q.tickets, id)
+		}
+	}
+}
+
+// Run submits the queued extrinsics until context is cancelled
+func (q *Queue) Run(ctx context.Context) {
+	for {
+		t, wait := q.head()
+		if t == nil {
+			var due <-chan time.Time
+			if wait > 0 {
+				due = time.After(wait)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-q.notify:
+			case <-due:
+			}
+			continue
+		}
+
+		// an extrinsic that may be included never expires
+		if !t.job.Submitted && !t.job.Deadline.IsZero() && time.Now().After(t.job.Deadline) {
+			q.finish(t, types.Hash{}, fmt.Errorf("extrinsic expired before it could be submitted"))
+			continue
+		}
+
+		hash, retry, err := q.process(t)
+		if err == nil || !retry {
+			q.finish(t, hash, err)
+			continue
+		}
+
+		delay := min(time.Duration(t.job.Attempts)*10*time.Second, retryMax)
+		if t.job.Rejected >= maxRejected {
+			delay = rejectedDelay
+		}
+		log.Error().Err(err).Uint64("ticket", t.job.Ticket).Dur("retry-in", delay).Msg("failed to submit extrinsic")
+
+		if !t.job.Submitted {
+			// the extrinsic is not in the chain, the next ones can go first
+			q.park(t, delay)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// process submits the extrinsic of t. retry is set if the extrinsic was not
+// included in a block and can be submitted again
+func (q *Queue) process(t *ticket) (hash types.Hash, retry bool, err error) {
+	q.submit.Lock()
+	defer q.submit.Unlock()
+
+	nonce, err := q.sync()
+	if err != nil {
+		return hash, true, errors.Wrap(err, "failed to get account nonce")
+	}
+
+	if t.job.Submitted && nonce > t.job.Nonce {
+		// the nonce of the last submission was used but the result was
+		// lost (restart or unreachable chain)
+		inclusion, found, err := q.confirm(t)
+		if err != nil {
+			return hash, true, errors.Wrap(err, "failed to find out if extrinsic was included")
+		}
+
+		if found {
+			return inclusion.Block, false, inclusion.err()
+		}
+	}
+
+	height, err := q.account.Height()
+	if err != nil {
+		return hash, true, errors.Wrap(err, "failed to get block height")
+	}
+
+	q.update(t, func(j *job) {
+		j.Submitted = true
+		j.Nonce = nonce
+		j.Height = height
+		j.Attempts++
+	})
+
+	hash, err = q.call(&t.job)
+	if err == nil {
+		q.expected = nonce + 1
+		return hash, false, nil
+	}
+
+	// find out if the extrinsic was included
+	q.synced = false
+	current, nerr := q.account.Nonce()
+	if nerr == nil && current > nonce {
+		var inclusion Inclusion
+		var found bool
+		inclusion, found, nerr = q.confirm(t)
+		if nerr == nil && found {
+			q.expected, q.synced = current, true
+			if !inclusion.Failed {
+				// the call failed after the extrinsic made it into a block
+				err = nil
+			}
+			return inclusion.Block, false, err
+		}
+	}
+
+	if nerr != nil {
+		// chain is not reachable, this is checked again before the
+		// next submission
+		q.update(t, func(j *job) { j.LastError = err.Error() })
+		return hash, true, err
+	}
+
+	q.update(t, func(j *job) {
+		j.Submitted = false
+		j.Rejected++
+		j.LastError = err.Error()
+	})
+
+	return hash, t.job.Rejected < maxRejected || isConsumption(t.job.Call), err
+}
+
+// confirm searches the chain for the last submission of t, found is set if
+// it was included. If another extrinsic used its nonce, t is marked as not
+// submitted.
+func (q *Queue) confirm(t *ticket) (inclusion Inclusion, found bool, err error) {
+	inclusion, err = q.account.Included(extrinsics[t.job.Call], t.job.Nonce, t.job.Height)
+	if errors.Is(err, ErrNotIncluded) {
+		q.update(t, func(j *job) { j.Submitted = false })
+		return inclusion, false, nil
+	} else if err != nil {
+		return inclusion, false, err
+	}
+
+	log.Info().Uint64("ticket", t.job.Ticket).Str("block", inclusion.Block.Hex()).Msg("found extrinsic on chain")
+	return inclusion, true, nil
+}
+
+// err returns an error if the extrinsic failed
+func (i Inclusion) err() error {
+	if !i.Failed {
+		return nil
+	}
+
+	return fmt.Errorf("extrinsic failed in block %s", i.Block.Hex())
+}
+
+// isConsumption checks if call reports consumption, these are billed so
+// they are never dropped
+func isConsumption(call string) bool {
+	return call == callReport || call == callContractConsumption
+}
+
+// sync returns the nonce of the next extrinsic. If the chain nonce is behind
+// the local one, the chain didn't see the last extrinsic yet so it waits for
+// it to catch up.
+func (q *Queue) sync() (uint64, error) {
+	for i := 0; ; i++ {
+		chain, err := q.account.Nonce()
+		if err != nil {
+			return 0, err
+		}
+
+		if q.synced && chain < q.expected && i < lagRetries {
+			log.Debug().Uint64("chain", chain).Uint64("local", q.expected).Msg("waiting for chain nonce to catch up")
+			time.Sleep(lagWait)
+			continue
+		}
+
+		if q.synced && chain != q.expected {
+			log.Warn().Uint64("chain", chain).Uint64("local", q.expected).Msg("account nonce out of sync, using chain nonce")
+		}
+
+		q.expected, q.synced = chain, true
+		return chain, nil
+	}
+}
+
+func (q *Queue) call(j *job) (hash types.Hash, err error) {
+	switch j.Call {
+	case callReport:
+		return q.SubstrateGateway.Report(j.Consumptions)
+	case callContractConsumption:
+		return hash, q.SubstrateGateway.SetContractConsumption(j.Resources...)
+	case callUptime:
+		return q.SubstrateGateway.UpdateNodeUptimeV2(j.Uptime, j.TimestampHint)
+	case callPowerState:
+		return q.SubstrateGateway.SetNodePowerState(j.Up)
+	default:
+		return hash, fmt.Errorf("unknown extrinsic call '%s'", j.Call)
+	}
+}
+
+// direct runs a write call that is not queued, it's still serialized
+// with the queued extrinsics
+func (q *Queue) direct(fn func() error) error {
+	q.submit.Lock()
+	defer q.submit.Unlock()
+
+	// the call may or may not use a nonce
+	q.synced = false
+	return fn()
+}
+
+// wait blocks until t is finished or the timeout is reached
+func (q *Queue) wait(t *ticket, timeout time.Duration) (types.Hash, error) {
+	select {
+	case <-t.done:
+	case <-time.After(timeout):
+		return types.Hash{}, fmt.Errorf("extrinsic %d is still pending after %s", t.job.Ticket, timeout)
+	}
+
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	if t.state == zos.ExtrinsicFailed {
+		return t.hash, fmt.Errorf("extrinsic %d failed: %s", t.job.Ticket, t.job.LastError)
+	}
+
+	return t.hash, nil
+}
+
+// submitAndWait queues j and waits for it to finish, or for waitTimeout
+func (q *Queue) submitAndWait(j job) (types.Hash, error) {
+	j.Deadline = time.Now().Add(syncTimeout)
+	t, err := q.enqueue(j)
+	if err != nil {
+		return types.Hash{}, err
+	}
+
+	return q.wait(t, waitTimeout)
+}
+
+func (q *Queue) submitTicket(j job) (uint64, error) {
+	t, err := q.enqueue(j)
+	if err != nil {
+		return 0, err
+	}
+
+	return t.job.Ticket, nil
+}
+
+// SubmitReport implements zos.ExtrinsicQueue
+func (q *Queue) SubmitReport(consumptions []substrate.NruConsumption) (uint64, error) {
+	return q.submitTicket(job{Call: callReport, Class: zos.ExtrinsicBulk, Consumptions: consumptions})
+}
+
+// SubmitContractConsumption implements zos.ExtrinsicQueue
+func (q *Queue) SubmitContractConsumption(resources []substrate.ContractResources) (uint64, error) {
+	return q.submitTicket(job{Call: callContractConsumption, Class: zos.ExtrinsicNormal, Resources: resources})
+}
+
+// SubmitUptime implements zos.ExtrinsicQueue
+func (q *Queue) SubmitUptime(uptime uint64, timestampHint uint64) (uint64, error) {
+	return q.submitTicket(job{Call: callUptime, Class: zos.ExtrinsicOperational, Uptime: uptime, TimestampHint: timestampHint})
+}
+
+// SubmitPowerState implements zos.ExtrinsicQueue
+func (q *Queue) SubmitPowerState(up bool) (uint64, error) {
+	return q.submitTicket(job{Call: callPowerState, Class: zos.ExtrinsicOperational, Up: up})
+}
+
+// Status implements zos.ExtrinsicQueue
+func (q *Queue) Status(id uint64) (zos.ExtrinsicStatus, error) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	t, ok := q.tickets[id]
+	if !ok {
+		return zos.ExtrinsicStatus{}, fmt.Errorf("unknown extrinsic ticket %d", id)
+	}
+
+	return t.status(), nil
+}
+
+// Pending implements zos.ExtrinsicQueue
+func (q *Queue) Pending() []zos.ExtrinsicStatus {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	pending := q.pending()
+	result := make([]zos.ExtrinsicStatus, 0, len(pending))
+	for _, t := range pending {
+		result = append(result, t.status())
+	}
+
+	return result
+}
+
+// Report implements pkg.SubstrateGateway
+func (q *Queue) Report(consumptions []substrate.NruConsumption) (types.Hash, error) {
+	return q.submitAndWait(job{Call: callReport, Class: zos.ExtrinsicBulk, Consumptions: consumptions})
+}
+
+// SetContractConsumption implements pkg.SubstrateGateway
+func (q *Queue) SetContractConsumption(resources ...substrate.ContractResources) error {
+	_, err := q.submitAndWait(job{Call: callContractConsumption, Class: zos.ExtrinsicNormal, Resources: resources})
+	return err
+}
+
+// UpdateNodeUptimeV2 implements pkg.SubstrateGateway
+func (q *Queue) UpdateNodeUptimeV2(uptime uint64, timestampHint uint64) (types.Hash, error) {
+	return q.submitAndWait(job{Call: callUptime, Class: zos.ExtrinsicOperational, Uptime: uptime, TimestampHint: timestampHint})
+}
+
+// SetNodePowerState implements pkg.SubstrateGateway
+func (q *Queue) SetNodePowerState(up bool) (types.Hash, error) {
+	return q.submitAndWait(job{Call: callPowerState, Class: zos.ExtrinsicOperational, Up: up})
+}
+
+// CreateNode implements pkg.SubstrateGateway
+func (q *Queue) CreateNode(node substrate.Node) (id uint32, err error) {
+	err = q.direct(func() error {
+		id, err = q.SubstrateGateway.CreateNode(node)
+		return err
+	})
+	return
+}
+
+// UpdateNode implements pkg.SubstrateGateway
+func (q *Queue) UpdateNode(node substrate.Node) (id uint32, err error) {
+	err = q.direct(func() error {
+		id, err = q.SubstrateGateway.UpdateNode(node)
+		return err
+	})
+	return
+}
+
+// CreateTwin implements pkg.SubstrateGateway
+func (q *Queue) CreateTwin(relay string, pk []byte) (id uint32, err error) {
+	err = q.direct(func() error {
+		id, err = q.SubstrateGateway.CreateTwin(relay, pk)
+		return err
+	})
+	return
+}
+
+// EnsureAccount implements pkg.SubstrateGateway
+func (q *Queue) EnsureAccount(activationURL []string, termsAndConditionsLink string, termsAndConditionsHash string) (info substrate.AccountInfo, err error) {
+	err = q.direct(func() error {
+		info, err = q.SubstrateGateway.EnsureAccount(activationURL, termsAndConditionsLink, termsAndConditionsHash)
+		return err
+	})
+	return
+}
@@ -0,0 +1,279 @@
+package substratepool
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	zos "github.com/threefoldtech/zos/pkg"
+	"github.com/threefoldtech/zosbase/pkg"
+)
+
+// testChain is a fake gateway that only accepts reports and power states
+type testChain struct {
+	pkg.SubstrateGateway
+
+	m     sync.Mutex
+	nonce uint64
+	// reject makes the chain include reports but fail them
+	reject bool
+	// refuse makes the chain refuse extrinsics without including them
+	refuse bool
+	calls  []uint64
+	// included are the calls included in the chain by nonce
+	included map[uint64]Inclusion
+	names    map[uint64]string
+}
+
+func (c *testChain) Nonce() (uint64, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.nonce, nil
+}
+
+func (c *testChain) Height() (uint32, error) {
+	return 1, nil
+}
+
+func (c *testChain) Included(call string, nonce uint64, from uint32) (Inclusion, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	inclusion, ok := c.included[nonce]
+	if !ok || c.names[nonce] != call {
+		return Inclusion{}, ErrNotIncluded
+	}
+
+	return inclusion, nil
+}
+
+// include adds call to a block with the next nonce, must be called with c.m held
+func (c *testChain) include(call string, failed bool) types.Hash {
+	if c.included == nil {
+		c.included = make(map[uint64]Inclusion)
+		c.names = make(map[uint64]string)
+	}
+
+	hash := types.Hash{byte(c.nonce)}
+	c.included[c.nonce] = Inclusion{Block: hash, Failed: failed}
+	c.names[c.nonce] = call
+	c.nonce++
+	return hash
+}
+
+func (c *testChain) Report(consumptions []substrate.NruConsumption) (types.Hash, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.calls = append(c.calls, c.nonce)
+	if c.refuse {
+		return types.Hash{}, fmt.Errorf("refused")
+	}
+
+	hash := c.include(extrinsics[callReport], c.reject)
+	if c.reject {
+		return types.Hash{}, fmt.Errorf("rejected")
+	}
+	return hash, nil
+}
+
+func (c *testChain) SetNodePowerState(up bool) (types.Hash, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.calls = append(c.calls, c.nonce)
+	if c.refuse {
+		return types.Hash{}, fmt.Errorf("refused")
+	}
+
+	return c.include(extrinsics[callPowerState], false), nil
+}
+
+// wait waits for the extrinsic with ticket to finish
+func wait(t *testing.T, q *Queue, ticket uint64) zos.ExtrinsicStatus {
+	var status zos.ExtrinsicStatus
+	for i := 0; i < 100; i++ {
+		status, _ = q.Status(ticket)
+		if status.State != zos.ExtrinsicQueued {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return status
+}
+
+func TestQueueOrder(t *testing.T) {
+	chain := &testChain{}
+	q, err := NewQueue(t.TempDir(), chain, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, _ := q.SubmitReport(nil)
+	power, _ := q.SubmitPowerState(true)
+
+	pending := q.Pending()
+	if len(pending) != 2 || pending[0].Ticket != power || pending[1].Ticket != report {
+		t.Fatalf("operational extrinsic must be submitted first: %+v", pending)
+	}
+}
+
+func TestQueuePersisted(t *testing.T) {
+	root := t.TempDir()
+	chain := &testChain{}
+	q, err := NewQueue(root, chain, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ticket, err := q.SubmitReport([]substrate.NruConsumption{{ContractID: 10, NRU: 20}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q, err = NewQueue(root, chain, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := q.Status(ticket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status.State != zos.ExtrinsicQueued {
+		t.Fatalf("expected queued extrinsic, got %s", status.State)
+	}
+
+	next, _ := q.SubmitPowerState(true)
+	if next <= ticket {
+		t.Fatalf("ticket %d reused after restart", next)
+	}
+}
+
+func TestQueueRun(t *testing.T) {
+	chain := &testChain{nonce: 7}
+	q, err := NewQueue(t.TempDir(), chain, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx)
+
+	if _, err := q.SetNodePowerState(true); err != nil {
+		t.Fatal(err)
+	}
+
+	chain.m.Lock()
+	chain.reject = true
+	chain.m.Unlock()
+
+	// a rejected extrinsic is included so it must not be submitted again
+	ticket, _ := q.SubmitReport(nil)
+	status := wait(t, q, ticket)
+	if status.State != zos.ExtrinsicFailed || status.Attempts != 1 || status.Nonce != 8 {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+
+	chain.m.Lock()
+	defer chain.m.Unlock()
+	if len(chain.calls) != 2 || chain.calls[0] != 7 || chain.calls[1] != 8 {
+		t.Fatalf("unexpected submissions: %v", chain.calls)
+	}
+}
+
+func TestQueueNonceUsed(t *testing.T) {
+	chain := &testChain{nonce: 7}
+	q, err := NewQueue(t.TempDir(), chain, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ticket, _ := q.SubmitReport(nil)
+
+	// the report was submitted with nonce 7 but the result was lost, and
+	// the nonce was used by another extrinsic
+	q.update(q.tickets[ticket], func(j *job) {
+		j.Submitted = true
+		j.Nonce = 7
+	})
+	chain.m.Lock()
+	chain.include(extrinsics[callPowerState], false)
+	chain.m.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx)
+
+	status := wait(t, q, ticket)
+	if status.State != zos.ExtrinsicDone || status.Nonce != 8 {
+		t.Fatalf("report must be submitted again: %+v", status)
+	}
+
+	chain.m.Lock()
+	defer chain.m.Unlock()
+	if len(chain.calls) != 1 || chain.calls[0] != 8 {
+		t.Fatalf("unexpected submissions: %v", chain.calls)
+	}
+}
+
+func TestQueueRefused(t *testing.T) {
+	chain := &testChain{refuse: true}
+	q, err := NewQueue(t.TempDir(), chain, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, _ := q.SubmitReport(nil)
+	power, _ := q.SubmitPowerState(true)
+
+	for _, tc := range []struct {
+		ticket uint64
+		retry  bool
+	}{
+		{ticket: report, retry: true},
+		{ticket: power, retry: false},
+	} {
+		var retry bool
+		for i := 0; i < maxRejected; i++ {
+			_, retry, _ = q.process(q.tickets[tc.ticket])
+		}
+
+		if retry != tc.retry {
+			t.Errorf("ticket %d: expected retry %t after %d rejections", tc.ticket, tc.retry, maxRejected)
+		}
+
+		if q.tickets[tc.ticket].job.Submitted {
+			t.Errorf("ticket %d: refused extrinsic must not be marked as submitted", tc.ticket)
+		}
+	}
+}
+
+func TestQueueWaitTimeout(t *testing.T) {
+	chain := &testChain{}
+	q, err := NewQueue(t.TempDir(), chain, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the queue is not running so the extrinsic is never submitted
+	ticket, err := q.enqueue(job{Call: callPowerState, Class: zos.ExtrinsicOperational, Up: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := q.wait(ticket, 10*time.Millisecond); err == nil {
+		t.Fatal("expected wait to time out")
+	}
+
+	if status, _ := q.Status(ticket.job.Ticket); status.State != zos.ExtrinsicQueued {
+		t.Fatalf("extrinsic must stay queued after the wait timeout, got %s", status.State)
+	}
+}
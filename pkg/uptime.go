@@ -0,0 +1,42 @@
+package pkg
+
+import "time"
+
+//go:generate zbusc -module power -version 0.0.1 -name uptime -package stubs github.com/threefoldtech/zos/pkg+UptimeHistory stubs/uptime_history_stub.go
+
+// UptimeReport is an uptime report sent to the chain
+type UptimeReport struct {
+	// Sent is when the report was sent
+	Sent time.Time `json:"sent"`
+	// Uptime is the node uptime in seconds at the time of the report
+	Uptime uint64 `json:"uptime"`
+	Hash   string `json:"hash"`
+	// Samples is the number of uptime samples the report covers, it's more
+	// than one if the chain was not reachable for a while
+	Samples int `json:"samples"`
+	// First is when the oldest of the covered samples was taken
+	First time.Time `json:"first"`
+	// Lost is the number of samples of previous boots that couldn't be
+	// reported before the node rebooted
+	Lost int `json:"lost"`
+}
+
+// UptimePending are the uptime samples waiting to be reported
+type UptimePending struct {
+	Samples int `json:"samples"`
+	// Oldest is when the oldest sample was taken
+	Oldest time.Time `json:"oldest"`
+	// Error of the last report attempt
+	Error string `json:"error"`
+	// Ticket is the extrinsic queue ticket of the report waiting for
+	// inclusion, if any
+	Ticket uint64 `json:"ticket"`
+}
+
+// UptimeHistory interface
+type UptimeHistory interface {
+	// Reports returns the last uptime reports, most recent first
+	Reports() []UptimeReport
+	// Pending returns the samples that are not reported yet
+	Pending() UptimePending
+}
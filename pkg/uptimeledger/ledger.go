@@ -0,0 +1,416 @@
+package uptimeledger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joncrlsn/dque"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/zos/pkg"
+)
+
+const (
+	queueName   = "uptime"
+	historyFile = "uptime-history.json"
+
+	// keep is the number of reports kept in the history
+	keep = 500
+	// bootSlack is the max difference between the boot times computed from
+	// two samples of the same boot
+	bootSlack = time.Minute
+	// retry is how often pending samples are retried
+	retry = time.Minute
+	// statusPoll is how often the status of a submitted report is checked
+	statusPoll = 10 * time.Second
+)
+
+// Sample is an uptime sample
+type Sample struct {
+	Time   time.Time
+	Uptime uint64
+	// Boot is the boot time computed from the sample
+	Boot time.Time
+}
+
+func sampleBuilder() interface{} {
+	return &Sample{}
+}
+
+// Sender submits uptime reports to the extrinsic queue of the api-gateway,
+// it's implemented by stubs.ExtrinsicQueueStub
+type Sender interface {
+	SubmitUptime(ctx context.Context, uptime uint64, timestampHint uint64) (uint64, error)
+	Status(ctx context.Context, ticket uint64) (pkg.ExtrinsicStatus, error)
+}
+
+// submitted is a report waiting for inclusion on chain
+type submitted struct {
+	ticket  uint64
+	current Sample
+	// size is the number of queued samples the report covers
+	size int
+}
+
+// Ledger records uptime samples in a persisted queue and reports them to the
+// chain. The chain only accepts the current uptime, so samples that could not
+// be reported (chain not reachable) are covered by the next successful report
+// as long as the node didn't reboot.
+//
+// Reports are submitted to the extrinsic queue and the ledger polls their
+// status, samples are only removed from the queue once the report is included
+// in a block. A failed report is submitted again with the current uptime.
+type Ledger struct {
+	root   string
+	sender Sender
+	queue  *dque.DQue
+	uptime func() (time.Duration, error)
+	poll   time.Duration
+	// send serializes samples and reports with Flush
+	send sync.Mutex
+
+	m       sync.Mutex
+	history []pkg.UptimeReport
+	err     string
+	// submitted is only set with send held
+	submitted *submitted
+}
+
+var _ pkg.UptimeHistory = (*Ledger)(nil)
+
+// NewLedger opens the ledger in root
+func NewLedger(root string, sender Sender) (*Ledger, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, errors.Wrap(err, "failed to create uptime ledger directory")
+	}
+
+	var queue *dque.DQue
+	var err error
+	for i := 0; i < 3; i++ {
+		queue, err = dque.NewOrOpen(queueName, root, 1024, sampleBuilder)
+		if err != nil {
+			os.RemoveAll(filepath.Join(root, queueName))
+			continue
+		}
+		break
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to setup uptime persisted queue")
+	}
+
+	ledger := &Ledger{
+		root:   root,
+		sender: sender,
+		queue:  queue,
+		uptime: readUptime,
+		poll:   statusPoll,
+	}
+
+	if err := ledger.load(); err != nil {
+		// the history is only informative
+		log.Error().Err(err).Msg("failed to load uptime history")
+	}
+
+	return ledger, nil
+}
+
+func readUptime() (time.Duration, error) {
+	data, err := os.ReadFile("/proc/uptime")
+	if err != nil {
+		return 0, err
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("invalid /proc/uptime")
+	}
+
+	seconds, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, errors.Wrap(err, "invalid /proc/uptime")
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+func (l *Ledger) sample(now time.Time) (Sample, error) {
+	uptime, err := l.uptime()
+	if err != nil {
+		return Sample{}, errors.Wrap(err, "failed to read uptime")
+	}
+
+	return Sample{
+		Time:   now,
+		Uptime: uint64(uptime.Seconds()),
+		Boot:   now.Add(-uptime),
+	}, nil
+}
+
+// Run takes an uptime sample every interval and reports the pending samples,
+// failed reports are retried every minute. Reported is called after the first
+// report is included on chain.
+func (l *Ledger) Run(ctx context.Context, interval time.Duration, reported func()) {
+	next := time.Now()
+	wait := time.Duration(0)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		l.send.Lock()
+		now := time.Now()
+		if !now.Before(next) {
+			next = now.Add(interval)
+			if err := l.record(now); err != nil {
+				log.Error().Err(err).Msg("failed to record uptime sample")
+			}
+		}
+
+		wait = time.Until(next)
+		report, err := l.report(ctx, now)
+		waiting := l.waiting()
+		l.send.Unlock()
+		if err != nil {
+			log.Error().Err(err).Int("pending", l.queue.Size()).Msg("failed to report uptime")
+			if wait > retry {
+				wait = retry
+			}
+			continue
+		}
+
+		if waiting && wait > l.poll {
+			wait = l.poll
+		}
+
+		if report != nil && reported != nil {
+			reported()
+			reported = nil
+		}
+	}
+}
+
+// Flush takes a sample and reports it with the pending ones, then waits until
+// the report is included or the context is cancelled. It's used to report the
+// final uptime before the node is powered off.
+func (l *Ledger) Flush(ctx context.Context) error {
+	l.send.Lock()
+	defer l.send.Unlock()
+
+	if err := l.record(time.Now()); err != nil {
+		return err
+	}
+
+	for {
+		if _, err := l.report(ctx, time.Now()); err != nil {
+			return err
+		}
+
+		if l.queue.Size() == 0 {
+			return nil
+		}
+
+		if !l.waiting() {
+			// a report submitted before the flush was included, the flush
+			// sample is submitted right away
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(l.poll):
+		}
+	}
+}
+
+// record adds a sample to the queue
+func (l *Ledger) record(now time.Time) error {
+	sample, err := l.sample(now)
+	if err != nil {
+		return err
+	}
+
+	return l.queue.Enqueue(&sample)
+}
+
+// waiting is set if a report is waiting for inclusion
+func (l *Ledger) waiting() bool {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	return l.submitted != nil
+}
+
+// report submits the current uptime if there are pending samples. If a report
+// was submitted already, it checks its status and removes the samples covered
+// by the report from the queue once it's included. It returns nil if there is
+// nothing to report or the report is not included yet.
+// It must be called with l.send held.
+func (l *Ledger) report(ctx context.Context, now time.Time) (*pkg.UptimeReport, error) {
+	submitted := l.submitted
+	if submitted == nil {
+		return nil, l.submit(ctx, now)
+	}
+
+	status, err := l.sender.Status(ctx, submitted.ticket)
+	if err != nil {
+		// the ticket is unknown if the api-gateway restarted
+		return nil, l.failed(errors.Wrap(err, "failed to get uptime report status"))
+	}
+
+	switch status.State {
+	case pkg.ExtrinsicQueued:
+		return nil, nil
+	case pkg.ExtrinsicFailed:
+		return nil, l.failed(fmt.Errorf("uptime report failed: %s", status.Error))
+	}
+
+	l.m.Lock()
+	defer l.m.Unlock()
+	l.submitted = nil
+	l.err = ""
+
+	report := pkg.UptimeReport{
+		Sent:   submitted.current.Time,
+		Uptime: submitted.current.Uptime,
+		Hash:   status.Hash,
+	}
+
+	current := submitted.current
+	for i := 0; i < submitted.size; i++ {
+		item, err := l.queue.Dequeue()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to dequeue uptime sample")
+		}
+
+		sample := item.(*Sample)
+		if !sameBoot(sample.Boot, current.Boot) {
+			report.Lost++
+			continue
+		}
+
+		if report.Samples == 0 {
+			report.First = sample.Time
+		}
+		report.Samples++
+	}
+
+	l.history = append([]pkg.UptimeReport{report}, l.history...)
+	if len(l.history) > keep {
+		l.history = l.history[:keep]
+	}
+
+	if report.Lost != 0 {
+		log.Warn().Int("lost", report.Lost).Msg("uptime samples of a previous boot were not reported")
+	}
+
+	if err := l.save(); err != nil {
+		log.Error().Err(err).Msg("failed to save uptime history")
+	}
+
+	return &report, nil
+}
+
+// submit submits the current uptime if there are pending samples
+func (l *Ledger) submit(ctx context.Context, now time.Time) error {
+	size := l.queue.Size()
+	if size == 0 {
+		return nil
+	}
+
+	current, err := l.sample(now)
+	if err != nil {
+		return err
+	}
+
+	ticket, err := l.sender.SubmitUptime(ctx, current.Uptime, uint64(current.Time.Unix()))
+	if err != nil {
+		return l.failed(errors.Wrap(err, "failed to submit uptime report"))
+	}
+
+	l.m.Lock()
+	l.submitted = &submitted{ticket: ticket, current: current, size: size}
+	l.m.Unlock()
+	return nil
+}
+
+// failed records the error of a report attempt, the report is submitted again
+// on next attempt
+func (l *Ledger) failed(err error) error {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	l.submitted = nil
+	l.err = err.Error()
+	return err
+}
+
+func sameBoot(a, b time.Time) bool {
+	diff := a.Sub(b)
+	return diff < bootSlack && diff > -bootSlack
+}
+
+func (l *Ledger) load() error {
+	data, err := os.ReadFile(filepath.Join(l.root, historyFile))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, &l.history)
+}
+
+func (l *Ledger) save() error {
+	data, err := json.Marshal(l.history)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(l.root, historyFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// Reports implements pkg.UptimeHistory
+func (l *Ledger) Reports() []pkg.UptimeReport {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	return append([]pkg.UptimeReport{}, l.history...)
+}
+
+// Pending implements pkg.UptimeHistory
+func (l *Ledger) Pending() pkg.UptimePending {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	pending := pkg.UptimePending{
+		Samples: l.queue.Size(),
+		Error:   l.err,
+	}
+
+	if l.submitted != nil {
+		pending.Ticket = l.submitted.ticket
+	}
+
+	if item, err := l.queue.Peek(); err == nil {
+		pending.Oldest = item.(*Sample).Time
+	}
+
+	return pending
+}
@@ -0,0 +1,152 @@
+package uptimeledger
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/threefoldtech/zos/pkg"
+)
+
+// testSender includes the submitted reports on the next status check
+type testSender struct {
+	err      error
+	state    pkg.ExtrinsicState
+	ticket   uint64
+	uptimes  []uint64
+	statuses int
+}
+
+func (s *testSender) SubmitUptime(ctx context.Context, uptime uint64, timestampHint uint64) (uint64, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+
+	s.ticket++
+	s.uptimes = append(s.uptimes, uptime)
+	return s.ticket, nil
+}
+
+func (s *testSender) Status(ctx context.Context, ticket uint64) (pkg.ExtrinsicStatus, error) {
+	s.statuses++
+	if ticket != s.ticket {
+		return pkg.ExtrinsicStatus{}, fmt.Errorf("unknown ticket %d", ticket)
+	}
+
+	return pkg.ExtrinsicStatus{Ticket: ticket, State: s.state, Hash: fmt.Sprintf("0x%d", ticket), Error: "rejected"}, nil
+}
+
+func TestReport(t *testing.T) {
+	sender := &testSender{err: fmt.Errorf("api-gateway not reachable"), state: pkg.ExtrinsicQueued}
+	ledger, err := NewLedger(t.TempDir(), sender)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	now := start
+	boot := start.Add(-time.Hour)
+	ledger.uptime = func() (time.Duration, error) {
+		return now.Sub(boot), nil
+	}
+	ledger.poll = time.Millisecond
+
+	// samples of a previous boot
+	for i := 0; i < 2; i++ {
+		now = start.Add(time.Duration(i) * 40 * time.Minute)
+		if err := ledger.record(now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// reboot
+	boot = start.Add(2 * time.Hour)
+	for i := 0; i < 3; i++ {
+		now = boot.Add(time.Duration(i+1) * 40 * time.Minute)
+		if err := ledger.record(now); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := ledger.report(context.Background(), now); err == nil {
+			t.Fatal("expected report to fail")
+		}
+	}
+
+	if pending := ledger.Pending(); pending.Samples != 5 || !pending.Oldest.Equal(start) || len(pending.Error) == 0 {
+		t.Fatalf("unexpected pending samples: %+v", pending)
+	}
+
+	// the report is submitted, samples are kept until it's included
+	sender.err = nil
+	if report, err := ledger.report(context.Background(), now); err != nil || report != nil {
+		t.Fatalf("expected report to be submitted: %v", err)
+	}
+
+	if report, err := ledger.report(context.Background(), now.Add(time.Minute)); err != nil || report != nil {
+		t.Fatalf("expected report to wait for inclusion: %v", err)
+	}
+
+	if pending := ledger.Pending(); pending.Samples != 5 || pending.Ticket != 1 {
+		t.Fatalf("unexpected pending samples: %+v", pending)
+	}
+
+	// a rejected report is submitted again
+	sender.state = pkg.ExtrinsicFailed
+	if _, err := ledger.report(context.Background(), now); err == nil {
+		t.Fatal("expected failed report error")
+	}
+
+	sender.state = pkg.ExtrinsicQueued
+	if _, err := ledger.report(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+
+	sender.state = pkg.ExtrinsicDone
+	report, err := ledger.report(context.Background(), now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sender.uptimes) != 2 || report.Hash != "0x2" {
+		t.Fatalf("unexpected submitted reports %v: %+v", sender.uptimes, report)
+	}
+
+	if report.Samples != 3 || report.Lost != 2 || !report.First.Equal(boot.Add(40*time.Minute)) {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	if report.Uptime != 120*60 {
+		t.Fatalf("unexpected uptime: %d", report.Uptime)
+	}
+
+	if pending := ledger.Pending(); pending.Samples != 0 || len(pending.Error) != 0 {
+		t.Fatalf("unexpected pending samples: %+v", pending)
+	}
+
+	// nothing to report
+	statuses := sender.statuses
+	if report, err := ledger.report(context.Background(), now); err != nil || report != nil || ledger.waiting() {
+		t.Fatalf("expected no report: %v", err)
+	}
+
+	if sender.statuses != statuses || len(sender.uptimes) != 2 {
+		t.Fatal("expected nothing to be submitted")
+	}
+
+	// final report before power off
+	if err := ledger.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// history is persisted
+	ledger.queue.Close()
+	reopened, err := NewLedger(ledger.root, sender)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reports := reopened.Reports(); len(reports) != 2 || reports[0].Samples != 1 || reports[1].Samples != 3 {
+		t.Fatalf("unexpected history: %+v", reports)
+	}
+}
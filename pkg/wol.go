@@ -0,0 +1,49 @@
+package pkg
+
+import "time"
+
+//go:generate zbusc -module power -version 0.0.1 -name wol -package stubs github.com/threefoldtech/zos/pkg+WakeOnLan stubs/wake_on_lan_stub.go
+
+// WolNIC is the wake on lan state of a physical nic
+type WolNIC struct {
+	Name string `json:"name"`
+	MAC  string `json:"mac"`
+	// Supports are the supported ethtool wake on lan modes, like pumbg
+	Supports string `json:"supports"`
+	// Current are the enabled modes, d if disabled
+	Current string `json:"current"`
+	// Capable is set if the nic can be woken by a magic packet
+	Capable bool `json:"capable"`
+	// Enabled is set if wake on magic packet is enabled
+	Enabled bool   `json:"enabled"`
+	Error   string `json:"error"`
+}
+
+// WolTest is the result of the wake on lan self test, a magic packet is sent
+// to a neighbor node that answers with a magic packet for the target nic
+type WolTest struct {
+	Time time.Time `json:"time"`
+	// Neighbor is the node that answered the test
+	Neighbor uint32 `json:"neighbor"`
+	Error    string `json:"error"`
+}
+
+// WolStatus is the wake on lan status of the node
+type WolStatus struct {
+	// Target is the nic the farm nodes send magic packets to
+	Target string `json:"target"`
+	MAC    string `json:"mac"`
+	// Enabled is set if the node can be woken through the target nic
+	Enabled bool     `json:"enabled"`
+	NICs    []WolNIC `json:"nics"`
+	Test    WolTest  `json:"test"`
+	// Peers are the target macs of the farm nodes, by node id, learned from
+	// their self tests signed with the node key
+	Peers map[uint32]string `json:"peers"`
+}
+
+// WakeOnLan interface
+type WakeOnLan interface {
+	// Status returns the wake on lan status of the node
+	Status() WolStatus
+}
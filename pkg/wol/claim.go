@@ -0,0 +1,61 @@
+package wol
+
+import (
+	"crypto/ed25519"
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// claimLength is the length of the self test data, the node id and the
+// signature
+const claimLength = 4 + ed25519.SignatureSize
+
+// Claim is sent with a self test, the node claims it's woken through the
+// nic the test is sent from. It's signed with the node key since the test
+// is a broadcast frame any host of the lan can forge.
+type Claim struct {
+	Node uint32
+	MAC  net.HardwareAddr
+
+	nonce     []byte
+	signature []byte
+}
+
+// message is the signed part of the claim
+func (c *Claim) message() []byte {
+	msg := make([]byte, 4, 4+len(c.MAC)+len(c.nonce))
+	binary.BigEndian.PutUint32(msg, c.Node)
+	msg = append(msg, c.MAC...)
+	return append(msg, c.nonce...)
+}
+
+// Verify checks the claim is signed by the node key
+func (c *Claim) Verify(pk ed25519.PublicKey) bool {
+	if len(pk) != ed25519.PublicKeySize {
+		return false
+	}
+
+	return ed25519.Verify(pk, c.message(), c.signature)
+}
+
+// encode signs the claim and returns the self test data
+func (c *Claim) encode(sk ed25519.PrivateKey) []byte {
+	data := make([]byte, 4, claimLength)
+	binary.BigEndian.PutUint32(data, c.Node)
+	return append(data, ed25519.Sign(sk, c.message())...)
+}
+
+// parseClaim parses the self test data of a test sent by mac
+func parseClaim(mac net.HardwareAddr, nonce, data []byte) (Claim, error) {
+	if len(data) < claimLength {
+		return Claim{}, fmt.Errorf("self test data too short")
+	}
+
+	return Claim{
+		Node:      binary.BigEndian.Uint32(data),
+		MAC:       mac,
+		nonce:     nonce,
+		signature: data[4:claimLength],
+	}, nil
+}
@@ -0,0 +1,69 @@
+package wol
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ModeMagic is the ethtool wake on lan mode for magic packets
+const ModeMagic = "g"
+
+// Settings are the wake on lan settings of a nic
+type Settings struct {
+	// Supports are the supported wake on lan modes, like pumbg
+	Supports string
+	// Current are the enabled modes, d if disabled
+	Current string
+}
+
+// Capable checks if the nic can be woken by a magic packet
+func (s *Settings) Capable() bool {
+	return strings.Contains(s.Supports, ModeMagic)
+}
+
+// Enabled checks if wake on magic packet is enabled
+func (s *Settings) Enabled() bool {
+	return strings.Contains(s.Current, ModeMagic)
+}
+
+// Parse parses the wake on lan settings from the output of ethtool
+func Parse(output string) Settings {
+	var settings Settings
+	for _, line := range strings.Split(output, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "Supports Wake-on":
+			settings.Supports = strings.TrimSpace(value)
+		case "Wake-on":
+			settings.Current = strings.TrimSpace(value)
+		}
+	}
+
+	return settings
+}
+
+// Inspect gets the wake on lan settings of the nic
+func Inspect(ctx context.Context, nic string) (Settings, error) {
+	output, err := exec.CommandContext(ctx, "ethtool", nic).CombinedOutput()
+	if err != nil {
+		return Settings{}, fmt.Errorf("ethtool %s: %w: %s", nic, err, strings.TrimSpace(string(output)))
+	}
+
+	return Parse(string(output)), nil
+}
+
+// Enable enables wake on magic packet on the nic
+func Enable(ctx context.Context, nic string) error {
+	output, err := exec.CommandContext(ctx, "ethtool", "-s", nic, "wol", ModeMagic).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ethtool -s %s wol %s: %w: %s", nic, ModeMagic, err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
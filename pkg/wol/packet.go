@@ -0,0 +1,91 @@
+package wol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+const (
+	// EtherType of wake on lan frames
+	EtherType = 0x0842
+
+	syncLength  = 6
+	repeat      = 16
+	magicLength = syncLength + repeat*6
+	// NonceLength is the length of the magic packet password, used as a
+	// nonce by the self test
+	NonceLength = 6
+)
+
+var broadcast = net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+// Magic builds a magic packet for target. The nonce is sent as the magic
+// packet password and data is appended after it, both are optional.
+func Magic(target net.HardwareAddr, nonce []byte, data []byte) ([]byte, error) {
+	if len(target) != 6 {
+		return nil, fmt.Errorf("invalid mac address '%s'", target)
+	}
+
+	if len(nonce) != 0 && len(nonce) != NonceLength {
+		return nil, fmt.Errorf("nonce must be %d bytes", NonceLength)
+	}
+
+	packet := bytes.Repeat([]byte{0xff}, syncLength)
+	for i := 0; i < repeat; i++ {
+		packet = append(packet, target...)
+	}
+
+	packet = append(packet, nonce...)
+	return append(packet, data...), nil
+}
+
+// ParseMagic parses a magic packet, it returns the target, the nonce and the
+// data after the nonce if any
+func ParseMagic(packet []byte) (target net.HardwareAddr, nonce []byte, data []byte, err error) {
+	if len(packet) < magicLength {
+		return nil, nil, nil, fmt.Errorf("magic packet too short")
+	}
+
+	if !bytes.Equal(packet[:syncLength], broadcast) {
+		return nil, nil, nil, fmt.Errorf("invalid magic packet sync stream")
+	}
+
+	target = net.HardwareAddr(packet[syncLength : syncLength+6])
+	for i := 1; i < repeat; i++ {
+		offset := syncLength + i*6
+		if !bytes.Equal(packet[offset:offset+6], target) {
+			return nil, nil, nil, fmt.Errorf("invalid magic packet target")
+		}
+	}
+
+	rest := packet[magicLength:]
+	if len(rest) >= NonceLength {
+		nonce, data = rest[:NonceLength], rest[NonceLength:]
+	}
+
+	return target, nonce, data, nil
+}
+
+// frame builds an ethernet frame with the wake on lan ether type
+func frame(dst, src net.HardwareAddr, payload []byte) []byte {
+	buf := make([]byte, 14, 14+len(payload))
+	copy(buf[0:6], dst)
+	copy(buf[6:12], src)
+	binary.BigEndian.PutUint16(buf[12:14], EtherType)
+	return append(buf, payload...)
+}
+
+// parseFrame returns the destination, source and payload of an ethernet frame
+func parseFrame(buf []byte) (dst, src net.HardwareAddr, payload []byte, err error) {
+	if len(buf) < 14 {
+		return nil, nil, nil, fmt.Errorf("frame too short")
+	}
+
+	if binary.BigEndian.Uint16(buf[12:14]) != EtherType {
+		return nil, nil, nil, fmt.Errorf("not a wake on lan frame")
+	}
+
+	return net.HardwareAddr(buf[0:6]), net.HardwareAddr(buf[6:12]), buf[14:], nil
+}
@@ -0,0 +1,241 @@
+package wol
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// pollTimeout is how often blocking reads check for context cancellation
+const pollTimeout = time.Second
+
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
+
+// conn is a raw socket for wake on lan frames
+type conn struct {
+	fd int
+}
+
+// open opens a raw socket bound to the nic, or to all nics if nic is empty
+func open(nic string) (*conn, error) {
+	index := 0
+	if len(nic) != 0 {
+		inf, err := net.InterfaceByName(nic)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get nic '%s'", nic)
+		}
+		index = inf.Index
+	}
+
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, int(htons(EtherType)))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open raw socket")
+	}
+
+	addr := syscall.SockaddrLinklayer{Protocol: htons(EtherType), Ifindex: index}
+	if err := syscall.Bind(fd, &addr); err != nil {
+		syscall.Close(fd)
+		return nil, errors.Wrap(err, "failed to bind raw socket")
+	}
+
+	tv := syscall.NsecToTimeval(pollTimeout.Nanoseconds())
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		syscall.Close(fd)
+		return nil, errors.Wrap(err, "failed to set raw socket timeout")
+	}
+
+	return &conn{fd: fd}, nil
+}
+
+func (c *conn) Close() error {
+	return syscall.Close(c.fd)
+}
+
+// send sends the payload to dst out of the nic with the given index
+func (c *conn) send(index int, dst net.HardwareAddr, payload []byte) error {
+	inf, err := net.InterfaceByIndex(index)
+	if err != nil {
+		return err
+	}
+
+	addr := syscall.SockaddrLinklayer{Protocol: htons(EtherType), Ifindex: index, Halen: 6}
+	copy(addr.Addr[:], dst)
+	return syscall.Sendto(c.fd, frame(dst, inf.HardwareAddr, payload), 0, &addr)
+}
+
+// packet is a received wake on lan frame
+type packet struct {
+	index   int
+	dst     net.HardwareAddr
+	src     net.HardwareAddr
+	payload []byte
+}
+
+// receive waits for an incoming frame until the context is cancelled
+func (c *conn) receive(ctx context.Context) (packet, error) {
+	buf := make([]byte, 1514)
+	for {
+		if err := ctx.Err(); err != nil {
+			return packet{}, err
+		}
+
+		n, from, err := syscall.Recvfrom(c.fd, buf, 0)
+		if err == syscall.EAGAIN || err == syscall.EINTR {
+			continue
+		} else if err != nil {
+			return packet{}, err
+		}
+
+		addr, ok := from.(*syscall.SockaddrLinklayer)
+		if !ok || addr.Pkttype == syscall.PACKET_OUTGOING {
+			continue
+		}
+
+		dst, src, payload, err := parseFrame(buf[:n])
+		if err != nil {
+			continue
+		}
+
+		return packet{
+			index:   addr.Ifindex,
+			dst:     append(net.HardwareAddr{}, dst...),
+			src:     append(net.HardwareAddr{}, src...),
+			payload: append([]byte{}, payload...),
+		}, nil
+	}
+}
+
+// Wake sends a magic packet for target out of the nic
+func Wake(nic string, target net.HardwareAddr) error {
+	inf, err := net.InterfaceByName(nic)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get nic '%s'", nic)
+	}
+
+	payload, err := Magic(target, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	c, err := open(nic)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	return c.send(inf.Index, broadcast, payload)
+}
+
+// Test sends a magic packet for the neighbor out of the nic and waits for the
+// neighbor to answer with a magic packet for the nic. A claim signed with the
+// node key is sent with the packet so the neighbor learns which mac wakes
+// this node.
+func Test(ctx context.Context, nic string, neighbor net.HardwareAddr, node uint32, sk ed25519.PrivateKey) error {
+	inf, err := net.InterfaceByName(nic)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get nic '%s'", nic)
+	}
+
+	nonce := make([]byte, NonceLength)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	claim := Claim{Node: node, MAC: inf.HardwareAddr, nonce: nonce}
+	payload, err := Magic(neighbor, nonce, claim.encode(sk))
+	if err != nil {
+		return err
+	}
+
+	c, err := open(nic)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if err := c.send(inf.Index, broadcast, payload); err != nil {
+		return errors.Wrap(err, "failed to send magic packet")
+	}
+
+	for {
+		pkt, err := c.receive(ctx)
+		if err != nil {
+			return errors.Wrapf(err, "no answer from %s", neighbor)
+		}
+
+		target, answer, _, err := ParseMagic(pkt.payload)
+		if err != nil {
+			continue
+		}
+
+		if bytes.Equal(target, inf.HardwareAddr) && bytes.Equal(answer, nonce) {
+			return nil
+		}
+	}
+}
+
+// Respond answers the tests of the other nodes until the context is
+// cancelled. Learn is called with the claim of each test after it's answered,
+// it must verify the claim.
+func Respond(ctx context.Context, learn func(claim Claim)) error {
+	c, err := open("")
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	for {
+		pkt, err := c.receive(ctx)
+		if err != nil {
+			return err
+		}
+
+		// answers are sent to the tester mac, tests are broadcast
+		if !bytes.Equal(pkt.dst, broadcast) {
+			continue
+		}
+
+		target, nonce, data, err := ParseMagic(pkt.payload)
+		if err != nil || len(nonce) == 0 || !local(target) {
+			continue
+		}
+
+		answer, err := Magic(pkt.src, nonce, nil)
+		if err != nil {
+			continue
+		}
+
+		if err := c.send(pkt.index, pkt.src, answer); err != nil {
+			log.Error().Err(err).Stringer("mac", pkt.src).Msg("failed to answer wol test")
+		}
+
+		if claim, err := parseClaim(pkt.src, nonce, data); err == nil && learn != nil {
+			learn(claim)
+		}
+	}
+}
+
+// local checks if mac is the mac of one of the node nics
+func local(mac net.HardwareAddr) bool {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return false
+	}
+
+	for _, inf := range interfaces {
+		if bytes.Equal(inf.HardwareAddr, mac) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,112 @@
+package wol
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"net"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	const output = `Settings for eth0:
+	Supported ports: [ TP ]
+	Speed: 1000Mb/s
+	Supports Wake-on: pumbg
+	Wake-on: d
+	Link detected: yes
+`
+
+	settings := Parse(output)
+	if settings.Supports != "pumbg" || settings.Current != "d" {
+		t.Fatalf("unexpected settings: %+v", settings)
+	}
+
+	if !settings.Capable() || settings.Enabled() {
+		t.Fatalf("expected capable and disabled: %+v", settings)
+	}
+
+	settings = Parse("Settings for eth1:\n\tLink detected: yes\n")
+	if settings.Capable() || settings.Enabled() {
+		t.Fatalf("expected not capable: %+v", settings)
+	}
+}
+
+func TestMagic(t *testing.T) {
+	mac, _ := net.ParseMAC("52:54:00:12:34:56")
+	nonce := []byte{1, 2, 3, 4, 5, 6}
+
+	packet, err := Magic(mac, nonce, []byte{0, 0, 0, 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(packet) != magicLength+NonceLength+4 {
+		t.Fatalf("unexpected packet length %d", len(packet))
+	}
+
+	target, got, data, err := ParseMagic(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(target, mac) || !bytes.Equal(got, nonce) || !bytes.Equal(data, []byte{0, 0, 0, 7}) {
+		t.Fatalf("unexpected magic packet %s %v %v", target, got, data)
+	}
+
+	// plain magic packet
+	packet, _ = Magic(mac, nil, nil)
+	if _, got, _, err := ParseMagic(packet); err != nil || got != nil {
+		t.Fatalf("unexpected plain magic packet: %v %v", got, err)
+	}
+
+	packet[20] = 0xaa
+	if _, _, _, err := ParseMagic(packet); err == nil {
+		t.Fatal("expected invalid magic packet")
+	}
+
+	if _, err := Magic(mac, []byte{1}, nil); err == nil {
+		t.Fatal("expected invalid nonce")
+	}
+}
+
+func TestFrame(t *testing.T) {
+	src, _ := net.ParseMAC("52:54:00:12:34:56")
+	dst, src2, payload, err := parseFrame(frame(broadcast, src, []byte{1, 2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(dst, broadcast) || !bytes.Equal(src2, src) || !bytes.Equal(payload, []byte{1, 2}) {
+		t.Fatalf("unexpected frame %s %s %v", dst, src2, payload)
+	}
+}
+
+func TestClaim(t *testing.T) {
+	pk, sk, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mac, _ := net.ParseMAC("52:54:00:12:34:56")
+	nonce := []byte{1, 2, 3, 4, 5, 6}
+	data := (&Claim{Node: 7, MAC: mac, nonce: nonce}).encode(sk)
+
+	claim, err := parseClaim(mac, nonce, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claim.Node != 7 || !claim.Verify(pk) {
+		t.Fatalf("expected valid claim of node 7: %+v", claim)
+	}
+
+	// the test was sent from another mac
+	other, _ := net.ParseMAC("52:54:00:65:43:21")
+	if claim, _ := parseClaim(other, nonce, data); claim.Verify(pk) {
+		t.Fatal("claim must not be valid for another mac")
+	}
+
+	if _, err := parseClaim(mac, nonce, data[:4]); err == nil {
+		t.Fatal("expected unsigned claim error")
+	}
+}
@@ -0,0 +1,47 @@
+// Package zosconfig loads the sections of zos-config that are not part of
+// environment.Config, like the rmb, firewall and power policies.
+package zosconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/zosbase/pkg/environment"
+)
+
+// configURL is the zos-config file of a running mode
+const configURL = "https://raw.githubusercontent.com/threefoldtech/zos-config/main/%s.json"
+
+// GetConfig decodes the zos-config of the node running mode into sections.
+// sections is a pointer to a struct with a field for each section to load,
+// the other sections are ignored.
+func GetConfig(sections interface{}) error {
+	env, err := environment.Get()
+	if err != nil {
+		return errors.Wrap(err, "failed to get node environment")
+	}
+
+	return GetConfigForMode(env.RunningMode, sections)
+}
+
+// GetConfigForMode is like GetConfig for the zos-config of mode
+func GetConfigForMode(mode environment.RunningMode, sections interface{}) error {
+	res, err := retryablehttp.Get(fmt.Sprintf(configURL, mode.String()))
+	if err != nil {
+		return errors.Wrap(err, "failed to get zos-config")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to get zos-config: %s", res.Status)
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(sections); err != nil {
+		return errors.Wrap(err, "failed to decode zos-config")
+	}
+
+	return nil
+}